@@ -0,0 +1,176 @@
+package MAPL_engine
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+//--------------------------------------
+// CheckBatch
+//--------------------------------------
+
+// BatchResult is the result of checking one message of a batch
+type BatchResult struct {
+	Index     int    `json:"index"` // the index of the message in the input
+	MessageID string `json:"messageID"`
+	Result    Result `json:"result"`
+	Err       error  `json:"-"` // the error of CheckWithContext (the context's error if the batch was cancelled)
+}
+
+// BatchStats are the statistics of a batch. They are complete once the results channel is closed.
+type BatchStats struct {
+	Messages  int             `json:"messages"`  // the number of messages that were checked
+	Errors    int             `json:"errors"`    // the number of messages that could not be checked
+	Decisions map[string]int  `json:"decisions"` // the number of messages per decision string
+	Outcomes  map[Outcome]int `json:"outcomes"`  // the number of messages per outcome (match, no-match or error)
+	RuleHits  []int           `json:"ruleHits"`  // the number of messages that each rule applies to (by rule index)
+}
+
+// WithBatchWorkers sets the number of goroutines that check the messages of a batch (GOMAXPROCS by default)
+func WithBatchWorkers(workers int) CheckOption {
+	return func(o *checkOptions) {
+		o.batchWorkers = workers
+	}
+}
+
+// CheckBatch checks the messages against the rules (as CheckWithContext does) with a pool of goroutines.
+// The results are streamed over the returned channel in the order of the messages. The channel is closed when all the messages were checked
+// (or when the context is cancelled). The caller must read the channel until it is closed or cancel the context.
+func CheckBatch(ctx context.Context, messages []MessageAttributes, rules *Rules, options ...CheckOption) (<-chan BatchResult, *BatchStats) {
+
+	return cachedPolicySet(rules).CheckStream(ctx, streamMessages(ctx, messages), options...)
+}
+
+// streamMessages sends the messages over a channel (until the context is cancelled)
+func streamMessages(ctx context.Context, messages []MessageAttributes) <-chan MessageAttributes {
+
+	input := make(chan MessageAttributes)
+	go func() {
+		defer close(input)
+		for _, message := range messages {
+			select {
+			case input <- message:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return input
+}
+
+// CheckStream checks the messages read from the channel (until it is closed) as CheckBatch does
+func CheckStream(ctx context.Context, messages <-chan MessageAttributes, rules *Rules, options ...CheckOption) (<-chan BatchResult, *BatchStats) {
+
+	return cachedPolicySet(rules).CheckStream(ctx, messages, options...)
+}
+
+// CheckBatch checks the messages against the PolicySet as MAPL_engine.CheckBatch does
+func (p *PolicySet) CheckBatch(ctx context.Context, messages []MessageAttributes, options ...CheckOption) (<-chan BatchResult, *BatchStats) {
+
+	return p.CheckStream(ctx, streamMessages(ctx, messages), options...)
+}
+
+// CheckStream checks the messages against the PolicySet as MAPL_engine.CheckStream does
+func (p *PolicySet) CheckStream(ctx context.Context, messages <-chan MessageAttributes, options ...CheckOption) (<-chan BatchResult, *BatchStats) {
+
+	opts := p.newCheckOptions(options)
+	workers := opts.batchWorkers
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	stats := &BatchStats{
+		Decisions: make(map[string]int),
+		Outcomes:  make(map[Outcome]int),
+		RuleHits:  make([]int, len(p.rules.Rules)),
+	}
+
+	type job struct {
+		index   int
+		message MessageAttributes
+	}
+	jobs := make(chan job)
+	done := make(chan BatchResult, workers)
+	inFlight := make(chan struct{}, 2*workers) // bounds the number of results that wait for an earlier message
+	out := make(chan BatchResult, workers)
+
+	go func() { // reads the messages
+		defer close(jobs)
+		index := 0
+		for {
+			select {
+			case inFlight <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				jobs <- job{index: index, message: message}
+				index++
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				message := j.message
+				result, err := checkPolicySetWithContext(NewEvalContext(ctx), &message, p, opts)
+				done <- BatchResult{Index: j.index, MessageID: message.MessageID, Result: result, Err: err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	go func() { // restores the order of the messages
+		defer close(out)
+		pending := make(map[int]BatchResult)
+		next := 0
+		for batchResult := range done {
+			pending[batchResult.Index] = batchResult
+			for {
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+				stats.add(r)
+				if ctx.Err() == nil { // after the batch is cancelled the results are dropped (the results that were sent are a prefix of the input)
+					select {
+					case out <- r:
+					case <-ctx.Done():
+					}
+				}
+				<-inFlight
+			}
+		}
+	}()
+
+	return out, stats
+}
+
+func (s *BatchStats) add(r BatchResult) {
+	if r.Err != nil {
+		s.Errors++
+		return
+	}
+	s.Messages++
+	s.Decisions[r.Result.DecisionString]++
+	s.Outcomes[r.Result.Outcome]++
+	for _, i := range r.Result.AppliedRulesIndices {
+		s.RuleHits[i]++
+	}
+}
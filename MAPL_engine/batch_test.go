@@ -0,0 +1,106 @@
+package MAPL_engine
+
+import (
+	"context"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+const batchTestRepetitions = 100
+
+func TestCheckBatch(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		rules, err := YamlReadRulesFromFile("../files/rules/main_fields/rules_operations.yaml")
+		So(err, ShouldBeNil)
+		messages, err := YamlReadMessagesFromFile("../files/messages/main_fields/messages_operations.yaml")
+		So(err, ShouldBeNil)
+
+		batch := []MessageAttributes{}
+		for r := 0; r < batchTestRepetitions; r++ {
+			for _, message := range messages.Messages {
+				message.MessageID = fmt.Sprintf("%v-%v", message.MessageID, r)
+				batch = append(batch, message)
+			}
+		}
+
+		expectedResults := make([]Result, len(batch))
+		expectedStats := BatchStats{Decisions: make(map[string]int), Outcomes: make(map[Outcome]int), RuleHits: make([]int, len(rules.Rules))}
+		for i := range batch {
+			expectedResults[i], err = CheckWithContext(context.Background(), &batch[i], &rules)
+			So(err, ShouldBeNil)
+			expectedStats.add(BatchResult{Result: expectedResults[i]})
+		}
+
+		str := "test a batch of messages"
+		fmt.Println(str)
+
+		for _, workers := range []int{0, 1, 4, 16} {
+			results, stats := CheckBatch(context.Background(), batch, &rules, WithBatchWorkers(workers))
+			i := 0
+			for batchResult := range results {
+				So(batchResult.Err, ShouldBeNil)
+				So(batchResult.Index, ShouldEqual, i)
+				So(batchResult.MessageID, ShouldEqual, batch[i].MessageID)
+				So(batchResult.Result, ShouldResemble, expectedResults[i])
+				i++
+			}
+			So(i, ShouldEqual, len(batch))
+			So(*stats, ShouldResemble, expectedStats)
+			So(stats.Messages, ShouldEqual, len(batch))
+		}
+
+		str = "test a stream of messages"
+		fmt.Println(str)
+
+		input := make(chan MessageAttributes)
+		go func() {
+			for _, message := range batch {
+				input <- message
+			}
+			close(input)
+		}()
+		results, stats := CheckStream(context.Background(), input, &rules, WithBatchWorkers(8), WithWorkers(2))
+		i := 0
+		for batchResult := range results {
+			So(batchResult.Index, ShouldEqual, i)
+			So(batchResult.Result, ShouldResemble, expectedResults[i])
+			i++
+		}
+		So(i, ShouldEqual, len(batch))
+		So(*stats, ShouldResemble, expectedStats)
+
+		str = "test cancelling a batch"
+		fmt.Println(str)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		results, _ = CheckBatch(ctx, batch, &rules, WithBatchWorkers(4))
+		i = 0
+		for batchResult := range results {
+			So(batchResult.Index, ShouldEqual, i)
+			i++
+			if i == 10 {
+				cancel()
+			}
+		}
+		So(i, ShouldBeLessThan, len(batch))
+
+		str = "test errors"
+		fmt.Println(str)
+
+		results, stats = CheckBatch(context.Background(), batch[:5], &rules, WithCombiningAlgorithm("no-such-algorithm"))
+		for batchResult := range results {
+			So(batchResult.Err, ShouldNotBeNil)
+		}
+		So(stats.Errors, ShouldEqual, 5)
+		So(stats.Messages, ShouldEqual, 0)
+	})
+}
@@ -2,6 +2,7 @@
 package MAPL_engine
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -24,7 +25,7 @@ const (
 )
 
 var DecisionNames = [...]string{
-	DEFAULT: "rules do not apply to message - block by default",
+	DEFAULT: "rules do not apply to message",
 	ALLOW:   "allow",
 	ALERT:   "alert",
 	BLOCK:   "block",
@@ -33,93 +34,100 @@ var DecisionNames = [...]string{
 
 func Check(message *MessageAttributes, rules *Rules) (decision int, descisionString string, relevantRuleIndex int, results []int, appliedRulesIndices []int, ruleDescription string, checkExtraData [][]map[string]interface{}) {
 	//
-	// for each message we check its attributes against all of the rules and return a decision
+	// for each message we check its attributes against the candidate rules (see PolicySet) and return a decision.
+	// the PolicySet of the rules is compiled by the first check and cached until the rules change (see cachedPolicySet)
 	//
+	return checkPolicySet(message, cachedPolicySet(rules))
+}
 
-	N := len(rules.Rules)
-
-	results = make([]int, N)
-	ruleDescriptions := make([]string, N)
-	checkExtraData = make([][]map[string]interface{}, N)
-
-	sem := make(chan int, N) // semaphore pattern
-	if false {               // check in parallel
-
-		for i, rule := range rules.Rules { // check all the rules in parallel
-			go func(in_i int, in_rule Rule) {
-				results[in_i], checkExtraData[in_i] = CheckOneRule(message, &in_rule)
-				if desc, ok := in_rule.Metadata["description"]; ok {
-					ruleDescriptions[in_i] = desc
-				} else {
-					ruleDescriptions[in_i] = ""
-				}
-				sem <- 1 // mark that the one rule check is finished
-			}(i, rule)
-
-		}
+// CheckInParallel gives the same results as Check. the rules are checked with a pool of (at most) the given number of goroutines.
+// Check and CheckInParallel may be called from many goroutines that share the same rules.
+func CheckInParallel(message *MessageAttributes, rules *Rules, workers int) (decision int, descisionString string, relevantRuleIndex int, results []int, appliedRulesIndices []int, ruleDescription string, checkExtraData [][]map[string]interface{}) {
+	return checkPolicySet(message, cachedPolicySet(rules), WithWorkers(workers))
+}
 
-		// wait for all goroutines to finish
-		for i := 0; i < N; i++ {
-			<-sem
-		}
+func checkPolicySet(message *MessageAttributes, p *PolicySet, options ...CheckOption) (decision int, descisionString string, relevantRuleIndex int, results []int, appliedRulesIndices []int, ruleDescription string, checkExtraData [][]map[string]interface{}) {
 
-	} else { // used only for debugging
+	opts := p.newCheckOptions(options)
+	if p.decisionsErr != nil {
+		log.Println(p.decisionsErr) // the rules are checked with the built-in decisions
+		opts.ignoreDecisionsErr = true
+	}
+	if err := validateCombiningAlgorithm(opts.getCombiningAlgorithm(p.rules)); err != nil {
+		log.Println(err)
+		opts.combiningAlgorithm = MaxDecision // as before combining algorithms were supported
+	}
+	if _, _, err := p.getNoMatchAndErrorDecisions(opts); err != nil {
+		log.Println(err)
+		opts.ignoreDefaultsErr = true
+	}
+	result, _ := checkPolicySetWithContext(NewEvalContext(context.Background()), message, p, opts) // no error with a background context
+	for _, err := range result.Errors {
+		log.Println(err)
+	}
+	return result.Decision, result.DecisionString, result.RelevantRuleIndex, result.Results, result.AppliedRulesIndices, result.RuleDescription, result.ExtraData
+}
 
-		for in_i, in_rule := range rules.Rules {
-			results[in_i], checkExtraData[in_i] = CheckOneRule(message, &in_rule)
-			if desc, ok := in_rule.Metadata["description"]; ok {
-				ruleDescriptions[in_i] = desc
-			} else {
-				ruleDescriptions[in_i] = ""
-			}
-		}
+// CheckOneRules gives the result of testing the message attributes with of one rule.
+// A single rule doesn't know the user-defined decisions of its rule set, so only the built-in decisions are supported: a rule with a user-defined
+// decision gives DEFAULT (and the error is logged). The results of Check (or CheckWithContext) give the decision of every rule in the rule set's decisions.
+func CheckOneRule(message *MessageAttributes, ruleOriginal *Rule) (int, []map[string]interface{}) {
+	decision, extraData, err := checkOneRule(NewEvalContext(context.Background()), message, ruleOriginal)
+	if err != nil {
+		log.Println(err)
 	}
+	return decision, extraData
+}
 
-	// go over the results and test by order of precedence
-	appliedRulesIndices = make([]int, 0)
-	relevantRuleIndex = -1
+// checkOneRule gives the result of testing the message attributes with of one rule (with the built-in decisions) and the first error found while testing it
+func checkOneRule(evalContext *EvalContext, message *MessageAttributes, ruleOriginal *Rule) (int, []map[string]interface{}, error) {
 
-	max_decision := DEFAULT
-	ruleDescription = ""
-	for i := 0; i < N; i++ {
-		if results[i] > DEFAULT {
-			appliedRulesIndices = append(appliedRulesIndices, i)
-		}
-		if results[i] > max_decision {
-			max_decision = results[i]
-			ruleDescription = ruleDescriptions[i]
-			relevantRuleIndex = i
-		}
+	match, extraData, err := matchOneRule(evalContext, message, ruleOriginal)
+	if !match {
+		return DEFAULT, []map[string]interface{}{}, err
 	}
-	decision = max_decision
-	descisionString = DecisionNames[decision]
 
-	return decision, descisionString, relevantRuleIndex, results, appliedRulesIndices, ruleDescription, checkExtraData
+	// ----------------------
+	// if we got here then the rule applies and we use the rule's decision
+	decision := builtinDecisionVocabulary.code(ruleOriginal.Decision) // user-defined decisions are supported only with the rules that define them (see Check)
+	if decision == -1 {
+		return DEFAULT, []map[string]interface{}{}, firstError(err, fmt.Errorf("decision not supported [%v]", ruleOriginal.Decision))
+	}
+	return decision, extraData, err
 }
 
-// CheckOneRules gives the result of testing the message attributes with of one rule
-func CheckOneRule(message *MessageAttributes, ruleOriginal *Rule) (int, []map[string]interface{}) {
+// matchOneRule tests if the rule applies to the message attributes (without the rule's decision)
+func matchOneRule(evalContext *EvalContext, message *MessageAttributes, ruleOriginal *Rule) (bool, []map[string]interface{}, error) {
 
+	if ruleOriginal.preparationErr != nil { // the preparation by a check failed (see Rules.prepare)
+		return false, []map[string]interface{}{}, fmt.Errorf("can't prepare rule: %v", ruleOriginal.preparationErr)
+	}
 	if !ruleOriginal.ruleAlreadyPrepared {
-		ruleOriginal.SetPredefinedStringsAndLists(GlobalPredefinedStringsAndLists) // use the global if not set already
+		err := ruleOriginal.SetPredefinedStringsAndLists(GlobalPredefinedStringsAndLists) // use the global if not set already
+		if err != nil {
+			return false, []map[string]interface{}{}, fmt.Errorf("can't prepare rule: %v", err)
+		}
 	}
 	rule := ruleOriginal.preparedRule // the prepared rule is the one used below!
 	// ----------------------
 	// compare basic message attributes:
 
-	match := TestSender(rule, message)
+	match, err := testSender(rule, message)
 	if !match {
-		return DEFAULT, []map[string]interface{}{}
+		evalContext.rejectedBy(StageSender)
+		return false, []map[string]interface{}{}, err
 	}
 
-	match = TestReceiver(rule, message)
+	match, err = testReceiver(rule, message)
 	if !match {
-		return DEFAULT, []map[string]interface{}{}
+		evalContext.rejectedBy(StageReceiver)
+		return false, []map[string]interface{}{}, err
 	}
 
 	match = rule.OperationRegex.Match([]byte(message.RequestMethod)) // supports wildcards
 	if !match {
-		return DEFAULT, []map[string]interface{}{}
+		evalContext.rejectedBy(StageOperation)
+		return false, []map[string]interface{}{}, nil
 	}
 
 	// ----------------------
@@ -127,22 +135,26 @@ func CheckOneRule(message *MessageAttributes, ruleOriginal *Rule) (int, []map[st
 	if rule.Protocol == "tcp" {
 		match = rule.Resource.ResourceNameRegex.Match([]byte(message.DestinationPort))
 		if !match {
-			return DEFAULT, []map[string]interface{}{}
+			evalContext.rejectedBy(StageResource)
+			return false, []map[string]interface{}{}, nil
 		}
 	} else {
 		if rule.Protocol != "*" {
 			if !strings.EqualFold(message.ContextProtocol, rule.Protocol) { // regardless of case // need to support wildcards!
-				return DEFAULT, []map[string]interface{}{}
+				evalContext.rejectedBy(StageProtocol)
+				return false, []map[string]interface{}{}, nil
 			}
 
 			if rule.Resource.ResourceType != "*" {
 				if message.ContextType != rule.Resource.ResourceType { // need to support wildcards?
-					return DEFAULT, []map[string]interface{}{}
+					evalContext.rejectedBy(StageResource)
+					return false, []map[string]interface{}{}, nil
 				}
 			}
 			match = rule.Resource.ResourceNameRegex.Match([]byte(message.RequestPath)) // supports wildcards
 			if !match {
-				return DEFAULT, []map[string]interface{}{}
+				evalContext.rejectedBy(StageResource)
+				return false, []map[string]interface{}{}, nil
 			}
 		}
 	}
@@ -152,23 +164,14 @@ func CheckOneRule(message *MessageAttributes, ruleOriginal *Rule) (int, []map[st
 	conditionsResult := true // if there are no conditions then we skip the test and return the rule.Decision
 	extraData := []map[string]interface{}{}
 	if rule.Conditions.ConditionsTree != nil {
-		conditionsResult, extraData = TestConditions(ruleOriginal, message) // using original rule here. using prepared rule inside.
+		conditionsResult, extraData, err = evalNode(evalContext, rule.Conditions.ConditionsTree, message)
 	}
 	if conditionsResult == false {
-		return DEFAULT, []map[string]interface{}{}
+		evalContext.rejectedBy(StageConditions)
+		return false, []map[string]interface{}{}, err
 	}
 
-	// ----------------------
-	// if we got here then the rule applies and we use the rule's decision
-	switch rule.Decision {
-	case "allow", "ALLOW", "Allow":
-		return ALLOW, extraData
-	case "alert", "ALERT", "Alert":
-		return ALERT, extraData
-	case "block", "BLOCK", "Block":
-		return BLOCK, extraData
-	}
-	return DEFAULT, []map[string]interface{}{}
+	return true, extraData, err
 }
 
 func (rule *Rule) Check(message *MessageAttributes) (int, []map[string]interface{}) {
@@ -176,6 +179,14 @@ func (rule *Rule) Check(message *MessageAttributes) (int, []map[string]interface
 }
 
 func TestSender(rule *Rule, message *MessageAttributes) bool {
+	match, err := testSender(rule, message)
+	if err != nil {
+		log.Println(err)
+	}
+	return match
+}
+
+func testSender(rule *Rule, message *MessageAttributes) (bool, error) {
 
 	if rule.AlreadyConvertedFieldsToRegexFlag == false {
 		ConvertFieldsToRegex(rule)
@@ -196,18 +207,25 @@ func TestSender(rule *Rule, message *MessageAttributes) bool {
 		case "*", "workload":
 			match_temp = expandedSender.Regexp.Match([]byte(message.SourceService)) // supports wildcards
 		default:
-			log.Println("type not supported")
-			return false
+			return false, fmt.Errorf("sender type not supported [%v]", expandedSender.Type)
 		}
 		if match_temp == true {
 			match = true
 			break
 		}
 	}
-	return match
+	return match, nil
 }
 
 func TestReceiver(rule *Rule, message *MessageAttributes) bool {
+	match, err := testReceiver(rule, message)
+	if err != nil {
+		log.Println(err)
+	}
+	return match
+}
+
+func testReceiver(rule *Rule, message *MessageAttributes) (bool, error) {
 
 	if rule.AlreadyConvertedFieldsToRegexFlag == false {
 		ConvertFieldsToRegex(rule)
@@ -230,10 +248,7 @@ func TestReceiver(rule *Rule, message *MessageAttributes) bool {
 		case "*", "workload":
 			match_temp = expandedReceiver.Regexp.Match([]byte(message.DestinationService)) // supports wildcards
 		default:
-			log.Printf("%+v\n", rule)
-			log.Printf("type not supported")
-			return false
-
+			return false, fmt.Errorf("receiver type not supported [%v]", expandedReceiver.Type)
 		}
 
 		if match_temp == true {
@@ -241,7 +256,7 @@ func TestReceiver(rule *Rule, message *MessageAttributes) bool {
 			break
 		}
 	}
-	return match
+	return match, nil
 }
 
 // testConditions tests the conditions of the rule with the message attributes
@@ -251,7 +266,7 @@ func TestConditions(rule *Rule, message *MessageAttributes) (bool, []map[string]
 		rule.SetPredefinedStringsAndLists(GlobalPredefinedStringsAndLists)
 	}
 
-	if rule.preparedRule.Conditions.ConditionsTree != nil {
+	if rule.preparedRule != nil && rule.preparedRule.Conditions.ConditionsTree != nil {
 		return rule.preparedRule.Conditions.ConditionsTree.Eval(message)
 	}
 	return false, []map[string]interface{}{}
@@ -263,7 +278,7 @@ func (rule *Rule) TestConditions(message *MessageAttributes) (bool, []map[string
 }
 
 // testOneCondition tests one condition of the rule with the message attributes
-func testOneCondition(c *Condition, message *MessageAttributes) (bool, []map[string]interface{}) {
+func testOneCondition(evalContext *EvalContext, c *Condition, message *MessageAttributes) (bool, []map[string]interface{}, error) {
 
 	var valueToCompareInt int64
 	var valueToCompareFloat float64
@@ -286,6 +301,10 @@ func testOneCondition(c *Condition, message *MessageAttributes) (bool, []map[str
 		valueToCompareString = message.RequestUseragent
 		if c.Method == "RE" || c.Method == "re" || c.Method == "NRE" || c.Method == "nre" {
 			result = compareRegexFunc(valueToCompareString, c.Method, c.ValueRegex)
+		} else if isSemverMethod(c.Method) {
+			result = compareSemverFunc(valueToCompareString, c.ValueSemverRange)
+		} else if isIPMethod(c.Method) {
+			result = compareIPFunc(valueToCompareString, c.Method, c.ValueCIDRs)
 		} else {
 			result = compareStringWithWildcardsFunc(valueToCompareString, c.Method, c.ValueStringRegex)
 		}
@@ -298,11 +317,18 @@ func testOneCondition(c *Condition, message *MessageAttributes) (bool, []map[str
 		valueToCompareString = message.EncryptionType
 		if c.Method == "RE" || c.Method == "re" || c.Method == "NRE" || c.Method == "nre" {
 			result = compareRegexFunc(valueToCompareString, c.Method, c.ValueRegex)
+		} else if isSemverMethod(c.Method) {
+			result = compareSemverFunc(valueToCompareString, c.ValueSemverRange)
+		} else if isIPMethod(c.Method) {
+			result = compareIPFunc(valueToCompareString, c.Method, c.ValueCIDRs)
 		} else {
 			result = compareStringWithWildcardsFunc(valueToCompareString, c.Method, c.ValueStringRegex)
 		}
 
 	case ("encryptionVersion"):
+		if message.EncryptionVersion == nil {
+			return false, []map[string]interface{}{}, fmt.Errorf("message without encryptionVersion")
+		}
 		valueToCompareFloat = *message.EncryptionVersion
 		result = compareFloatFunc(valueToCompareFloat, c.Method, c.ValueFloat)
 
@@ -310,40 +336,47 @@ func testOneCondition(c *Condition, message *MessageAttributes) (bool, []map[str
 		valueToCompareString = message.Domain
 		if c.Method == "RE" || c.Method == "re" || c.Method == "NRE" || c.Method == "nre" {
 			result = compareRegexFunc(valueToCompareString, c.Method, c.ValueRegex)
+		} else if isSemverMethod(c.Method) {
+			result = compareSemverFunc(valueToCompareString, c.ValueSemverRange)
+		} else if isIPMethod(c.Method) {
+			result = compareIPFunc(valueToCompareString, c.Method, c.ValueCIDRs)
 		} else {
 			result = compareStringWithWildcardsFunc(valueToCompareString, c.Method, c.ValueStringRegex)
 		}
 
 	case ("$sender"):
-		return testSenderAttributeCondition(c, message), []map[string]interface{}{}
+		flag, err := testSenderAttributeCondition(c, message)
+		return flag, []map[string]interface{}{}, err
 
 	case ("$receiver"):
-		return testReceiverAttributeCondition(c, message), []map[string]interface{}{}
+		return testReceiverAttributeCondition(c, message), []map[string]interface{}{}, nil
 
 	case ("senderLabel"):
-		return testSenderLabelCondition(c, message), []map[string]interface{}{}
+		flag, err := testSenderLabelCondition(c, message)
+		return flag, []map[string]interface{}{}, err
 
 	case ("receiverLabel"):
-		return testReceiverLabelCondition(c, message), []map[string]interface{}{}
+		flag, err := testReceiverLabelCondition(c, message)
+		return flag, []map[string]interface{}{}, err
 
 	case ("jsonpath"):
 		var flag bool
+		var err error
 		if message.RequestRawInterface != nil && c.PreparedJsonpathQuery != nil {
-			flag = testJsonPathConditionOnInterface(c, message)
+			flag, err = testJsonPathConditionOnInterface(evalContext, c, message)
 		} else {
-			flag = testJsonPathCondition(c, message)
+			flag, err = testJsonPathCondition(evalContext, c, message)
 		}
 		if flag && c.ReturnValueJsonpath != nil {
 			extraDataTemp := getExtraData(c, message)
-			return flag, []map[string]interface{}{extraDataTemp}
+			return flag, []map[string]interface{}{extraDataTemp}, err
 		}
-		return flag, []map[string]interface{}{}
+		return flag, []map[string]interface{}{}, err
 
 	default:
-		log.Printf("condition keyword not supported: %+v\n", c) // was log.Fatalf
-		return false, []map[string]interface{}{}
+		return false, []map[string]interface{}{}, fmt.Errorf("condition keyword not supported [%v]", c.Attribute) // was log.Fatalf
 	}
-	return result, []map[string]interface{}{}
+	return result, []map[string]interface{}{}, nil
 }
 func getExtraData(c *Condition, message *MessageAttributes) map[string]interface{} {
 	if message.RequestRawInterface != nil {
@@ -406,7 +439,7 @@ func getExtraDataFromByteArray(returnValueJsonpathMap map[string]string, returnV
 	return extraDataTemp
 }
 
-func testSenderAttributeCondition(c *Condition, message *MessageAttributes) bool {
+func testSenderAttributeCondition(c *Condition, message *MessageAttributes) (bool, error) {
 
 	result := false
 	attributeSender := getAttribute("$sender", c.AttributeSenderObjectAttribute, *message)
@@ -414,18 +447,21 @@ func testSenderAttributeCondition(c *Condition, message *MessageAttributes) bool
 	if c.ValueIsReceiverObject {
 		valReceiver := getAttribute("$receiver", c.ValueReceiverObject, *message)
 		if c.Method == "RE" || c.Method == "re" || c.Method == "NRE" || c.Method == "nre" {
-			log.Println("wrong method with comparison of sender and receiver objects")
-			return false
+			return false, fmt.Errorf("wrong method with comparison of sender and receiver objects")
 		}
 		result = compareStringFunc(attributeSender, c.Method, valReceiver) // string comparison without wildcards
 	} else {
 		if c.Method == "RE" || c.Method == "re" || c.Method == "NRE" || c.Method == "nre" {
 			result = compareRegexFunc(attributeSender, c.Method, c.ValueRegex)
+		} else if isSemverMethod(c.Method) {
+			result = compareSemverFunc(attributeSender, c.ValueSemverRange)
+		} else if isIPMethod(c.Method) {
+			result = compareIPFunc(attributeSender, c.Method, c.ValueCIDRs)
 		} else {
 			result = compareStringWithWildcardsFunc(attributeSender, c.Method, c.ValueStringRegex) // string comparison with wildcards
 		}
 	}
-	return result
+	return result, nil
 
 }
 
@@ -436,30 +472,36 @@ func testReceiverAttributeCondition(c *Condition, message *MessageAttributes) bo
 
 	if c.Method == "RE" || c.Method == "re" || c.Method == "NRE" || c.Method == "nre" {
 		result = compareRegexFunc(attributeReceiver, c.Method, c.ValueRegex)
+	} else if isSemverMethod(c.Method) {
+		result = compareSemverFunc(attributeReceiver, c.ValueSemverRange)
+	} else if isIPMethod(c.Method) {
+		result = compareIPFunc(attributeReceiver, c.Method, c.ValueCIDRs)
 	} else {
 		result = compareStringWithWildcardsFunc(attributeReceiver, c.Method, c.ValueStringRegex) // string comparison with wildcards
 	}
 	return result
 }
 
-func testSenderLabelCondition(c *Condition, message *MessageAttributes) bool {
+func testSenderLabelCondition(c *Condition, message *MessageAttributes) (bool, error) {
 	result := false
 	if c.AttributeIsSenderLabel == false {
-		log.Println("senderLabel without the correct format")
-		return false
+		return false, fmt.Errorf("senderLabel without the correct format")
 	}
 	if valueToCompareString1, ok := message.SourceLabels[c.AttributeSenderLabelKey]; ok { // enter the block only if the key exists
 		if c.ValueIsReceiverLabel {
 			if valueToCompareString2, ok2 := message.DestinationLabels[c.ValueReceiverLabelKey]; ok2 {
 				if c.Method == "RE" || c.Method == "re" || c.Method == "NRE" || c.Method == "nre" {
-					log.Println("wrong method with comparison of two labels")
-					return false
+					return false, fmt.Errorf("wrong method with comparison of two labels")
 				}
 				result = compareStringFunc(valueToCompareString1, c.Method, valueToCompareString2) // string comparison without wildcards
 			}
 		} else {
 			if c.Method == "RE" || c.Method == "re" || c.Method == "NRE" || c.Method == "nre" {
 				result = compareRegexFunc(valueToCompareString1, c.Method, c.ValueRegex)
+			} else if isSemverMethod(c.Method) {
+				result = compareSemverFunc(valueToCompareString1, c.ValueSemverRange)
+			} else if isIPMethod(c.Method) {
+				result = compareIPFunc(valueToCompareString1, c.Method, c.ValueCIDRs)
 			} else {
 				if c.Method == "EX" || c.Method == "ex" { // just test the existence of the key
 					result = true
@@ -469,18 +511,21 @@ func testSenderLabelCondition(c *Condition, message *MessageAttributes) bool {
 			}
 		}
 	}
-	return result
+	return result, nil
 }
 
-func testReceiverLabelCondition(c *Condition, message *MessageAttributes) bool {
+func testReceiverLabelCondition(c *Condition, message *MessageAttributes) (bool, error) {
 	result := false
 	if c.AttributeIsReceiverLabel == false {
-		log.Println("receiverLabel without the correct format")
-		return false
+		return false, fmt.Errorf("receiverLabel without the correct format")
 	}
 	if valueToCompareString1, ok := message.DestinationLabels[c.AttributeReceiverLabelKey]; ok { // enter the block only if the key exists
 		if c.Method == "RE" || c.Method == "re" || c.Method == "NRE" || c.Method == "nre" {
 			result = compareRegexFunc(valueToCompareString1, c.Method, c.ValueRegex)
+		} else if isSemverMethod(c.Method) {
+			result = compareSemverFunc(valueToCompareString1, c.ValueSemverRange)
+		} else if isIPMethod(c.Method) {
+			result = compareIPFunc(valueToCompareString1, c.Method, c.ValueCIDRs)
 		} else {
 			if c.Method == "EX" || c.Method == "ex" { // just test the existence of the key
 				result = true
@@ -489,23 +534,22 @@ func testReceiverLabelCondition(c *Condition, message *MessageAttributes) bool {
 			}
 		}
 	}
-	return result
+	return result, nil
 }
 
-func testJsonPathCondition(c *Condition, message *MessageAttributes) bool {
+func testJsonPathCondition(evalContext *EvalContext, c *Condition, message *MessageAttributes) (bool, error) {
 
 	if c.AttributeIsJsonpath == false {
-		log.Println("jsonpath without the correct format")
-		return false
+		return false, fmt.Errorf("jsonpath without the correct format")
 	}
 	valueToCompareBytes := []byte{}
 	err := errors.New("error")
 	if c.AttributeIsJsonpathRelative {
 		if (*message).RequestJsonRawRelative == nil {
-			return false // By definition
+			return false, nil // By definition
 		}
 		if len(*message.RequestJsonRawRelative) == 0 { // how to protect against nil pointer?
-			return false // By definition. This will create a "change" if something is true in the a new deployment
+			return false, nil // By definition. This will create a "change" if something is true in the a new deployment
 		}
 		if c.AttributeJsonpathQuery == "$KEY" || strings.HasPrefix(c.AttributeJsonpathQuery, "$VALUE") {
 			valueToCompareBytes, err = getKeyValue(*message.RequestJsonRawRelative, c.AttributeJsonpathQuery)
@@ -518,47 +562,60 @@ func testJsonPathCondition(c *Condition, message *MessageAttributes) bool {
 		}
 	} else {
 		if (*message).RequestJsonRaw == nil {
-			return false // By definition
+			return false, nil // By definition
 		}
 		if len(*message.RequestJsonRaw) == 0 {
-			return false // By definition. This will create a "change" if something is true in the a new deployment
+			return false, nil // By definition. This will create a "change" if something is true in the a new deployment
 		}
 		valueToCompareBytes, err = jsonslice.Get(*message.RequestJsonRaw, c.AttributeJsonpathQuery)
 	}
 
 	if err != nil {
 		if c.Method == "NEX" || c.Method == "nex" { // just test the existence of the key
-			return true
+			return true, nil
 		}
-		return false
+		return false, nil
+	}
+
+	if isLengthMethod(c.Method) {
+		return compareLengthOfJsonFunc(valueToCompareBytes, c), nil
+	}
+	if isTypeMethod(c.Method) {
+		return len(valueToCompareBytes) > 0 && compareTypeOfJsonFunc(valueToCompareBytes, c), nil // an empty result is a missing field
 	}
 
 	valueToCompareString := string(valueToCompareBytes)
-	if len(valueToCompareString) == 0 {
-		return whatToReturnInCaseOfEmptyResult(*c)
+	if len(valueToCompareString) == 0 || valueToCompareString == "null" { // null is an empty result (as in testJsonPathConditionOnInterface)
+		return whatToReturnInCaseOfEmptyResult(*c), nil
 	}
 
 	valueToCompareString = removeQuotesAndBrackets(valueToCompareString)
 	if len(valueToCompareString) == 0 {
-		return whatToReturnInCaseOfEmptyResult(*c)
+		return whatToReturnInCaseOfEmptyResult(*c), nil
 	}
 
 	result := false
 	L := len(valueToCompareString) - 1
 	if L > 0 {
 		if valueToCompareString[0] == '"' && valueToCompareString[L] != '"' {
-			log.Println("quotation marks not aligned")
-			return false
+			return false, fmt.Errorf("quotation marks not aligned")
 		}
 		if valueToCompareString[L] == '"' && valueToCompareString[0] != '"' {
-			log.Println("quotation marks not aligned")
-			return false
+			return false, fmt.Errorf("quotation marks not aligned")
 		}
 		if valueToCompareString[L] == '"' && valueToCompareString[0] == '"' {
 			valueToCompareString = valueToCompareString[1:L]
 		}
 	}
 
+	if c.ValueIsJsonpath {
+		referencedValue, ok := getReferencedValueFromByteArray(c, message)
+		if !ok {
+			return false, nil // By definition (as a missing attribute)
+		}
+		return compareToReferencedValue(valueToCompareString, c.Method, referencedValue), nil
+	}
+
 	method := strings.ToUpper(c.Method)
 	switch method {
 	case "GE", "GT", "LE", "LT", "EQ", "NEQ", "NE":
@@ -566,63 +623,74 @@ func testJsonPathCondition(c *Condition, message *MessageAttributes) bool {
 		valueToCompareFloat, err := strconv.ParseFloat(valueStringWithoutUnits, 64)
 		valueToCompareFloat = valueToCompareFloat * factor
 
-		if err != nil {
-			if method == "EQ" || method == "NEQ" {
+		if err != nil || c.ValueFloat == nil {
+			if method == "EQ" || method == "NEQ" || method == "NE" {
 				result = compareStringFunc(valueToCompareString, c.Method, c.Value) // compare strings (strightforward comparison. use of wildcards is only via RE)
 			} else {
-				log.Println("can't parse jsonpath value [float]")
-				return false
+				return false, fmt.Errorf("can't parse jsonpath value [float]")
 			}
 		} else {
 			result = compareFloatFunc(valueToCompareFloat, c.Method, c.ValueFloat)
 		}
 	case "RE", "NRE":
 		result = compareRegexFunc(valueToCompareString, c.Method, c.ValueRegex)
+	case "SEMVER_LT", "SEMVER_LE", "SEMVER_GT", "SEMVER_GE", "SEMVER_EQ", "SEMVER_IN_RANGE":
+		result = compareSemverFunc(valueToCompareString, c.ValueSemverRange)
+	case "IN_CIDR", "NIN_CIDR", "IS_PRIVATE_IP", "IS_PUBLIC_IP":
+		result = compareIPFunc(valueToCompareString, c.Method, c.ValueCIDRs)
+	case "BEFORE", "AFTER", "OLDER_THAN", "NEWER_THAN":
+		result = compareTimeFunc(valueToCompareString, c, evalContext.now(message))
 	case "EX", "NEX":
 		if len(valueToCompareString) == 0 {
-			return method == "NEX" // just test the existence of the key
+			return method == "NEX", nil // just test the existence of the key
 		} else {
-			return method == "EX" // just test the existence of the key
+			return method == "EX", nil // just test the existence of the key
 		}
 	default:
-		log.Printf("method not supported: %v", method)
-		return false
+		return false, fmt.Errorf("method not supported [%v]", method)
 	}
 
-	return result
+	return result, nil
 }
 
-func testJsonPathConditionOnInterface(c *Condition, message *MessageAttributes) bool {
+func testJsonPathConditionOnInterface(evalContext *EvalContext, c *Condition, message *MessageAttributes) (bool, error) {
 
 	if c.AttributeIsJsonpath == false {
-		log.Println("jsonpath without the correct format")
-		return false
+		return false, fmt.Errorf("jsonpath without the correct format")
 	}
 
 	var valueToCompareInterface interface{}
 	var err = errors.New("error")
+	found := true
 
 	if c.AttributeIsJsonpathRelative {
 		if (*message).RequestRawInterfaceRelative == nil {
-			return false // By definition
+			return false, nil // By definition
 		}
 		if c.AttributeJsonpathQuery == "$KEY" || strings.HasPrefix(c.AttributeJsonpathQuery, "$VALUE") {
 			valueToCompareInterface, err = getKeyValueFromInterface(c, message)
 		} else {
-			valueToCompareInterface, err = queryInterface(c.PreparedJsonpathQuery, *message.RequestRawInterfaceRelative)
+			valueToCompareInterface, found, err = queryInterfaceField(c.PreparedJsonpathQuery, *message.RequestRawInterfaceRelative)
 		}
 	} else {
 		if (*message).RequestRawInterface == nil {
-			return false //by definition
+			return false, nil //by definition
 		}
-		valueToCompareInterface, err = queryInterface(c.PreparedJsonpathQuery, *message.RequestRawInterface)
+		valueToCompareInterface, found, err = queryInterfaceField(c.PreparedJsonpathQuery, *message.RequestRawInterface)
 	}
 
 	if err != nil {
 		if c.Method == "NEX" || c.Method == "nex" { // just test the existence of the key
-			return true
+			return true, nil
 		}
-		return false
+		return false, nil
+	}
+
+	if isLengthMethod(c.Method) {
+		return compareLengthFunc(valueToCompareInterface, c), nil
+	}
+	if isTypeMethod(c.Method) {
+		return found && compareTypeFunc(valueToCompareInterface, c), nil // a missing field and a null field are both nil
 	}
 
 	var valueToCompareString string
@@ -634,20 +702,26 @@ func testJsonPathConditionOnInterface(c *Condition, message *MessageAttributes)
 		valueToCompareString = fmt.Sprintf("%v", valueToCompareInterface)
 	}
 
-	if len(valueToCompareString) == 0 || valueToCompareString == "<nil>" {
-		return whatToReturnInCaseOfEmptyResult(*c)
+	if len(valueToCompareString) == 0 || valueToCompareInterface == nil {
+		return whatToReturnInCaseOfEmptyResult(*c), nil
 	}
 
 	valueToCompareString = removeQuotesAndBrackets(valueToCompareString)
 	if len(valueToCompareString) == 0 {
-		return whatToReturnInCaseOfEmptyResult(*c)
+		return whatToReturnInCaseOfEmptyResult(*c), nil
+	}
+
+	valueToCompareString, err = removeQuotesFromResult(valueToCompareString)
+	if err != nil {
+		return false, err
 	}
 
-	valueToCompareString, ok := removeQuotesFromResult(valueToCompareString)
-	{
+	if c.ValueIsJsonpath {
+		referencedValue, ok := getReferencedValueFromInterface(c, message)
 		if !ok {
-			return false
+			return false, nil // By definition (as a missing attribute)
 		}
+		return compareToReferencedValue(valueToCompareString, c.Method, referencedValue), nil
 	}
 
 	result := false
@@ -660,40 +734,44 @@ func testJsonPathConditionOnInterface(c *Condition, message *MessageAttributes)
 			valueStringWithoutUnits, factor := convertStringWithUnits(valueToCompareString) // if the conversion to float doesn't work we still want to use the original string so we use a temporary one
 			valueToCompareFloat, err = strconv.ParseFloat(valueStringWithoutUnits, 64)
 			if err != nil {
-				log.Println("can't parse jsonpath value [float]")
-				if method == "NEQ" {
-					return true
+				if method == "EQ" || method == "NEQ" || method == "NE" {
+					return compareStringFunc(valueToCompareString, method, c.Value), nil // compare strings (as with the raw bytes)
 				}
-				return false
+				return false, fmt.Errorf("can't parse jsonpath value [float]")
 			}
 			valueToCompareFloat = valueToCompareFloat * factor
 			flagCompareToNumber = true
 		}
 
 		if !flagCompareToNumber {
-			if method == "EQ" || method == "NEQ" {
+			if method == "EQ" || method == "NEQ" || method == "NE" {
 				//return compareStringWithWildcardsFunc(valueToCompareString, c.Method, c.ValueStringRegex) // compare strings with wildcards
-				return compareStringFunc(valueToCompareString, c.Method, c.Value) // compare strings (strightforward comparison. use of wildcards is only via RE)
+				return compareStringFunc(valueToCompareString, c.Method, c.Value), nil // compare strings (strightforward comparison. use of wildcards is only via RE)
 			} else {
-				return false // can't compare non-number
+				return false, nil // can't compare non-number
 			}
 		} else {
-			return compareFloatFunc(valueToCompareFloat, c.Method, c.ValueFloat)
+			return compareFloatFunc(valueToCompareFloat, c.Method, c.ValueFloat), nil
 		}
 	case "RE", "NRE":
 		result = compareRegexFunc(valueToCompareString, c.Method, c.ValueRegex)
+	case "SEMVER_LT", "SEMVER_LE", "SEMVER_GT", "SEMVER_GE", "SEMVER_EQ", "SEMVER_IN_RANGE":
+		result = compareSemverFunc(valueToCompareString, c.ValueSemverRange)
+	case "IN_CIDR", "NIN_CIDR", "IS_PRIVATE_IP", "IS_PUBLIC_IP":
+		result = compareIPFunc(valueToCompareString, c.Method, c.ValueCIDRs)
+	case "BEFORE", "AFTER", "OLDER_THAN", "NEWER_THAN":
+		result = compareTimeFunc(valueToCompareString, c, evalContext.now(message))
 	case "EX", "NEX":
 		if len(valueToCompareString) == 0 {
-			return method == "NEX" // just test the existence of the key
+			return method == "NEX", nil // just test the existence of the key
 		} else {
-			return method == "EX" // just test the existence of the key
+			return method == "EX", nil // just test the existence of the key
 		}
 	default:
-		log.Printf("method not supported: %v", method)
-		return false
+		return false, fmt.Errorf("method not supported [%v]", method)
 	}
 
-	return result
+	return result, nil
 }
 
 func getKeyValueFromInterface(c *Condition, message *MessageAttributes) (interface{}, error) {
@@ -717,7 +795,7 @@ func getKeyValueFromInterface(c *Condition, message *MessageAttributes) (interfa
 				err = nil
 				break
 			} else {
-				valueToCompareInterface, err = queryInterface(c.PreparedJsonpathQuery, v)
+				valueToCompareInterface, err = c.PreparedJsonpathQuery(v) // a missing field is an error (as in getKeyValue)
 				break
 			}
 		}
@@ -726,14 +804,77 @@ func getKeyValueFromInterface(c *Condition, message *MessageAttributes) (interfa
 }
 
 func queryInterface(preparedJsonpathQuery jsonpath.FilterFunc, rawInterface interface{}) (interface{}, error) {
+	valueToCompareInterface, _, err := queryInterfaceField(preparedJsonpathQuery, rawInterface)
+	return valueToCompareInterface, err
+}
+
+// queryInterfaceField is queryInterface that also returns whether the field exists (the value of both a missing field and a null field is nil)
+func queryInterfaceField(preparedJsonpathQuery jsonpath.FilterFunc, rawInterface interface{}) (interface{}, bool, error) {
 	valueToCompareInterface, err := preparedJsonpathQuery(rawInterface)
 	if err != nil {
 		errString := err.Error()
 		if strings.Contains(errString, `not found in JSON object at`) {
-			err = nil
+			return valueToCompareInterface, false, nil
 		}
 	}
-	return valueToCompareInterface, err
+	return valueToCompareInterface, err == nil, err
+}
+
+// getReferencedValueFromByteArray returns the value of the field that the value of the condition references (ok is false if the field is missing)
+func getReferencedValueFromByteArray(c *Condition, message *MessageAttributes) (string, bool) {
+	jsonRaw := message.RequestJsonRaw
+	if c.ValueIsJsonpathRelative {
+		jsonRaw = message.RequestJsonRawRelative
+	}
+	if jsonRaw == nil || len(*jsonRaw) == 0 {
+		return "", false
+	}
+	valueBytes, err := jsonslice.Get(*jsonRaw, c.ValueJsonpathQuery)
+	if err != nil {
+		return "", false
+	}
+	return referencedValueString(string(valueBytes))
+}
+
+// getReferencedValueFromInterface returns the value of the field that the value of the condition references (ok is false if the field is missing)
+func getReferencedValueFromInterface(c *Condition, message *MessageAttributes) (string, bool) {
+	rawInterface := message.RequestRawInterface
+	if c.ValueIsJsonpathRelative {
+		rawInterface = message.RequestRawInterfaceRelative
+	}
+	if rawInterface == nil || c.PreparedValueJsonpathQuery == nil {
+		return "", false
+	}
+	value, err := queryInterface(c.PreparedValueJsonpathQuery, *rawInterface)
+	if err != nil || value == nil {
+		return "", false
+	}
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		jsonBytes, _ := json.Marshal(value)
+		return referencedValueString(string(jsonBytes))
+	default:
+		return referencedValueString(fmt.Sprintf("%v", value))
+	}
+}
+
+func referencedValueString(value string) (string, bool) {
+	value = removeQuotesAndBrackets(value)
+	value, err := removeQuotesFromResult(value)
+	if err != nil || len(value) == 0 {
+		return "", false
+	}
+	return value, true
+}
+
+// compareToReferencedValue compares the value of the attribute to the value of the referenced field: as numbers (with units) if both are numbers and as strings otherwise (EQ and NEQ only)
+func compareToReferencedValue(value, method, referencedValue string) bool {
+	valueFloat, isNumber := parseNumberWithUnits(value)
+	referencedValueFloat, isReferencedNumber := parseNumberWithUnits(referencedValue)
+	if isNumber && isReferencedNumber {
+		return compareFloatFunc(valueFloat, method, &referencedValueFloat)
+	}
+	return compareStringFunc(value, method, referencedValue)
 }
 
 func whatToReturnInCaseOfEmptyResult(c Condition) bool {
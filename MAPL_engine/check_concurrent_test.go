@@ -0,0 +1,105 @@
+package MAPL_engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"io/ioutil"
+	"log"
+	"sync"
+	"testing"
+)
+
+var concurrentCheckTestRuleFiles = []string{
+	"../files/rules/with_jsonpath_conditions_ALL_ANY/rules_with_jsonpath_conditions_LT_and_LT_spec_containers_ANY.yaml",
+	"../files/rules/with_jsonpath_conditions_ALL_ANY/rules_with_jsonpath_conditions_LT_and_LT_spec_containers_ALL.yaml",
+	"../files/rules/with_jsonpath_conditions_ALL_ANY/rules_with_jsonpath_conditions_LT_and_LT_spec_containers_ANY_EX.yaml",
+	"../files/rules/with_conditions/rules_with_encryption_conditions.yaml",
+	"../files/rules/main_fields/rules_basic.yaml",
+	"../files/rules/main_fields/rules_operations.yaml",
+}
+
+const concurrentCheckTestGoroutines = 64
+const concurrentCheckTestRepetitions = 20
+
+// run with go test -race to test that checking rules from many goroutines is race free
+func TestConcurrentCheck(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test many goroutines that share the same rules"
+		fmt.Println(str)
+
+		readRules := func() Rules {
+			allRules := Rules{}
+			for _, filename := range concurrentCheckTestRuleFiles {
+				rules, err := YamlReadRulesFromFile(filename)
+				So(err, ShouldBeNil)
+				allRules.Rules = append(allRules.Rules, rules.Rules...)
+			}
+			return allRules
+		}
+
+		messages, err := YamlReadMessagesFromFile("../files/messages/messages_base_jsonpath.yaml")
+		So(err, ShouldBeNil)
+		data, err := ReadBinaryFile("../files/raw_json_data/any_all/json_raw_data_2containers_cpu2_mem2000.json")
+		So(err, ShouldBeNil)
+		var dataInterface interface{}
+		err = json.Unmarshal(data, &dataInterface)
+		So(err, ShouldBeNil)
+
+		messageBytes := messages.Messages[0]
+		messageBytes.RequestJsonRaw = &data
+		messageInterface := messages.Messages[0]
+		messageInterface.RequestRawInterface = &dataInterface
+		testMessages := []MessageAttributes{messageBytes, messageInterface}
+
+		expectedRules := readRules()
+		expectedResults := make([][]int, len(testMessages))
+		for i_message := range testMessages {
+			_, _, _, expectedResults[i_message], _, _, _ = Check(&testMessages[i_message], &expectedRules)
+		}
+		So(expectedResults[0], ShouldResemble, expectedResults[1])
+		So(expectedResults[0], ShouldContain, ALLOW)
+		So(expectedResults[0], ShouldContain, BLOCK)
+
+		rules := readRules() // not prepared. the goroutines race to prepare the rules on first use
+		var wg sync.WaitGroup
+		failures := make(chan string, concurrentCheckTestGoroutines*concurrentCheckTestRepetitions*3)
+		for g := 0; g < concurrentCheckTestGoroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				i_message := g % len(testMessages)
+				message := &testMessages[i_message] // the message is shared too
+				expected := fmt.Sprint(expectedResults[i_message])
+				for i := 0; i < concurrentCheckTestRepetitions; i++ {
+					_, _, _, results, _, _, _ := Check(message, &rules)
+					if fmt.Sprint(results) != expected {
+						failures <- fmt.Sprintf("Check: %v != %v", results, expected)
+					}
+					_, _, _, results, _, _, _ = CheckInParallel(message, &rules, 4)
+					if fmt.Sprint(results) != expected {
+						failures <- fmt.Sprintf("CheckInParallel: %v != %v", results, expected)
+					}
+					result, err := CheckWithContext(context.Background(), message, &rules, WithWorkers(8))
+					if err != nil || fmt.Sprint(result.Results) != expected {
+						failures <- fmt.Sprintf("CheckWithContext: %v != %v [%v]", result.Results, expected, err)
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+		close(failures)
+
+		failureMessages := []string{}
+		for failure := range failures {
+			failureMessages = append(failureMessages, failure)
+		}
+		So(failureMessages, ShouldBeEmpty)
+	})
+}
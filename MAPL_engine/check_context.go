@@ -0,0 +1,250 @@
+package MAPL_engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//--------------------------------------
+// CheckWithContext
+//--------------------------------------
+
+// Result is the structured result of checking a message against the rules
+type Result struct {
+	Decision            int                        `json:"decision"`
+	DecisionString      string                     `json:"decisionString"`
+	Outcome             Outcome                    `json:"outcome"`             // match, no-match or error
+	RelevantRuleIndex   int                        `json:"relevantRuleIndex"`   // the index of the rule that gave the decision (-1 if no rule applies)
+	Results             []int                      `json:"results"`             // the decision of each rule
+	AppliedRulesIndices []int                      `json:"appliedRulesIndices"` // the indices of the rules that apply to the message
+	RuleDescription     string                     `json:"ruleDescription"`
+	ExtraData           [][]map[string]interface{} `json:"extraData"`
+	Obligations         []Obligation               `json:"obligations,omitempty"`   // the obligations of the rule that gave the decision
+	Errors              []RuleError                `json:"errors,omitempty"`        // the errors found while evaluating the rules
+	Trace               *Trace                     `json:"trace,omitempty"`         // the trace of the evaluation (see WithTrace)
+	PolicyVersion       uint64                     `json:"policyVersion,omitempty"` // the version of the PolicySet that was used (see PolicyHolder)
+}
+
+// RuleError is an error found while evaluating one rule
+type RuleError struct {
+	RuleIndex int    `json:"ruleIndex"`
+	RuleID    string `json:"ruleID"`
+	Err       error  `json:"-"`
+}
+
+func (e RuleError) Error() string {
+	return fmt.Sprintf("rule %v [%v]: %v", e.RuleIndex, e.RuleID, e.Err)
+}
+
+func (e RuleError) Unwrap() error {
+	return e.Err
+}
+
+// FailMode sets the decision of a rule whose evaluation failed
+type FailMode int
+
+const (
+	FailOpen   FailMode = iota // the rule keeps the result of the evaluation (conditions that fail are false, as in Check)
+	FailClosed                 // the rule's decision is BLOCK (the same as WithErrorDecision("block"))
+)
+
+// CheckOption is an option of CheckWithContext
+type CheckOption func(*checkOptions)
+
+type checkOptions struct {
+	failMode           FailMode
+	workers            int
+	combiningAlgorithm CombiningAlgorithm
+	ignoreDecisionsErr bool // check with the built-in decisions if the user-defined decisions are not valid (as Check does)
+	trace              bool
+	batchWorkers       int
+	noMatchDecision    string
+	errorDecision      string
+	ignoreDefaultsErr  bool // check without the no-match and error decisions if they are not valid (as Check does)
+	clock              func() time.Time
+}
+
+func newCheckOptions(options []CheckOption) checkOptions {
+	opts := checkOptions{failMode: FailOpen}
+	for _, option := range options {
+		option(&opts)
+	}
+	return opts
+}
+
+// getCombiningAlgorithm gives the combining algorithm of the option or else of the rule set
+func (opts checkOptions) getCombiningAlgorithm(rules *Rules) CombiningAlgorithm {
+	if opts.combiningAlgorithm != "" {
+		return opts.combiningAlgorithm
+	}
+	return rules.CombiningAlgorithm
+}
+
+// getNoMatchDecision gives the no-match decision of the option or else of the rule set
+func (opts checkOptions) getNoMatchDecision(rules *Rules) string {
+	if opts.noMatchDecision != "" {
+		return opts.noMatchDecision
+	}
+	return rules.NoMatchDecision
+}
+
+// getErrorDecision gives the error decision of the options or else of the rule set (empty if the rules keep the result of the evaluation)
+func (opts checkOptions) getErrorDecision(rules *Rules) string {
+	if opts.errorDecision != "" {
+		return opts.errorDecision
+	}
+	if opts.failMode == FailClosed {
+		return DecisionNames[BLOCK]
+	}
+	return rules.ErrorDecision
+}
+
+// WithFailMode sets the decision of rules whose evaluation failed (FailOpen by default)
+func WithFailMode(failMode FailMode) CheckOption {
+	return func(o *checkOptions) {
+		o.failMode = failMode
+	}
+}
+
+// WithWorkers checks the rules with a pool of (at most) the given number of goroutines (one goroutine by default)
+func WithWorkers(workers int) CheckOption {
+	return func(o *checkOptions) {
+		o.workers = workers
+	}
+}
+
+// WithCombiningAlgorithm sets the algorithm that combines the decisions of the rules (instead of the rule set's combining algorithm)
+func WithCombiningAlgorithm(combiningAlgorithm CombiningAlgorithm) CheckOption {
+	return func(o *checkOptions) {
+		o.combiningAlgorithm = combiningAlgorithm
+	}
+}
+
+// WithNoMatchDecision sets the decision when no rule applies to the message (instead of the rule set's no-match decision)
+func WithNoMatchDecision(decision string) CheckOption {
+	return func(o *checkOptions) {
+		o.noMatchDecision = decision
+	}
+}
+
+// WithErrorDecision sets the decision of rules whose evaluation failed (instead of the rule set's error decision)
+func WithErrorDecision(decision string) CheckOption {
+	return func(o *checkOptions) {
+		o.errorDecision = decision
+	}
+}
+
+// CheckWithContext checks the message against the rules as Check does.
+// The errors found while evaluating the rules are reported per rule in the result instead of being logged.
+// If the context is cancelled the evaluation stops and the context's error is returned.
+func CheckWithContext(ctx context.Context, message *MessageAttributes, rules *Rules, options ...CheckOption) (Result, error) {
+
+	return cachedPolicySet(rules).CheckWithContext(ctx, message, options...)
+}
+
+func checkPolicySetWithContext(evalContext *EvalContext, message *MessageAttributes, p *PolicySet, opts checkOptions) (Result, error) {
+
+	if opts.clock != nil {
+		evalContext.Clock = opts.clock
+	}
+
+	combiningAlgorithm := opts.getCombiningAlgorithm(p.rules)
+	err := validateCombiningAlgorithm(combiningAlgorithm)
+	if err != nil {
+		return Result{}, err
+	}
+	if p.decisionsErr != nil && !opts.ignoreDecisionsErr {
+		return Result{}, p.decisionsErr
+	}
+	noMatchDecision, errorDecision, err := p.getNoMatchAndErrorDecisions(opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	rules := p.rules
+	N := len(rules.Rules)
+	var candidates []int
+	if opts.trace { // all the rules are traced (the index is only a pre-filter so the results are the same)
+		candidates = make([]int, N)
+		for i := range candidates {
+			candidates[i] = i
+		}
+	} else {
+		candidates = p.Candidates(message)
+	}
+
+	result := Result{
+		Results:   make([]int, N),
+		ExtraData: make([][]map[string]interface{}, N),
+		Errors:    []RuleError{},
+	}
+	for i := 0; i < N; i++ {
+		result.ExtraData[i] = []map[string]interface{}{}
+	}
+
+	ruleErrors := make([]error, N)
+	if opts.trace {
+		result.Trace = &Trace{Rules: make([]RuleTrace, N)}
+	}
+	if opts.workers > 1 && len(candidates) > 1 {
+		checkCandidatesInParallel(evalContext, message, p, candidates, opts.workers, &result, ruleErrors)
+	} else {
+		messageCopy := *message // the evaluation of ANY/ALL nodes sets the message's relative attributes
+		for _, in_i := range candidates {
+			if evalContext.Err() != nil {
+				break
+			}
+			result.Results[in_i], result.ExtraData[in_i], ruleErrors[in_i] = p.checkRule(evalContext, &messageCopy, in_i, result.Trace)
+		}
+	}
+	if err := evalContext.Err(); err != nil {
+		return Result{}, err
+	}
+
+	for i, err := range ruleErrors {
+		if err != nil {
+			result.Errors = append(result.Errors, RuleError{RuleIndex: i, RuleID: rules.Rules[i].RuleID, Err: err})
+			if errorDecision != -1 {
+				result.Results[i] = errorDecision
+			}
+		}
+	}
+
+	combineResults(&result, p, combiningAlgorithm)
+	setOutcome(&result, p, ruleErrors, noMatchDecision)
+	return result, nil
+}
+
+// checkCandidatesInParallel checks the candidate rules with a bounded pool of goroutines.
+// the rules are only read (they are prepared when the PolicySet is compiled) and each goroutine uses its own copy of the message
+// since the evaluation of ANY/ALL nodes sets the message's relative attributes.
+func checkCandidatesInParallel(evalContext *EvalContext, message *MessageAttributes, p *PolicySet, candidates []int, workers int, result *Result, ruleErrors []error) {
+
+	if workers > len(candidates) {
+		workers = len(candidates)
+	}
+
+	jobs := make(chan int, len(candidates))
+	for _, in_i := range candidates {
+		jobs <- in_i
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			messageCopy := *message
+			for in_i := range jobs {
+				if evalContext.Err() != nil {
+					return
+				}
+				result.Results[in_i], result.ExtraData[in_i], ruleErrors[in_i] = p.checkRule(evalContext, &messageCopy, in_i, result.Trace) // each goroutine writes other indices
+			}
+		}()
+	}
+	wg.Wait()
+}
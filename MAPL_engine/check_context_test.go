@@ -0,0 +1,212 @@
+package MAPL_engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"go.mongodb.org/mongo-driver/bson"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+const checkWithContextTestRules = `
+rules:
+  - ruleID: "0"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "*"
+    protocol: HTTP
+    resource:
+      resourceType: path
+      resourceName: "/*"
+    operation: GET
+    conditions:
+      conditionsTree:
+        attribute: encryptionVersion
+        method: GE
+        value: 1.3
+    decision: alert
+
+  - ruleID: "1"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "*"
+    protocol: HTTP
+    resource:
+      resourceType: path
+      resourceName: "/*"
+    operation: GET
+    decision: allow
+`
+
+const checkWithContextTestMessages = `
+messages:
+- message_id: 0
+  sender_service: A.my_namespace
+  receiver_service: B.my_namespace
+  request_protocol: HTTP
+  request_path: /book/123
+  request_method: GET
+  request_time: 2018-07-29T14:30:00-07:00
+
+- message_id: 1
+  sender_service: A.my_namespace
+  receiver_service: B.my_namespace
+  request_protocol: HTTP
+  request_path: /book/123
+  request_method: GET
+  request_time: 2018-07-29T14:30:00-07:00
+  encryption_type: TLS
+  encryption_version: 1.3
+`
+
+func TestCheckWithContext(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		rules, err := YamlReadRulesFromString(checkWithContextTestRules)
+		So(err, ShouldBeNil)
+		messages, err := YamlReadMessagesFromString(checkWithContextTestMessages)
+		So(err, ShouldBeNil)
+
+		str := "test that CheckWithContext gives the same results as Check"
+		fmt.Println(str)
+
+		for i_message := range messages.Messages {
+			message := messages.Messages[i_message]
+			decision, decisionString, relevantRuleIndex, results, appliedRulesIndices, ruleDescription, extraData := Check(&message, &rules)
+
+			result, err := CheckWithContext(context.Background(), &message, &rules)
+			So(err, ShouldBeNil)
+			So(result.Decision, ShouldEqual, decision)
+			So(result.DecisionString, ShouldEqual, decisionString)
+			So(result.RelevantRuleIndex, ShouldEqual, relevantRuleIndex)
+			So(result.Results, ShouldResemble, results)
+			So(result.AppliedRulesIndices, ShouldResemble, appliedRulesIndices)
+			So(result.RuleDescription, ShouldEqual, ruleDescription)
+			So(result.ExtraData, ShouldResemble, extraData)
+		}
+
+		str = "test the errors of the rules"
+		fmt.Println(str)
+
+		message := messages.Messages[0] // without encryptionVersion
+		result, err := CheckWithContext(context.Background(), &message, &rules)
+		So(err, ShouldBeNil)
+		So(result.Decision, ShouldEqual, ALLOW)
+		So(result.Errors, ShouldHaveLength, 1)
+		So(result.Errors[0].RuleIndex, ShouldEqual, 0)
+		So(result.Errors[0].RuleID, ShouldEqual, "0")
+		So(result.Errors[0].Err, ShouldNotBeNil)
+
+		message = messages.Messages[1]
+		result, err = CheckWithContext(context.Background(), &message, &rules)
+		So(err, ShouldBeNil)
+		So(result.Decision, ShouldEqual, ALERT)
+		So(result.Errors, ShouldBeEmpty)
+
+		str = "test fail-closed"
+		fmt.Println(str)
+
+		message = messages.Messages[0]
+		result, err = CheckWithContext(context.Background(), &message, &rules, WithFailMode(FailClosed))
+		So(err, ShouldBeNil)
+		So(result.Decision, ShouldEqual, BLOCK)
+		So(result.RelevantRuleIndex, ShouldEqual, 0)
+		So(result.Results, ShouldResemble, []int{BLOCK, ALLOW})
+		So(result.Errors, ShouldHaveLength, 1)
+
+		result, err = CheckWithContext(context.Background(), &message, &rules, WithFailMode(FailOpen))
+		So(err, ShouldBeNil)
+		So(result.Decision, ShouldEqual, ALLOW)
+
+		str = "test fail-closed with a jsonpath value that is not a number"
+		fmt.Println(str)
+
+		for _, testCase := range []struct {
+			method   string
+			decision int
+			errors   int
+		}{
+			{"EQ", DEFAULT, 0}, // EQ/NEQ/NE compare the strings
+			{"NEQ", ALLOW, 0},
+			{"NE", ALLOW, 0},
+			{"GT", BLOCK, 1},
+		} {
+			rulesWithJsonpath, err := YamlReadRulesFromString(fmt.Sprintf(`
+rules:
+  - ruleID: "0"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "*"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      attribute: "jsonpath:$.spec.replicas"
+      method: %v
+      value: 5
+    decision: allow`, testCase.method))
+			So(err, ShouldBeNil)
+			for _, messageWithData := range methodTestMessages(messages.Messages[0], `{"spec":{"replicas":"many"}}`) { // with the interface and with the bytes
+				result, err = CheckWithContext(context.Background(), messageWithData, &rulesWithJsonpath, WithFailMode(FailClosed))
+				So(err, ShouldBeNil)
+				So(result.Decision, ShouldEqual, testCase.decision)
+				So(result.Errors, ShouldHaveLength, testCase.errors)
+			}
+		}
+
+		str = "test cancellation"
+		fmt.Println(str)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = CheckWithContext(ctx, &message, &rules)
+		So(errors.Is(err, context.Canceled), ShouldBeTrue)
+
+		str = "test a node that doesn't implement ContextEvaluator"
+		fmt.Println(str)
+
+		for _, value := range []bool{true, false} {
+			and := And{Nodes: []Node{&True{}, &evalOnlyNode{value: value}}}
+			flag, _, err := and.EvalWithContext(NewEvalContext(context.Background()), &message) // the node is evaluated with Eval
+			So(err, ShouldBeNil)
+			So(flag, ShouldEqual, value)
+		}
+	})
+}
+
+// evalOnlyNode implements Node without EvalWithContext (as nodes implemented outside the package)
+type evalOnlyNode struct {
+	value bool
+}
+
+func (n *evalOnlyNode) Eval(message *MessageAttributes) (bool, []map[string]interface{}) {
+	return n.value, []map[string]interface{}{}
+}
+func (n *evalOnlyNode) Append(node Node) {}
+func (n *evalOnlyNode) PrepareAndValidate(stringsAndlists PredefinedStringsAndLists) error {
+	return nil
+}
+func (n *evalOnlyNode) String() string {
+	return fmt.Sprintf("<%v>", n.value)
+}
+func (n *evalOnlyNode) ToMongoQuery(base string, parentString string, inArrayCounter int) (bson.M, []bson.M, error) {
+	return bson.M{}, []bson.M{}, nil
+}
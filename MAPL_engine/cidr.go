@@ -0,0 +1,105 @@
+package MAPL_engine
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+//--------------------------------------
+// IP and CIDR Methods
+//--------------------------------------
+
+var ipMethods = []string{"IN_CIDR", "NIN_CIDR", "IS_PRIVATE_IP", "IS_PUBLIC_IP"}
+
+func isIPMethod(method string) bool {
+	method = strings.ToUpper(method)
+	for _, m := range ipMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCIDRList parses a CIDR, an IP or a comma separated list of them ("[10.0.0.0/8,192.168.0.0/16]"). an IP is a range of one address.
+func parseCIDRList(value string) ([]net.IPNet, error) {
+	list := strings.Replace(value, "[", "", -1)
+	list = strings.Replace(list, "]", "", -1)
+	list = strings.Replace(list, "\"", "", -1)
+	cidrs := []net.IPNet{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		isIP, isCIDR, ip, cidr := isIpCIDR(item)
+		switch {
+		case isCIDR:
+			cidrs = append(cidrs, cidr)
+		case isIP:
+			cidrs = append(cidrs, singleAddressCIDR(ip))
+		default:
+			return nil, fmt.Errorf("not an IP or CIDR [%v]", item)
+		}
+	}
+	return cidrs, nil
+}
+
+func singleAddressCIDR(ip net.IP) net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// cidrContains returns true if the range b is inside the range a
+func cidrContains(a, b net.IPNet) bool {
+	aOnes, aBits := a.Mask.Size()
+	bOnes, bBits := b.Mask.Size()
+	return aBits == bBits && aOnes <= bOnes && a.Contains(b.IP)
+}
+
+func cidrOverlaps(a, b net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// compareIPFunc compares the IPs (or CIDRs) of the attribute to the ranges of the condition. the attribute may be a list (of a jsonpath array):
+// IN_CIDR is true if every item is inside one of the ranges, NIN_CIDR is true if no item overlaps the ranges and IS_PRIVATE_IP (IS_PUBLIC_IP) is true
+// if every item is a private (public) IP. the methods are false if the attribute is not a list of IPs or CIDRs.
+func compareIPFunc(value1 string, method string, value2 []net.IPNet) bool { //value2 are the reference ranges from the rule
+	if len(value1) == 0 {
+		return false
+	}
+	items, err := parseCIDRList(value1)
+	if err != nil {
+		return false
+	}
+	for _, item := range items {
+		ok := false
+		switch strings.ToUpper(method) {
+		case "IN_CIDR":
+			for _, cidr := range value2 {
+				if cidrContains(cidr, item) {
+					ok = true
+					break
+				}
+			}
+		case "NIN_CIDR":
+			ok = true
+			for _, cidr := range value2 {
+				if cidrOverlaps(cidr, item) {
+					ok = false
+					break
+				}
+			}
+		case "IS_PRIVATE_IP":
+			ones, bits := item.Mask.Size()
+			ok = ones == bits && item.IP.IsPrivate()
+		case "IS_PUBLIC_IP":
+			ones, bits := item.Mask.Size()
+			ok = ones == bits && item.IP.IsGlobalUnicast() && !item.IP.IsPrivate()
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
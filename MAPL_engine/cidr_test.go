@@ -0,0 +1,91 @@
+package MAPL_engine
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+var ipMethodsTestCases = []conditionMethodTestCase{
+	{"jsonpath:$.status.podIP", "IN_CIDR", "10.0.0.0/8", true},
+	{"jsonpath:$.status.podIP", "IN_CIDR", "[192.168.0.0/16, 172.16.0.0/12]", false},
+	{"jsonpath:$.status.podIP", "NIN_CIDR", "192.168.0.0/16,172.16.0.0/12", true},
+	{"jsonpath:$.status.podIP", "IN_CIDR", "10.1.2.3", true},
+	{"jsonpath:$.status.podIP", "IN_CIDR", "#privateRanges", true},
+	{"jsonpath:$.status.podIP", "IS_PRIVATE_IP", "", true},
+	{"jsonpath:$.status.podIP", "IS_PUBLIC_IP", "", false},
+	{"jsonpath:$.status.hostIP", "is_public_ip", "", true},
+	{"jsonpath:$.status.hostIP", "NIN_CIDR", "#privateRanges", true},
+	{"jsonpath:$.status.podIPv6", "IN_CIDR", "fd00::/8", true},
+	{"jsonpath:$.status.podIPv6", "IN_CIDR", "10.0.0.0/8", false},
+	{"jsonpath:$.status.podIPv6", "IS_PRIVATE_IP", "", true},
+	{"jsonpath:$.spec.loadBalancerSourceRanges", "IN_CIDR", "10.0.0.0/8", true}, // every range is inside
+	{"jsonpath:$.spec.loadBalancerSourceRanges", "IN_CIDR", "10.0.0.0/16", false},
+	{"jsonpath:$.spec.loadBalancerSourceRanges", "NIN_CIDR", "10.0.0.0/16", false}, // a range overlaps
+	{"jsonpath:$.spec.loadBalancerSourceRanges", "NIN_CIDR", "0.0.0.0/0", false},
+	{"jsonpath:$.spec.loadBalancerSourceRanges", "IS_PRIVATE_IP", "", false}, // not IPs
+	{"jsonpath:$.loopbackIP", "IS_PRIVATE_IP", "", false},
+	{"jsonpath:$.loopbackIP", "IS_PUBLIC_IP", "", false},
+	{"jsonpath:$.metadata.name", "NIN_CIDR", "10.0.0.0/8", false}, // not an IP
+	{"jsonpath:$.missing", "NIN_CIDR", "10.0.0.0/8", false},
+	{"senderLabel[ip]", "IN_CIDR", "192.168.1.0/24", true},
+	{"receiverLabel[ip]", "IS_PUBLIC_IP", "", true},
+	{"requestUseragent", "IN_CIDR", "0.0.0.0/0", false},
+}
+
+func TestIPMethods(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test the ip and cidr methods"
+		fmt.Println(str)
+
+		messages := methodTestMessages(MessageAttributes{
+			SourceLabels:      map[string]string{"ip": "192.168.1.10"},
+			DestinationLabels: map[string]string{"ip": "2001:4860:4860::8888"},
+			RequestUseragent:  "curl",
+		}, `{"metadata":{"name":"a"},"loopbackIP":"127.0.0.1","spec":{"loadBalancerSourceRanges":["10.0.0.0/16","10.1.0.0/16"]},
+"status":{"podIP":"10.1.2.3","podIPv6":"fd12:3456::1","hostIP":"8.8.8.8"}}`)
+		stringsAndLists := PredefinedStringsAndLists{PredefinedListsWithoutRefs: map[string][]string{"privateRanges": {"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}}}
+		testConditionMethods(ipMethodsTestCases, stringsAndLists, messages)
+
+		str = "test the validation of the ip and cidr methods"
+		fmt.Println(str)
+
+		var c ConditionsTree
+		err := yaml.Unmarshal([]byte(`
+attribute: "jsonpath:$.status.podIP"
+method: IN_CIDR
+value: "#privateRanges"`), &c) // the predefined list is validated when the condition is prepared
+		So(err, ShouldBeNil)
+		err = c.ConditionsTree.PrepareAndValidate(PredefinedStringsAndLists{PredefinedListsWithoutRefs: map[string][]string{"privateRanges": {"10.0.0.0/8", "localhost"}}})
+		So(err, ShouldNotBeNil)
+
+		for _, invalid := range []Condition{
+			{Attribute: "jsonpath:$.status.podIP", Method: "IN_CIDR", Value: ""},
+			{Attribute: "jsonpath:$.status.podIP", Method: "IN_CIDR", Value: "10.0.0.0/33"},
+			{Attribute: "jsonpath:$.status.podIP", Method: "NIN_CIDR", Value: "[10.0.0.0/8,]"},
+			{Attribute: "jsonpath:$.status.podIP", Method: "NIN_CIDR", Value: "10.0.0.0/8,example.com"},
+			{Attribute: "payloadSize", Method: "IS_PUBLIC_IP"},
+		} {
+			_, err = ValidateOneCondition(&invalid)
+			So(err, ShouldNotBeNil)
+		}
+
+		str = "test the negation of the cidr methods"
+		fmt.Println(str)
+
+		c = normalizeTestConditionsTree(`
+NOT:
+  attribute: "jsonpath:$.status.podIP"
+  method: IN_CIDR
+  value: "10.0.0.0/8"`)
+		So(NormalizeWithNegatedMethods(c.ConditionsTree).String(), ShouldEqual, "<jsonpath:$.status.podIP-NIN_CIDR-10.0.0.0/8>")
+	})
+}
@@ -0,0 +1,116 @@
+package MAPL_engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+//--------------------------------------
+// Combining Algorithms
+//--------------------------------------
+
+// CombiningAlgorithm sets how the decisions of the rules that apply to a message are combined into one decision
+type CombiningAlgorithm string
+
+const (
+	MaxDecision     CombiningAlgorithm = "max-decision"     // the decision with the largest severity (DEFAULT < ALLOW < ALERT < BLOCK). the default
+	FirstApplicable CombiningAlgorithm = "first-applicable" // the decision of the first rule (by rule order) that applies
+	DenyOverrides   CombiningAlgorithm = "deny-overrides"   // a decision with the block effect if any. otherwise the decision with the largest severity
+	AllowOverrides  CombiningAlgorithm = "allow-overrides"  // a decision with the allow effect if any. otherwise the decision with the largest severity
+	MostSpecific    CombiningAlgorithm = "most-specific"    // the decision of the most specific rule (see ruleSpecificity). ties are broken by the largest severity
+)
+
+var supportedCombiningAlgorithms = []CombiningAlgorithm{MaxDecision, FirstApplicable, DenyOverrides, AllowOverrides, MostSpecific}
+
+func validateCombiningAlgorithm(combiningAlgorithm CombiningAlgorithm) error {
+	if combiningAlgorithm == "" {
+		return nil
+	}
+	for _, supported := range supportedCombiningAlgorithms {
+		if combiningAlgorithm == supported {
+			return nil
+		}
+	}
+	return fmt.Errorf("combining algorithm not supported [%v]", combiningAlgorithm)
+}
+
+// combineResults sets the decision of the result from the rules' results with the combining algorithm
+func combineResults(result *Result, p *PolicySet, combiningAlgorithm CombiningAlgorithm) {
+
+	result.AppliedRulesIndices = make([]int, 0)
+	result.RelevantRuleIndex = -1
+	result.RuleDescription = ""
+	result.Obligations = []Obligation{}
+
+	for i, decision := range result.Results {
+		if decision == DEFAULT {
+			continue
+		}
+		result.AppliedRulesIndices = append(result.AppliedRulesIndices, i)
+		if result.RelevantRuleIndex == -1 || overrides(i, result.RelevantRuleIndex, result.Results, p, combiningAlgorithm) {
+			result.RelevantRuleIndex = i
+		}
+	}
+
+	result.Decision = DEFAULT
+	if result.RelevantRuleIndex >= 0 {
+		result.Decision = result.Results[result.RelevantRuleIndex]
+		result.RuleDescription = p.rules.Rules[result.RelevantRuleIndex].Metadata["description"]
+		result.Obligations = append(result.Obligations, p.rules.Rules[result.RelevantRuleIndex].Obligations...)
+	}
+	result.DecisionString = p.decisions.names[result.Decision]
+}
+
+// overrides tests if the decision of rule i overrides the decision of rule j (j < i)
+func overrides(i, j int, results []int, p *PolicySet, combiningAlgorithm CombiningAlgorithm) bool {
+
+	effect_i, effect_j := p.decisions.effect[results[i]], p.decisions.effect[results[j]]
+	switch combiningAlgorithm {
+	case FirstApplicable:
+		return false
+	case DenyOverrides:
+		if effect_i == BLOCK || effect_j == BLOCK {
+			if effect_i != effect_j {
+				return effect_j != BLOCK
+			}
+		}
+	case AllowOverrides:
+		if effect_i == ALLOW || effect_j == ALLOW {
+			if effect_i != effect_j {
+				return effect_j != ALLOW
+			}
+		}
+	case MostSpecific:
+		if p.specificity[i] != p.specificity[j] {
+			return p.specificity[i] > p.specificity[j]
+		}
+	}
+	return p.decisions.severity[results[i]] > p.decisions.severity[results[j]]
+}
+
+// ruleSpecificity scores how specific the sender, receiver and resource of the rule are.
+// each one scores 0 for "*", 1 for lists, wildcards and subnets and 2 for a single literal name (including a literal path such as "/book/123").
+func ruleSpecificity(rule *Rule) int {
+	specificity := nameSpecificity(rule.Sender.SenderName, rule.Sender.SenderType) + nameSpecificity(rule.Receiver.ReceiverName, rule.Receiver.ReceiverType)
+	if rule.Protocol != "*" {
+		specificity += nameSpecificity(rule.Resource.ResourceName, rule.Resource.ResourceType)
+	}
+	return specificity
+}
+
+func nameSpecificity(name, nameType string) int {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "" || name == "*":
+		return 0
+	case nameType == "subnet":
+		return 1
+	case isLiteralName(name) && !strings.ContainsAny(name, ",#"):
+		if _, isCIDR, _, _ := isIpCIDR(name); isCIDR { // a range of addresses
+			return 1
+		}
+		return 2
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,189 @@
+package MAPL_engine
+
+import (
+	"context"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+const combiningTestRules = `
+rules:
+  - ruleID: "broad-alert"
+    sender:
+      senderName: "*"
+      senderType: "*"
+    receiver:
+      receiverName: "*"
+      receiverType: "*"
+    protocol: http
+    resource:
+      resourceType: path
+      resourceName: "/*"
+    operation: "*"
+    decision: alert
+
+  - ruleID: "explicit-allow"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "*"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "*"
+    protocol: http
+    resource:
+      resourceType: path
+      resourceName: "/book/*"
+    operation: GET
+    decision: allow
+
+  - ruleID: "receiver-block"
+    sender:
+      senderName: "*"
+      senderType: "*"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "*"
+    protocol: http
+    resource:
+      resourceType: path
+      resourceName: "/*"
+    operation: "*"
+    decision: block
+`
+
+const combiningTestMessages = `
+messages:
+- message_id: 0
+  sender_service: A.my_namespace
+  receiver_service: B.my_namespace
+  request_protocol: HTTP
+  request_path: /book/123
+  request_method: GET
+  request_time: 2018-07-29T14:30:00-07:00
+- message_id: 1
+  sender_service: A.my_namespace
+  receiver_service: C.my_namespace
+  request_protocol: HTTP
+  request_path: /book/123
+  request_method: GET
+  request_time: 2018-07-29T14:30:00-07:00
+`
+
+func TestCombiningAlgorithms(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		rules, err := YamlReadRulesFromString(combiningTestRules)
+		So(err, ShouldBeNil)
+		messages, err := YamlReadMessagesFromString(combiningTestMessages)
+		So(err, ShouldBeNil)
+		message := messages.Messages[0]
+
+		str := "test the combining algorithms with the Check API"
+		fmt.Println(str)
+
+		expected := []struct {
+			combiningAlgorithm CombiningAlgorithm
+			decision           int
+			relevantRuleIndex  int
+		}{
+			{"", BLOCK, 2},
+			{MaxDecision, BLOCK, 2},
+			{FirstApplicable, ALERT, 0},
+			{DenyOverrides, BLOCK, 2},
+			{AllowOverrides, ALLOW, 1},
+			{MostSpecific, ALLOW, 1},
+		}
+		for _, e := range expected {
+			result, err := CheckWithContext(context.Background(), &message, &rules, WithCombiningAlgorithm(e.combiningAlgorithm))
+			So(err, ShouldBeNil)
+			So(result.Decision, ShouldEqual, e.decision)
+			So(result.RelevantRuleIndex, ShouldEqual, e.relevantRuleIndex)
+			So(result.AppliedRulesIndices, ShouldResemble, []int{0, 1, 2})
+		}
+
+		// only the broad rule applies:
+		message2 := messages.Messages[1]
+		for _, combiningAlgorithm := range supportedCombiningAlgorithms {
+			result, err := CheckWithContext(context.Background(), &message2, &rules, WithCombiningAlgorithm(combiningAlgorithm))
+			So(err, ShouldBeNil)
+			So(result.Decision, ShouldEqual, ALERT)
+			So(result.RelevantRuleIndex, ShouldEqual, 0)
+		}
+
+		_, err = CheckWithContext(context.Background(), &message, &rules, WithCombiningAlgorithm("no-such-algorithm"))
+		So(err, ShouldNotBeNil)
+
+		str = "test the combining algorithm of the rules yaml header"
+		fmt.Println(str)
+
+		rules, err = YamlReadRulesFromString("combiningAlgorithm: allow-overrides\n" + combiningTestRules)
+		So(err, ShouldBeNil)
+		So(rules.CombiningAlgorithm, ShouldEqual, AllowOverrides)
+
+		decision, _, relevantRuleIndex, _, _, _, _ := Check(&message, &rules)
+		So(decision, ShouldEqual, ALLOW)
+		So(relevantRuleIndex, ShouldEqual, 1)
+
+		result, err := CheckWithContext(context.Background(), &message, &rules, WithCombiningAlgorithm(FirstApplicable)) // the option overrides the header
+		So(err, ShouldBeNil)
+		So(result.Decision, ShouldEqual, ALERT)
+
+		_, err = YamlReadRulesFromString("combiningAlgorithm: no-such-algorithm\n" + combiningTestRules)
+		So(err, ShouldNotBeNil)
+
+		str = "test the specificity of rules"
+		fmt.Println(str)
+
+		So(nameSpecificity("*", "*"), ShouldEqual, 0)
+		So(nameSpecificity("A.*", "workload"), ShouldEqual, 1)
+		So(nameSpecificity("A.my_namespace,B.my_namespace", "*"), ShouldEqual, 1)
+		So(nameSpecificity("10.0.0.0/8", "subnet"), ShouldEqual, 1)
+		So(nameSpecificity("10.0.0.0/8", "*"), ShouldEqual, 1)
+		So(nameSpecificity("10.0.0.1", "subnet"), ShouldEqual, 1)
+		So(nameSpecificity("A.my_namespace", "workload"), ShouldEqual, 2)
+		So(nameSpecificity("/book/123", "path"), ShouldEqual, 2)
+		So(nameSpecificity("/book/*", "path"), ShouldEqual, 1)
+
+		rules, err = YamlReadRulesFromString(`
+combiningAlgorithm: most-specific
+rules:
+  - ruleID: "path-allow"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "*"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "*"
+    protocol: http
+    resource:
+      resourceType: path
+      resourceName: "/book/123"
+    operation: GET
+    decision: allow
+
+  - ruleID: "wildcard-path-block"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "*"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "*"
+    protocol: http
+    resource:
+      resourceType: path
+      resourceName: "/book/*"
+    operation: GET
+    decision: block`)
+		So(err, ShouldBeNil)
+		decision, _, relevantRuleIndex, _, _, _, _ = Check(&message, &rules)
+		So(decision, ShouldEqual, ALLOW) // the literal path is more specific than the wildcard path
+		So(relevantRuleIndex, ShouldEqual, 0)
+	})
+}
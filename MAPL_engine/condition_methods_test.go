@@ -0,0 +1,60 @@
+package MAPL_engine
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+//--------------------------------------
+// helpers of the tests of the condition methods
+//--------------------------------------
+
+// conditionMethodTestCase is a condition and the expected result of its evaluation
+type conditionMethodTestCase struct {
+	attribute string
+	method    string
+	value     string
+	expected  bool
+}
+
+// methodTestMessages returns the message with the raw data (as bytes and as an interface) and a copy of it with the bytes only
+func methodTestMessages(message MessageAttributes, data string) []*MessageAttributes {
+	dataBytes := []byte(data)
+	var dataInterface interface{}
+	err := json.Unmarshal(dataBytes, &dataInterface)
+	So(err, ShouldBeNil)
+	message.RequestJsonRaw = &dataBytes
+	message.RequestRawInterface = &dataInterface
+	messageWithBytes := message
+	messageWithBytes.RequestRawInterface = nil
+	return []*MessageAttributes{&message, &messageWithBytes}
+}
+
+// testConditionMethods prepares the condition of every test case and tests its result on every message
+func testConditionMethods(testCases []conditionMethodTestCase, stringsAndLists PredefinedStringsAndLists, messages []*MessageAttributes) {
+	for _, testCase := range testCases {
+		c := Condition{Attribute: testCase.attribute, Method: testCase.method, Value: testCase.value}
+		err := c.PrepareAndValidate(stringsAndLists)
+		So(err, ShouldBeNil)
+		testEvalOnMessages(&c, testCase.expected, messages)
+	}
+}
+
+// testConditionMethodsStrings tests that the string of every prepared condition has its original method and value
+func testConditionMethodsStrings(testCases []conditionMethodTestCase) {
+	for _, testCase := range testCases {
+		c := Condition{Attribute: testCase.attribute, Method: testCase.method, Value: testCase.value}
+		err := c.PrepareAndValidate(PredefinedStringsAndLists{})
+		So(err, ShouldBeNil)
+		So(c.String(), ShouldEqual, fmt.Sprintf("<%v-%v-%v>", testCase.attribute, testCase.method, testCase.value))
+	}
+}
+
+// testEvalOnMessages tests the result of the evaluation of the (prepared) node on every message
+func testEvalOnMessages(node Node, expected bool, messages []*MessageAttributes) {
+	for _, message := range messages {
+		flag, _ := node.Eval(message)
+		So(flag, ShouldEqual, expected)
+	}
+}
@@ -0,0 +1,386 @@
+package MAPL_engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//--------------------------------------
+// Static Analysis of Conditions Trees
+//--------------------------------------
+
+// ValidationWarning reports a subtree of the conditions that is valid but probably not what the author meant
+type ValidationWarning struct {
+	Path    string `json:"path"`    // the position of the subtree in the conditions tree (for example conditions.AND[1].NOT)
+	Node    string `json:"node"`    // the string of the subtree
+	Message string `json:"message"` // why the subtree is suspicious
+}
+
+func (w ValidationWarning) String() string {
+	return fmt.Sprintf("%v: %v [%v]", w.Path, w.Message, w.Node)
+}
+
+// the result of the static analysis of a subtree
+type analysisResult int
+
+const (
+	analysisUnknown analysisResult = iota
+	analysisNever                  // the subtree can never be satisfied
+	analysisAlways                 // the subtree is always satisfied
+)
+
+// AnalyzeConditions reports the subtrees of a (prepared) conditions tree that can never be satisfied or that are always satisfied.
+// The analysis is conservative: it reasons about the jsonpath conditions that are ANDed (or ORed) together in the same scope (numeric ranges,
+// equality sets, regex literals and existence of the attribute) and about TRUE/FALSE nodes. Only the top-most subtree that causes the problem is reported.
+// Attributes that may have more than one value (wildcards, filters and deep scans) are not analyzed.
+func AnalyzeConditions(node Node) []ValidationWarning {
+	warnings := []ValidationWarning{}
+	analyzeNode(node, "conditions", &warnings)
+	return warnings
+}
+
+func analyzeNode(node Node, path string, warnings *[]ValidationWarning) analysisResult {
+
+	switch n := node.(type) {
+	case True, *True:
+		return analysisAlways
+	case False, *False:
+		return analysisNever
+	case *Condition:
+		switch n.Attribute {
+		case "true", "TRUE":
+			return analysisAlways
+		case "false", "FALSE":
+			return analysisNever
+		}
+		return analysisUnknown
+	case *Not:
+		switch analyzeNode(n.Node, path+".NOT", warnings) {
+		case analysisNever:
+			return analysisAlways
+		case analysisAlways:
+			return analysisNever
+		}
+		return analysisUnknown
+	case *And:
+		results := analyzeNodes("AND", n.Nodes, path, warnings)
+		if hasResult(results, analysisNever) {
+			return analysisNever // already reported
+		}
+		if message, ok := findContradiction(n.Nodes); ok {
+			*warnings = append(*warnings, ValidationWarning{Path: path, Node: n.String(), Message: message})
+			return analysisNever
+		}
+		if len(results) > 0 && allResults(results, analysisAlways) {
+			return analysisAlways
+		}
+		return analysisUnknown
+	case *Or:
+		results := analyzeNodes("OR", n.Nodes, path, warnings)
+		if hasResult(results, analysisAlways) {
+			return analysisAlways // already reported
+		}
+		if message, ok := findTautology(n.Nodes); ok {
+			*warnings = append(*warnings, ValidationWarning{Path: path, Node: n.String(), Message: message})
+			return analysisAlways
+		}
+		if len(results) > 0 && allResults(results, analysisNever) {
+			return analysisNever
+		}
+		return analysisUnknown
+	case *Any:
+		if analyzeNode(n.Node, path+".ANY", warnings) == analysisNever {
+			return analysisNever // no element can match
+		}
+		return analysisUnknown
+	case *All: // ALL is true on an empty array and ANY is false on an empty array so only the result above is certain
+		analyzeNode(n.Node, path+".ALL", warnings)
+		return analysisUnknown
+	case *Count:
+		analyzeNode(n.Node, path+".COUNT", warnings)
+		return analysisUnknown
+	case *AtLeast:
+		analyzeNodes("AT_LEAST", n.Nodes, path, warnings)
+		return analysisUnknown
+	case *AtMost:
+		analyzeNodes("AT_MOST", n.Nodes, path, warnings)
+		return analysisUnknown
+	case *Exactly:
+		analyzeNodes("EXACTLY", n.Nodes, path, warnings)
+		return analysisUnknown
+	case *Xor:
+		analyzeNodes("XOR", n.Nodes, path, warnings)
+		return analysisUnknown
+	case *Ref:
+		if n.Node == nil {
+			return analysisUnknown
+		}
+		return analyzeNode(n.Node, path+".REF", warnings)
+	default:
+		return analysisUnknown
+	}
+}
+
+func analyzeNodes(nodeType string, nodes []Node, path string, warnings *[]ValidationWarning) []analysisResult {
+	results := make([]analysisResult, len(nodes))
+	for i, node := range nodes {
+		results[i] = analyzeNode(node, fmt.Sprintf("%v.%v[%v]", path, nodeType, i), warnings)
+	}
+	return results
+}
+
+func hasResult(results []analysisResult, result analysisResult) bool {
+	for _, r := range results {
+		if r == result {
+			return true
+		}
+	}
+	return false
+}
+
+func allResults(results []analysisResult, result analysisResult) bool {
+	for _, r := range results {
+		if r != result {
+			return false
+		}
+	}
+	return true
+}
+
+// groupConditionsByAttribute returns the single-valued jsonpath conditions (of the AND/OR node and of nested nodes of the same type) grouped by their attribute
+func groupConditionsByAttribute(nodes []Node, flatten func(Node) []Node) ([]string, map[string][]*Condition) {
+	attributes := []string{}
+	groups := map[string][]*Condition{}
+	for _, node := range nodes {
+		subNodes := flatten(node)
+		if subNodes != nil {
+			subAttributes, subGroups := groupConditionsByAttribute(subNodes, flatten)
+			for _, attribute := range subAttributes {
+				if _, ok := groups[attribute]; !ok {
+					attributes = append(attributes, attribute)
+				}
+				groups[attribute] = append(groups[attribute], subGroups[attribute]...)
+			}
+			continue
+		}
+		c, ok := node.(*Condition)
+		if !ok {
+			continue
+		}
+		attribute, ok := singleValuedJsonpathAttribute(c)
+		if !ok {
+			continue
+		}
+		if _, ok := groups[attribute]; !ok {
+			attributes = append(attributes, attribute)
+		}
+		groups[attribute] = append(groups[attribute], c)
+	}
+	return attributes, groups
+}
+
+// singleValuedJsonpathAttribute returns the attribute of a jsonpath condition unless it may have more than one value (wildcards, filters and deep scans).
+// conditions that compare the attribute to another field (a jsonpath value) are not analyzed
+func singleValuedJsonpathAttribute(c *Condition) (string, bool) {
+	if !c.AttributeIsJsonpath || c.ValueIsJsonpath || strings.Contains(c.AttributeJsonpathQuery, "[") || strings.Contains(c.AttributeJsonpathQuery, "..") {
+		return "", false
+	}
+	if len(c.OriginalAttribute) == 0 {
+		return c.Attribute, true
+	}
+	return c.OriginalAttribute, true
+}
+
+// findContradiction looks for an attribute whose ANDed conditions can't be satisfied together
+func findContradiction(nodes []Node) (string, bool) {
+
+	flattenAnd := func(node Node) []Node {
+		if a, ok := node.(*And); ok {
+			return a.Nodes
+		}
+		return nil
+	}
+	attributes, groups := groupConditionsByAttribute(nodes, flattenAnd)
+	for _, attribute := range attributes {
+		conditions := groups[attribute]
+
+		// existence: every method except NEX is false on a missing attribute (the type and length methods may be true together with NEX on null or empty values)
+		nex := false
+		exists := false
+		for _, c := range conditions {
+			if strings.ToUpper(c.Method) == "NEX" {
+				nex = true
+			} else if !isTypeMethod(c.Method) && !isLengthMethod(c.Method) {
+				exists = true
+			}
+		}
+		if nex && exists {
+			return fmt.Sprintf("[%v] is required both to exist and not to exist", attribute), true
+		}
+		if nex {
+			continue
+		}
+
+		// equality sets: the values allowed by EQ/IN must satisfy the rest of the conditions
+		if candidates, ok := candidateValues(conditions); ok {
+			satisfiable := false
+			for _, v := range candidates {
+				if satisfiesAll(v, conditions) {
+					satisfiable = true
+					break
+				}
+			}
+			if !satisfiable {
+				return fmt.Sprintf("no value of [%v] satisfies all of its conditions", attribute), true
+			}
+			continue
+		}
+
+		// numeric ranges
+		if emptyRange(conditions) {
+			return fmt.Sprintf("the range of [%v] is empty", attribute), true
+		}
+	}
+	return "", false
+}
+
+// findTautology looks for an attribute that is ORed with both EX and NEX
+func findTautology(nodes []Node) (string, bool) {
+
+	flattenOr := func(node Node) []Node {
+		if o, ok := node.(*Or); ok {
+			return o.Nodes
+		}
+		return nil
+	}
+	attributes, groups := groupConditionsByAttribute(nodes, flattenOr)
+	for _, attribute := range attributes {
+		ex := false
+		nex := false
+		for _, c := range groups[attribute] {
+			switch strings.ToUpper(c.Method) {
+			case "EX":
+				ex = true
+			case "NEX":
+				nex = true
+			}
+		}
+		if ex && nex {
+			return fmt.Sprintf("[%v] either exists or not", attribute), true
+		}
+	}
+	return "", false
+}
+
+// candidateValues returns the values allowed by the first EQ (or IN) condition
+func candidateValues(conditions []*Condition) ([]string, bool) {
+	for _, c := range conditions {
+		method := strings.ToUpper(c.Method)
+		originalMethod := strings.ToUpper(c.OriginalMethod)
+		if method == "EQ" {
+			return []string{c.Value}, true
+		}
+		if originalMethod == "IN" || originalMethod == "IS" { // IN lists are converted to regular expressions when the condition is prepared
+			list := strings.Replace(c.OriginalValue, "[", "", -1)
+			list = strings.Replace(list, "]", "", -1)
+			return strings.Split(list, ","), true
+		}
+	}
+	return nil, false
+}
+
+func satisfiesAll(value string, conditions []*Condition) bool {
+	for _, c := range conditions {
+		if !satisfies(value, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// satisfies returns false only if the condition is certainly false for the value
+func satisfies(value string, c *Condition) bool {
+	valueFloat, isNumber := parseNumberWithUnits(value)
+	switch strings.ToUpper(c.Method) {
+	case "EQ":
+		if isNumber && c.ValueFloat != nil {
+			return valueFloat == *c.ValueFloat
+		}
+		return value == c.Value
+	case "NEQ", "NE":
+		if isNumber && c.ValueFloat != nil {
+			return valueFloat != *c.ValueFloat
+		}
+		return value != c.Value
+	case "GT", "GE", "LT", "LE":
+		if c.ValueFloat == nil {
+			return true
+		}
+		return isNumber && compareFloatFunc(valueFloat, strings.ToUpper(c.Method), c.ValueFloat)
+	case "RE":
+		return c.ValueRegex == nil || c.ValueRegex.MatchString(value)
+	case "NRE":
+		return c.ValueRegex == nil || !c.ValueRegex.MatchString(value)
+	case "SEMVER_LT", "SEMVER_LE", "SEMVER_GT", "SEMVER_GE", "SEMVER_EQ", "SEMVER_IN_RANGE":
+		return c.ValueSemverRange == nil || compareSemverFunc(value, c.ValueSemverRange)
+	case "IN_CIDR", "NIN_CIDR", "IS_PRIVATE_IP", "IS_PUBLIC_IP":
+		return compareIPFunc(value, c.Method, c.ValueCIDRs)
+	case "NEX":
+		return false
+	default:
+		return true
+	}
+}
+
+// emptyRange returns true if the numeric bounds of the conditions (GT/GE/LT/LE and NEQ) leave no value
+func emptyRange(conditions []*Condition) bool {
+	var lower, upper *float64
+	lowerInclusive, upperInclusive := false, false
+	for _, c := range conditions {
+		if c.ValueFloat == nil {
+			continue
+		}
+		v := *c.ValueFloat
+		switch strings.ToUpper(c.Method) {
+		case "GT", "GE":
+			inclusive := strings.ToUpper(c.Method) == "GE"
+			if lower == nil || v > *lower || (v == *lower && !inclusive) {
+				lower, lowerInclusive = &v, inclusive
+			}
+		case "LT", "LE":
+			inclusive := strings.ToUpper(c.Method) == "LE"
+			if upper == nil || v < *upper || (v == *upper && !inclusive) {
+				upper, upperInclusive = &v, inclusive
+			}
+		}
+	}
+	if lower == nil || upper == nil {
+		return false
+	}
+	if *lower > *upper {
+		return true
+	}
+	if *lower < *upper {
+		return false
+	}
+	if !lowerInclusive || !upperInclusive {
+		return true
+	}
+	for _, c := range conditions { // a single value is left
+		method := strings.ToUpper(c.Method)
+		if (method == "NEQ" || method == "NE") && c.ValueFloat != nil && *c.ValueFloat == *lower {
+			return true
+		}
+	}
+	return false
+}
+
+func parseNumberWithUnits(value string) (float64, bool) {
+	valueWithoutUnits, factor := convertStringWithUnits(value)
+	valueFloat, err := strconv.ParseFloat(valueWithoutUnits, 64)
+	if err != nil {
+		return 0, false
+	}
+	return valueFloat * factor, true
+}
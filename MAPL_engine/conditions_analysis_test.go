@@ -0,0 +1,208 @@
+package MAPL_engine
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+var conditionsAnalysisTestCases = []struct {
+	conditions string
+	paths      []string // the paths of the expected warnings
+}{
+	{ // numeric range
+		conditions: `
+AND:
+- attribute: "jsonpath:$.spec.replicas"
+  method: GT
+  value: 5
+- attribute: "jsonpath:$.spec.replicas"
+  method: LT
+  value: 3`,
+		paths: []string{"conditions"},
+	},
+	{ // a single value is excluded
+		conditions: `
+AND:
+- attribute: "jsonpath:$.spec.replicas"
+  method: GE
+  value: 3
+- attribute: "jsonpath:$.spec.replicas"
+  method: LE
+  value: 3
+- attribute: "jsonpath:$.spec.replicas"
+  method: NEQ
+  value: 3`,
+		paths: []string{"conditions"},
+	},
+	{ // existence (in a nested AND node)
+		conditions: `
+OR:
+- attribute: "jsonpath:$.kind"
+  method: EQ
+  value: "Pod"
+- AND:
+  - attribute: "jsonpath:$.metadata.labels.app"
+    method: EX
+  - AND:
+    - attribute: "jsonpath:$.metadata.labels.app"
+      method: NEX`,
+		paths: []string{"conditions.OR[1]"},
+	},
+	{ // equality sets
+		conditions: `
+AND:
+- attribute: "jsonpath:$.kind"
+  method: IN
+  value: "[Pod,Deployment]"
+- attribute: "jsonpath:$.kind"
+  method: NIN
+  value: "[Pod,Deployment,DaemonSet]"`,
+		paths: []string{"conditions"},
+	},
+	{ // regex literal and number units
+		conditions: `
+NOT:
+  ANY:
+    parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+    AND:
+    - attribute: "jsonpath:$RELATIVE.image"
+      method: EQ
+      value: "nginx"
+    - attribute: "jsonpath:$RELATIVE.image"
+      method: RE
+      value: "^busybox"
+    - attribute: "jsonpath:$RELATIVE.resources.limits.memory"
+      method: EQ
+      value: 1Gi
+    - attribute: "jsonpath:$RELATIVE.resources.limits.memory"
+      method: GT
+      value: 2Gi`,
+		paths: []string{"conditions.NOT.ANY"},
+	},
+	{ // tautology
+		conditions: `
+AND:
+- attribute: "jsonpath:$.kind"
+  method: EQ
+  value: "Pod"
+- OR:
+  - attribute: "jsonpath:$.metadata.labels.app"
+    method: EX
+  - attribute: "jsonpath:$.metadata.labels.app"
+    method: NEX
+- NOT:
+    OR:
+    - attribute: "jsonpath:$.metadata.name"
+      method: NEX
+    - attribute: "jsonpath:$.metadata.name"
+      method: EX`,
+		paths: []string{"conditions.AND[1]", "conditions.AND[2].NOT"},
+	},
+	{ // satisfiable conditions
+		conditions: `
+AND:
+- attribute: "jsonpath:$.spec.replicas"
+  method: GE
+  value: 3
+- attribute: "jsonpath:$.spec.replicas"
+  method: LE
+  value: 3
+- attribute: "jsonpath:$.kind"
+  method: EQ
+  value: "Pod"
+- attribute: "jsonpath:$.kind"
+  method: RE
+  value: "^P"
+- attribute: "jsonpath:$.kind"
+  method: NEQ
+  value: "Deployment"
+- attribute: "jsonpath:$.metadata.labels.app"
+  method: NEX
+- OR:
+  - attribute: "jsonpath:$.spec.replicas"
+    method: LT
+    value: 3
+  - attribute: "jsonpath:$.spec.replicas"
+    method: GE
+    value: 3
+  - attribute: "jsonpath:$.metadata.name"
+    method: NEX`,
+		paths: []string{},
+	},
+	{ // deep scans and different scopes are not analyzed
+		conditions: `
+AND:
+- attribute: "jsonpath:$..image"
+  method: EQ
+  value: "nginx"
+- attribute: "jsonpath:$..image"
+  method: EQ
+  value: "busybox"
+- ANY:
+    parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+    condition:
+      attribute: "jsonpath:$RELATIVE.image"
+      method: EQ
+      value: "nginx"
+- ANY:
+    parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+    condition:
+      attribute: "jsonpath:$RELATIVE.image"
+      method: EQ
+      value: "busybox"`,
+		paths: []string{},
+	},
+}
+
+func TestConditionsAnalysis(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test the detection of contradictions and tautologies"
+		fmt.Println(str)
+
+		for _, testCase := range conditionsAnalysisTestCases {
+			c := normalizeTestConditionsTree(testCase.conditions)
+			originalString := c.ConditionsTree.String()
+
+			warnings, err := ValidateRuleWithWarnings(&Rule{Conditions: c})
+			So(err, ShouldBeNil)
+			paths := []string{}
+			for _, warning := range warnings {
+				paths = append(paths, warning.Path)
+				So(len(warning.Message), ShouldBeGreaterThan, 0)
+			}
+			So(paths, ShouldResemble, testCase.paths)
+			So(c.ConditionsTree.String(), ShouldEqual, originalString) // the rule is not changed
+		}
+
+		warnings, err := ValidateRuleWithWarnings(&Rule{Conditions: normalizeTestConditionsTree(conditionsAnalysisTestCases[0].conditions)})
+		So(err, ShouldBeNil)
+		So(warnings[0].String(), ShouldEqual, "conditions: the range of [jsonpath:$.spec.replicas] is empty [(<jsonpath:$.spec.replicas-GT-5> && <jsonpath:$.spec.replicas-LT-3>)]")
+
+		str = "test TRUE/FALSE nodes"
+		fmt.Println(str)
+
+		So(AnalyzeConditions(&And{Nodes: []Node{True{}, False{}}}), ShouldBeEmpty) // explicit TRUE/FALSE nodes are not reported
+		contradiction := normalizeTestConditionsTree(conditionsAnalysisTestCases[0].conditions).ConditionsTree
+		err = contradiction.PrepareAndValidate(PredefinedStringsAndLists{})
+		So(err, ShouldBeNil)
+		warnings = AnalyzeConditions(&Or{Nodes: []Node{False{}, &Not{Node: contradiction}}})
+		So(warnings, ShouldHaveLength, 1)
+		So(warnings[0].Path, ShouldEqual, "conditions.OR[1].NOT")
+
+		str = "test invalid rules"
+		fmt.Println(str)
+
+		_, err = ValidateRuleWithWarnings(&Rule{Conditions: ConditionsTree{ConditionsTree: &Condition{Attribute: "jsonpath:$.a", Method: "RE", Value: "("}}})
+		So(err, ShouldNotBeNil)
+		err = ValidateRule(&Rule{Conditions: ConditionsTree{ConditionsTree: &Condition{Attribute: "jsonpath:$.a", Method: "RE", Value: "("}}})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -1,6 +1,7 @@
 package MAPL_engine
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,8 +9,12 @@ import (
 	"github.com/yalp/jsonpath"
 	"go.mongodb.org/mongo-driver/bson"
 	dc "gopkg.in/getlantern/deepcopy.v1"
+	"gopkg.in/yaml.v2"
+	"log"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 //-----------------------
@@ -36,6 +41,14 @@ func (c *ConditionsTree) UnmarshalYAML(unmarshal func(interface{}) error) error
 
 }
 
+// MarshalYAML returns the conditions tree in the syntax of the rules files (without the "conditionsTree" key) so that it can be read back by UnmarshalYAML
+func (c ConditionsTree) MarshalYAML() (interface{}, error) {
+	if m, ok := c.ConditionsTree.(yaml.Marshaler); ok {
+		return m.MarshalYAML() // the yaml encoder doesn't call the marshaller of the returned (pointer) node
+	}
+	return c.ConditionsTree, nil
+}
+
 func (c *ConditionsTree) UnmarshalJSON(data []byte) error {
 
 	if len(data) == 2 {
@@ -105,6 +118,12 @@ type Node interface {
 	ToMongoQuery(base string, parentString string, inArrayCounter int) (bson.M, []bson.M, error)
 }
 
+// ContextEvaluator is implemented by the nodes that can be evaluated with an EvalContext (errors, cancellation and traces).
+// All the nodes of the package implement it. Other nodes are evaluated with Eval (see evalNode).
+type ContextEvaluator interface {
+	EvalWithContext(evalContext *EvalContext, message *MessageAttributes) (bool, []map[string]interface{}, error)
+}
+
 type AnyAllNode interface {
 	Node
 	SetParentJsonpathAttribute(parentJsonpathAttribute string)
@@ -115,6 +134,59 @@ type AnyAllNode interface {
 	GetPreparedJsonpathQuery() []jsonpath.FilterFunc
 }
 
+//--------------------------------------
+// EvalContext
+//--------------------------------------
+
+// EvalContext holds the state of one evaluation of a conditions tree.
+// Evaluation errors do not change the result of a node (which is the same as in Eval). The first error is returned alongside the result.
+// Errors of the go context (cancellation, deadline) stop the evaluation.
+type EvalContext struct {
+	Context context.Context
+	Clock   func() time.Time // the reference "now" of the OLDER_THAN/NEWER_THAN methods (if nil: the message's RequestTime or else the current time)
+
+	trace     *TraceNode // the trace node of the parent node (nil if we don't trace)
+	ruleTrace *RuleTrace
+}
+
+func NewEvalContext(ctx context.Context) *EvalContext {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &EvalContext{Context: ctx}
+}
+
+// Err returns the error of the go context (if it is cancelled or its deadline was exceeded)
+func (e *EvalContext) Err() error {
+	return e.Context.Err()
+}
+
+// evalNode evaluates the node with the EvalContext if it implements ContextEvaluator and with Eval otherwise
+func evalNode(evalContext *EvalContext, node Node, message *MessageAttributes) (bool, []map[string]interface{}, error) {
+	if evaluator, ok := node.(ContextEvaluator); ok {
+		return evaluator.EvalWithContext(evalContext, message)
+	}
+	flag, extraData := node.Eval(message)
+	return flag, extraData, nil
+}
+
+// evalAndLogErrors is used by Eval: we log the evaluation errors and return the result
+func evalAndLogErrors(node ContextEvaluator, message *MessageAttributes) (bool, []map[string]interface{}) {
+	flag, extraData, err := node.EvalWithContext(NewEvalContext(context.Background()), message)
+	if err != nil {
+		log.Println(err)
+	}
+	return flag, extraData
+}
+
+// firstError returns the error that was already found (if any) or the new one
+func firstError(err, newErr error) error {
+	if err != nil {
+		return err
+	}
+	return newErr
+}
+
 //--------------------------------------
 // And Node
 //--------------------------------------
@@ -123,17 +195,33 @@ type And struct {
 }
 
 func (a *And) Eval(message *MessageAttributes) (bool, []map[string]interface{}) {
+	return evalAndLogErrors(a, message)
+}
+
+func (a *And) EvalWithContext(evalContext *EvalContext, message *MessageAttributes) (bool, []map[string]interface{}, error) {
+	trace, evalContext := evalContext.traceNode("AND", "")
+	flag, extraData, err := evalAnd(evalContext, a, message)
+	trace.setResult(flag, err)
+	return flag, extraData, err
+}
+
+func evalAnd(evalContext *EvalContext, a *And, message *MessageAttributes) (bool, []map[string]interface{}, error) {
 	extraData := []map[string]interface{}{}
+	var evalErr error
 	for _, node := range a.Nodes {
-		flag, extraDataTemp := node.Eval(message)
+		flag, extraDataTemp, err := evalNode(evalContext, node, message)
+		if ctxErr := evalContext.Err(); ctxErr != nil {
+			return false, extraData, ctxErr
+		}
+		evalErr = firstError(evalErr, err)
 		if len(extraDataTemp) > 0 {
 			extraData = extraDataTemp
 		}
 		if flag == false {
-			return false, extraData // no need to check the rest
+			return false, extraData, evalErr // no need to check the rest
 		}
 	}
-	return true, extraData
+	return true, extraData, evalErr
 }
 func (a *And) Append(node Node) {
 	a.Nodes = append(a.Nodes, node)
@@ -184,10 +272,26 @@ type Or struct {
 }
 
 func (o *Or) Eval(message *MessageAttributes) (bool, []map[string]interface{}) {
+	return evalAndLogErrors(o, message)
+}
+
+func (o *Or) EvalWithContext(evalContext *EvalContext, message *MessageAttributes) (bool, []map[string]interface{}, error) {
+	trace, evalContext := evalContext.traceNode("OR", "")
+	flag, extraData, err := evalOr(evalContext, o, message)
+	trace.setResult(flag, err)
+	return flag, extraData, err
+}
+
+func evalOr(evalContext *EvalContext, o *Or, message *MessageAttributes) (bool, []map[string]interface{}, error) {
 	flagOut := false
 	extraDataOut := []map[string]interface{}{}
+	var evalErr error
 	for _, node := range o.Nodes {
-		flag, extraData := node.Eval(message)
+		flag, extraData, err := evalNode(evalContext, node, message)
+		if ctxErr := evalContext.Err(); ctxErr != nil {
+			return false, extraDataOut, ctxErr
+		}
+		evalErr = firstError(evalErr, err)
 		// if flag {
 		//	return true, extraData // no need to check the rest
 		//}
@@ -198,7 +302,7 @@ func (o *Or) Eval(message *MessageAttributes) (bool, []map[string]interface{}) {
 			}
 		}
 	}
-	return flagOut, extraDataOut
+	return flagOut, extraDataOut, evalErr
 }
 func (o *Or) Append(node Node) {
 	o.Nodes = append(o.Nodes, node)
@@ -224,8 +328,17 @@ type Not struct {
 }
 
 func (n *Not) Eval(message *MessageAttributes) (bool, []map[string]interface{}) {
-	flag, _ := n.Node.Eval(message)
-	return !flag, []map[string]interface{}{}
+	return evalAndLogErrors(n, message)
+}
+
+func (n *Not) EvalWithContext(evalContext *EvalContext, message *MessageAttributes) (bool, []map[string]interface{}, error) {
+	trace, evalContext := evalContext.traceNode("NOT", "")
+	flag, _, err := evalNode(evalContext, n.Node, message)
+	if ctxErr := evalContext.Err(); ctxErr != nil {
+		return false, []map[string]interface{}{}, ctxErr
+	}
+	trace.setResult(!flag, err)
+	return !flag, []map[string]interface{}{}, err
 }
 func (n *Not) Append(node Node) {
 	n.Node = node
@@ -241,6 +354,213 @@ func (n *Not) String() string {
 	return str
 }
 
+//--------------------------------------
+// Threshold Nodes (AT_LEAST, AT_MOST, EXACTLY and XOR)
+//--------------------------------------
+
+// AtLeast is true if at least N of its nodes are true
+type AtLeast struct {
+	N     int    `yaml:"n" json:"n" bson:"n" structs:"n"`
+	Nodes []Node `yaml:"conditions,omitempty" json:"conditions,omitempty" bson:"conditions,omitempty" structs:"conditions,omitempty"`
+}
+
+func (a *AtLeast) MarshalJSON() ([]byte, error) {
+	return thresholdMarshalJSON("AT_LEAST", a.N, a.Nodes)
+}
+func (a *AtLeast) MarshalYAML() (interface{}, error) {
+	return thresholdMarshalYAML("AT_LEAST", a.N, a.Nodes)
+}
+func (a *AtLeast) Eval(message *MessageAttributes) (bool, []map[string]interface{}) {
+	return evalAndLogErrors(a, message)
+}
+func (a *AtLeast) EvalWithContext(evalContext *EvalContext, message *MessageAttributes) (bool, []map[string]interface{}, error) {
+	return evalThreshold(evalContext, "AT_LEAST", fmt.Sprintf("n=%v", a.N), a.Nodes, a.N, len(a.Nodes), message)
+}
+func (a *AtLeast) Append(node Node) {
+	a.Nodes = append(a.Nodes, node)
+}
+func (a *AtLeast) PrepareAndValidate(stringsAndlists PredefinedStringsAndLists) error {
+	return prepareThreshold("AT_LEAST", a.N, a.Nodes, stringsAndlists)
+}
+func (a *AtLeast) String() string {
+	return thresholdString("AT_LEAST", a.N, a.Nodes)
+}
+
+// AtMost is true if at most N of its nodes are true
+type AtMost struct {
+	N     int    `yaml:"n" json:"n" bson:"n" structs:"n"`
+	Nodes []Node `yaml:"conditions,omitempty" json:"conditions,omitempty" bson:"conditions,omitempty" structs:"conditions,omitempty"`
+}
+
+func (a *AtMost) MarshalJSON() ([]byte, error) {
+	return thresholdMarshalJSON("AT_MOST", a.N, a.Nodes)
+}
+func (a *AtMost) MarshalYAML() (interface{}, error) {
+	return thresholdMarshalYAML("AT_MOST", a.N, a.Nodes)
+}
+func (a *AtMost) Eval(message *MessageAttributes) (bool, []map[string]interface{}) {
+	return evalAndLogErrors(a, message)
+}
+func (a *AtMost) EvalWithContext(evalContext *EvalContext, message *MessageAttributes) (bool, []map[string]interface{}, error) {
+	return evalThreshold(evalContext, "AT_MOST", fmt.Sprintf("n=%v", a.N), a.Nodes, 0, a.N, message)
+}
+func (a *AtMost) Append(node Node) {
+	a.Nodes = append(a.Nodes, node)
+}
+func (a *AtMost) PrepareAndValidate(stringsAndlists PredefinedStringsAndLists) error {
+	return prepareThreshold("AT_MOST", a.N, a.Nodes, stringsAndlists)
+}
+func (a *AtMost) String() string {
+	return thresholdString("AT_MOST", a.N, a.Nodes)
+}
+
+// Exactly is true if exactly N of its nodes are true
+type Exactly struct {
+	N     int    `yaml:"n" json:"n" bson:"n" structs:"n"`
+	Nodes []Node `yaml:"conditions,omitempty" json:"conditions,omitempty" bson:"conditions,omitempty" structs:"conditions,omitempty"`
+}
+
+func (e *Exactly) MarshalJSON() ([]byte, error) {
+	return thresholdMarshalJSON("EXACTLY", e.N, e.Nodes)
+}
+func (e *Exactly) MarshalYAML() (interface{}, error) {
+	return thresholdMarshalYAML("EXACTLY", e.N, e.Nodes)
+}
+func (e *Exactly) Eval(message *MessageAttributes) (bool, []map[string]interface{}) {
+	return evalAndLogErrors(e, message)
+}
+func (e *Exactly) EvalWithContext(evalContext *EvalContext, message *MessageAttributes) (bool, []map[string]interface{}, error) {
+	return evalThreshold(evalContext, "EXACTLY", fmt.Sprintf("n=%v", e.N), e.Nodes, e.N, e.N, message)
+}
+func (e *Exactly) Append(node Node) {
+	e.Nodes = append(e.Nodes, node)
+}
+func (e *Exactly) PrepareAndValidate(stringsAndlists PredefinedStringsAndLists) error {
+	return prepareThreshold("EXACTLY", e.N, e.Nodes, stringsAndlists)
+}
+func (e *Exactly) String() string {
+	return thresholdString("EXACTLY", e.N, e.Nodes)
+}
+
+// Xor is true if exactly one of its nodes is true (one-of)
+type Xor struct {
+	Nodes []Node `yaml:"XOR,omitempty" json:"XOR,omitempty" bson:"XOR,omitempty" structs:"XOR,omitempty"`
+}
+
+func (x *Xor) Eval(message *MessageAttributes) (bool, []map[string]interface{}) {
+	return evalAndLogErrors(x, message)
+}
+func (x *Xor) EvalWithContext(evalContext *EvalContext, message *MessageAttributes) (bool, []map[string]interface{}, error) {
+	return evalThreshold(evalContext, "XOR", "", x.Nodes, 1, 1, message)
+}
+func (x *Xor) Append(node Node) {
+	x.Nodes = append(x.Nodes, node)
+}
+func (x *Xor) PrepareAndValidate(stringsAndlists PredefinedStringsAndLists) error {
+	for _, node := range x.Nodes {
+		err := node.PrepareAndValidate(stringsAndlists)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (x *Xor) String() string {
+	return AndOrString(x.Nodes, " ^ ")
+}
+
+// evalThreshold evaluates all the nodes (as OR does) and tests that the number of true nodes is between min and max.
+// the extra data of the true nodes is returned if the threshold node is true.
+func evalThreshold(evalContext *EvalContext, nodeType, traceString string, nodes []Node, min, max int, message *MessageAttributes) (bool, []map[string]interface{}, error) {
+
+	trace, evalContext := evalContext.traceNode(nodeType, traceString)
+
+	count := 0
+	extraData := []map[string]interface{}{}
+	var evalErr error
+	for _, node := range nodes {
+		flag, extraDataTemp, err := evalNode(evalContext, node, message)
+		if ctxErr := evalContext.Err(); ctxErr != nil {
+			return false, []map[string]interface{}{}, ctxErr
+		}
+		evalErr = firstError(evalErr, err)
+		if flag {
+			count++
+			extraData = append(extraData, extraDataTemp...)
+		}
+	}
+
+	flag := count >= min && count <= max
+	if !flag {
+		extraData = []map[string]interface{}{}
+	}
+	trace.setResult(flag, evalErr)
+	return flag, extraData, evalErr
+}
+
+func prepareThreshold(nodeType string, n int, nodes []Node, stringsAndlists PredefinedStringsAndLists) error {
+	if n < 0 || n > len(nodes) {
+		return fmt.Errorf("invalid n [%v] in %v node with %v conditions", n, nodeType, len(nodes))
+	}
+	for _, node := range nodes {
+		err := node.PrepareAndValidate(stringsAndlists)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func thresholdString(nodeType string, n int, nodes []Node) string {
+	return fmt.Sprintf("[%v<%v>:%v]", nodeType, n, AndOrString(nodes, ", "))
+}
+
+func thresholdMarshalJSON(nodeType string, n int, nodes []Node) ([]byte, error) {
+	if nodes == nil {
+		nodes = []Node{}
+	}
+	conditionsBytes, err := json.Marshal(nodes)
+	if err != nil {
+		return []byte{}, err
+	}
+	str := fmt.Sprintf(`{"%v":{"n":%v,"conditions":%v}}`, nodeType, n, string(conditionsBytes))
+	return []byte(str), nil
+}
+
+func thresholdMarshalYAML(nodeType string, n int, nodes []Node) (interface{}, error) {
+	if nodes == nil {
+		nodes = []Node{}
+	}
+	return map[string]interface{}{nodeType: struct {
+		N     int    `yaml:"n"`
+		Nodes []Node `yaml:"conditions"`
+	}{n, nodes}}, nil
+}
+
+//--------------------------------------
+// Serialization of ANY, ALL and COUNT Nodes
+//--------------------------------------
+
+// arrayNodeDocument is the serialized form of ANY, ALL and COUNT nodes. it keeps the original parentJsonpathAttribute and returnValueJsonpath (before they are prepared)
+type arrayNodeDocument struct {
+	ParentJsonpathAttribute string            `yaml:"parentJsonpathAttribute" json:"parentJsonpathAttribute"`
+	ReturnValueJsonpath     map[string]string `yaml:"returnValueJsonpath,omitempty" json:"returnValueJsonpath,omitempty"`
+	Method                  string            `yaml:"method,omitempty" json:"method,omitempty"` // COUNT only
+	Value                   *int              `yaml:"value,omitempty" json:"value,omitempty"`   // COUNT only
+	Node                    Node              `yaml:"condition" json:"condition"`
+}
+
+func newArrayNodeDocument(parentJsonpathAttribute, parentJsonpathAttributeOriginal string, returnValueJsonpath, returnValueJsonpathOriginal map[string]string, node Node) arrayNodeDocument {
+	doc := arrayNodeDocument{ParentJsonpathAttribute: parentJsonpathAttribute, ReturnValueJsonpath: returnValueJsonpath, Node: node}
+	if len(parentJsonpathAttributeOriginal) > 0 {
+		doc.ParentJsonpathAttribute = parentJsonpathAttributeOriginal
+	}
+	if len(returnValueJsonpathOriginal) > 0 {
+		doc.ReturnValueJsonpath = returnValueJsonpathOriginal
+	}
+	return doc
+}
+
 //--------------------------------------
 // Any Node
 //--------------------------------------
@@ -256,46 +576,41 @@ type Any struct {
 	PreparedJsonpathQuery                        []jsonpath.FilterFunc `yaml:"-,omitempty" json:"-,omitempty"`
 }
 
-func (a *Any) MarshalJSON() ([]byte, error) {
-
-	parentJsonpathAttributeString := a.ParentJsonpathAttribute
-	if len(a.ParentJsonpathAttributeOriginal) > 0 {
-		parentJsonpathAttributeString = a.ParentJsonpathAttributeOriginal
-	}
-
-	returnValueJsonpath := a.ReturnValueJsonpath
-	if len(a.ReturnValueJsonpathOriginal) > 0 {
-		returnValueJsonpath = a.ReturnValueJsonpathOriginal
-	}
+func (a *Any) document() arrayNodeDocument {
+	return newArrayNodeDocument(a.ParentJsonpathAttribute, a.ParentJsonpathAttributeOriginal, a.ReturnValueJsonpath, a.ReturnValueJsonpathOriginal, a.Node)
+}
 
-	str := fmt.Sprintf(`{"ANY":{"parentJsonpathAttribute":"%v",`, parentJsonpathAttributeString)
-	if len(returnValueJsonpath) > 0 {
-		returnValueJsonpathJson, _ := json.Marshal(returnValueJsonpath)
-		str = fmt.Sprintf(`%v"returnValueJsonpath": %v,`, str, string(returnValueJsonpathJson))
-	}
+func (a *Any) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]arrayNodeDocument{"ANY": a.document()})
+}
 
-	conditionBytes, err := json.Marshal(a.Node)
-	if err != nil {
-		return []byte{}, err
-	}
-	str = fmt.Sprintf(`%v"condition":%v}}`, str, string(conditionBytes))
+func (a *Any) MarshalYAML() (interface{}, error) {
+	return map[string]arrayNodeDocument{"ANY": a.document()}, nil
+}
 
-	return []byte(str), nil
+func (a *Any) Eval(message *MessageAttributes) (bool, []map[string]interface{}) {
+	return evalAndLogErrors(a, message)
 }
 
-func (a *Any) Eval(message *MessageAttributes) (bool, []map[string]interface{}) { // to-do: return errors
+func (a *Any) EvalWithContext(evalContext *EvalContext, message *MessageAttributes) (bool, []map[string]interface{}, error) {
+	trace, evalContext := evalContext.traceNode("ANY", a.GetParentJsonpathAttribute())
+	var flag bool
+	var extraData []map[string]interface{}
+	var err error
 	if message.RequestRawInterface != nil && a.PreparedJsonpathQuery != nil {
-		return evalAnyRawInterface(a, message)
+		flag, extraData, err = evalAnyRawInterface(evalContext, a, message)
 	} else {
-		return evalAnyRawBytes(a, message)
+		flag, extraData, err = evalAnyRawBytes(evalContext, a, message)
 	}
+	trace.setResult(flag, err)
+	return flag, extraData, err
 }
 
-func evalAnyRawInterface(a *Any, message *MessageAttributes) (bool, []map[string]interface{}) {
+func evalAnyRawInterface(evalContext *EvalContext, a *Any, message *MessageAttributes) (bool, []map[string]interface{}, error) {
 
 	rawArrayData, err := getArrayOfInterfaces(a, message)
 	if err != nil {
-		return false, []map[string]interface{}{}
+		return false, []map[string]interface{}{}, nil
 	}
 
 	extraData := []map[string]interface{}{}
@@ -304,10 +619,18 @@ func evalAnyRawInterface(a *Any, message *MessageAttributes) (bool, []map[string
 	if len(a.ReturnValueJsonpath) > 0 {
 		checkAllValuesInTheArray = true
 	}
+	var evalErr error
 	originalRequestRawInterfaceRelative := message.RequestRawInterfaceRelative
-	for _, val := range rawArrayData {
+	defer func() { message.RequestRawInterfaceRelative = originalRequestRawInterfaceRelative }()
+	for i, val := range rawArrayData {
+		if ctxErr := evalContext.Err(); ctxErr != nil {
+			return false, extraData, ctxErr
+		}
+		val := val
 		message.RequestRawInterfaceRelative = &val
-		flag, _ := a.Node.Eval(message)
+		flag, _, err := evalNode(evalContext, a.Node, message)
+		evalErr = firstError(evalErr, err)
+		evalContext.trace.setArrayElement(i, flag)
 		if flag {
 			result = true
 			if a.ReturnValueJsonpath != nil {
@@ -317,20 +640,18 @@ func evalAnyRawInterface(a *Any, message *MessageAttributes) (bool, []map[string
 
 			}
 			if !checkAllValuesInTheArray {
-				message.RequestRawInterfaceRelative = originalRequestRawInterfaceRelative
-				return result, extraData
+				return result, extraData, evalErr
 			}
 		}
 	}
 
-	message.RequestRawInterfaceRelative = originalRequestRawInterfaceRelative
-	return result, extraData
+	return result, extraData, evalErr
 }
-func evalAnyRawBytes(a *Any, message *MessageAttributes) (bool, []map[string]interface{}) {
+func evalAnyRawBytes(evalContext *EvalContext, a *Any, message *MessageAttributes) (bool, []map[string]interface{}, error) {
 
 	rawArrayData, err := getArrayOfJsons(a, message)
 	if err != nil {
-		return false, []map[string]interface{}{}
+		return false, []map[string]interface{}{}, nil
 	}
 
 	extraData := []map[string]interface{}{}
@@ -339,10 +660,18 @@ func evalAnyRawBytes(a *Any, message *MessageAttributes) (bool, []map[string]int
 	if len(a.ReturnValueJsonpath) > 0 {
 		checkAllValuesInTheArray = true
 	}
+	var evalErr error
 	originalRequestJsonRawRelative := message.RequestJsonRawRelative
-	for _, val := range rawArrayData {
+	defer func() { message.RequestJsonRawRelative = originalRequestJsonRawRelative }()
+	for i, val := range rawArrayData {
+		if ctxErr := evalContext.Err(); ctxErr != nil {
+			return false, extraData, ctxErr
+		}
+		val := val
 		message.RequestJsonRawRelative = &val
-		flag, _ := a.Node.Eval(message)
+		flag, _, err := evalNode(evalContext, a.Node, message)
+		evalErr = firstError(evalErr, err)
+		evalContext.trace.setArrayElement(i, flag)
 		if flag {
 			result = true
 			if a.ReturnValueJsonpath != nil {
@@ -350,14 +679,12 @@ func evalAnyRawBytes(a *Any, message *MessageAttributes) (bool, []map[string]int
 				extraData = append(extraData, extraDataTemp)
 			}
 			if !checkAllValuesInTheArray {
-				message.RequestJsonRawRelative = originalRequestJsonRawRelative
-				return result, extraData
+				return result, extraData, evalErr
 			}
 		}
 	}
 
-	message.RequestJsonRawRelative = originalRequestJsonRawRelative
-	return result, extraData
+	return result, extraData, evalErr
 }
 func (a *Any) Append(node Node) {
 	a.Node = node
@@ -467,82 +794,87 @@ type All struct {
 	PreparedJsonpathQuery                        []jsonpath.FilterFunc `yaml:"-,omitempty" json:"-,omitempty"`
 }
 
-func (a *All) MarshalJSON() ([]byte, error) {
-
-	parentJsonpathAttributeString := a.ParentJsonpathAttribute
-	if len(a.ParentJsonpathAttributeOriginal) > 0 {
-		parentJsonpathAttributeString = a.ParentJsonpathAttributeOriginal
-	}
-
-	returnValueJsonpath := a.ReturnValueJsonpath
-	if len(a.ReturnValueJsonpathOriginal) > 0 {
-		returnValueJsonpath = a.ReturnValueJsonpathOriginal
-	}
-
-	str := fmt.Sprintf(`{"ALL":{"parentJsonpathAttribute":"%v",`, parentJsonpathAttributeString)
-	if len(returnValueJsonpath) > 0 {
-		returnValueJsonpathJson, _ := json.Marshal(returnValueJsonpath)
-		str = fmt.Sprintf(`%v"returnValueJsonpath":%v,`, str, string(returnValueJsonpathJson))
-	}
+func (a *All) document() arrayNodeDocument {
+	return newArrayNodeDocument(a.ParentJsonpathAttribute, a.ParentJsonpathAttributeOriginal, a.ReturnValueJsonpath, a.ReturnValueJsonpathOriginal, a.Node)
+}
 
-	conditionBytes, err := json.Marshal(a.Node)
-	if err != nil {
-		return []byte{}, err
-	}
-	str = fmt.Sprintf(`%v"condition":%v}}`, str, string(conditionBytes))
+func (a *All) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]arrayNodeDocument{"ALL": a.document()})
+}
 
-	return []byte(str), nil
+func (a *All) MarshalYAML() (interface{}, error) {
+	return map[string]arrayNodeDocument{"ALL": a.document()}, nil
 }
 
 func (a *All) Eval(message *MessageAttributes) (bool, []map[string]interface{}) {
+	return evalAndLogErrors(a, message)
+}
+
+func (a *All) EvalWithContext(evalContext *EvalContext, message *MessageAttributes) (bool, []map[string]interface{}, error) {
+	trace, evalContext := evalContext.traceNode("ALL", a.GetParentJsonpathAttribute())
+	var flag bool
+	var extraData []map[string]interface{}
+	var err error
 	if message.RequestRawInterface != nil && a.PreparedJsonpathQuery != nil {
-		return evalAllRawInterface(a, message)
+		flag, extraData, err = evalAllRawInterface(evalContext, a, message)
 	} else {
-		return evalAllRawBytes(a, message)
+		flag, extraData, err = evalAllRawBytes(evalContext, a, message)
 	}
+	trace.setResult(flag, err)
+	return flag, extraData, err
 }
-func evalAllRawInterface(a *All, message *MessageAttributes) (bool, []map[string]interface{}) {
+func evalAllRawInterface(evalContext *EvalContext, a *All, message *MessageAttributes) (bool, []map[string]interface{}, error) {
 
 	rawArrayData, err := getArrayOfInterfaces(a, message)
 	if err != nil {
-		return false, []map[string]interface{}{}
+		return false, []map[string]interface{}{}, nil
 	}
 
+	var evalErr error
 	originalRequestRawInterfaceRelative := message.RequestRawInterfaceRelative
+	defer func() { message.RequestRawInterfaceRelative = originalRequestRawInterfaceRelative }()
 
-	for _, val := range rawArrayData {
+	for i, val := range rawArrayData {
+		if ctxErr := evalContext.Err(); ctxErr != nil {
+			return false, []map[string]interface{}{}, ctxErr
+		}
+		val := val
 		message.RequestRawInterfaceRelative = &val
-		flag, _ := a.Node.Eval(message)
+		flag, _, err := evalNode(evalContext, a.Node, message)
+		evalErr = firstError(evalErr, err)
+		evalContext.trace.setArrayElement(i, flag)
 		if !flag {
-
-			message.RequestRawInterfaceRelative = originalRequestRawInterfaceRelative
-			return false, []map[string]interface{}{}
-
+			return false, []map[string]interface{}{}, evalErr
 		}
 	}
-	message.RequestRawInterfaceRelative = originalRequestRawInterfaceRelative
-	return true, []map[string]interface{}{}
+	return true, []map[string]interface{}{}, evalErr
 
 }
 
-func evalAllRawBytes(a *All, message *MessageAttributes) (bool, []map[string]interface{}) {
+func evalAllRawBytes(evalContext *EvalContext, a *All, message *MessageAttributes) (bool, []map[string]interface{}, error) {
 	rawArrayData, err := getArrayOfJsons(a, message)
 	if err != nil {
-		return false, []map[string]interface{}{}
+		return false, []map[string]interface{}{}, nil
 	}
 
+	var evalErr error
 	originalRequestJsonRawRelative := message.RequestJsonRawRelative
+	defer func() { message.RequestJsonRawRelative = originalRequestJsonRawRelative }()
 
-	for _, val := range rawArrayData {
+	for i, val := range rawArrayData {
+		if ctxErr := evalContext.Err(); ctxErr != nil {
+			return false, []map[string]interface{}{}, ctxErr
+		}
+		val := val
 		message.RequestJsonRawRelative = &val
-		flag, _ := a.Node.Eval(message)
+		flag, _, err := evalNode(evalContext, a.Node, message)
+		evalErr = firstError(evalErr, err)
+		evalContext.trace.setArrayElement(i, flag)
 		if !flag {
-			message.RequestJsonRawRelative = originalRequestJsonRawRelative
-			return false, []map[string]interface{}{}
+			return false, []map[string]interface{}{}, evalErr
 		}
 	}
-	message.RequestJsonRawRelative = originalRequestJsonRawRelative
-	return true, []map[string]interface{}{}
+	return true, []map[string]interface{}{}, evalErr
 }
 
 func (a *All) Append(node Node) {
@@ -622,6 +954,315 @@ func (a *All) GetPreparedJsonpathQuery() []jsonpath.FilterFunc {
 	return a.PreparedJsonpathQuery
 }
 
+//--------------------------------------
+// Count Node
+//--------------------------------------
+
+// Count is true if the number of array elements that satisfy the node compares to the value (for example: more than 3 containers run as root).
+// A missing array has no elements, so LT, LE and EQ 0 are true (as in the mongo query, where a missing array is counted as an empty one).
+type Count struct {
+	ParentJsonpathAttribute                      string
+	ParentJsonpathAttributeArray                 []string
+	ParentJsonpathAttributeOriginal              string
+	ReturnValueJsonpath                          map[string]string
+	ReturnValueJsonpathOriginal                  map[string]string
+	ReturnValuePreparedJsonpathQuery             map[string]jsonpath.FilterFunc
+	ReturnValuePreparedJsonpathQueryRelativeFlag map[string]bool
+	Method                                       string                // EQ, NEQ, GT, GE, LT or LE
+	Value                                        int                   // the number of elements to compare to
+	Node                                         Node                  `yaml:"condition,omitempty" json:"condition,omitempty" bson:"condition,omitempty" structs:"condition,omitempty"`
+	PreparedJsonpathQuery                        []jsonpath.FilterFunc `yaml:"-,omitempty" json:"-,omitempty"`
+}
+
+func (c *Count) document() arrayNodeDocument {
+	doc := newArrayNodeDocument(c.ParentJsonpathAttribute, c.ParentJsonpathAttributeOriginal, c.ReturnValueJsonpath, c.ReturnValueJsonpathOriginal, c.Node)
+	value := c.Value
+	doc.Method = c.Method
+	doc.Value = &value
+	return doc
+}
+
+func (c *Count) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]arrayNodeDocument{"COUNT": c.document()})
+}
+
+func (c *Count) MarshalYAML() (interface{}, error) {
+	return map[string]arrayNodeDocument{"COUNT": c.document()}, nil
+}
+
+func (c *Count) Eval(message *MessageAttributes) (bool, []map[string]interface{}) {
+	return evalAndLogErrors(c, message)
+}
+
+func (c *Count) EvalWithContext(evalContext *EvalContext, message *MessageAttributes) (bool, []map[string]interface{}, error) {
+	trace, evalContext := evalContext.traceNode("COUNT", fmt.Sprintf("%v %v %v", c.GetParentJsonpathAttribute(), c.Method, c.Value))
+	var count int
+	var extraData []map[string]interface{}
+	var err error
+	if message.RequestRawInterface != nil && c.PreparedJsonpathQuery != nil {
+		count, extraData, err = evalCountRawInterface(evalContext, c, message)
+	} else {
+		count, extraData, err = evalCountRawBytes(evalContext, c, message)
+	}
+	flag := compareCount(count, c.Method, c.Value)
+	if !flag {
+		extraData = []map[string]interface{}{}
+	}
+	trace.setValue(count)
+	trace.setResult(flag, err)
+	return flag, extraData, err
+}
+
+func evalCountRawInterface(evalContext *EvalContext, c *Count, message *MessageAttributes) (int, []map[string]interface{}, error) {
+
+	rawArrayData, err := getArrayOfInterfaces(c, message)
+	if err != nil {
+		return 0, []map[string]interface{}{}, nil
+	}
+
+	extraData := []map[string]interface{}{}
+	count := 0
+	var evalErr error
+	originalRequestRawInterfaceRelative := message.RequestRawInterfaceRelative
+	defer func() { message.RequestRawInterfaceRelative = originalRequestRawInterfaceRelative }()
+	for i, val := range rawArrayData {
+		if ctxErr := evalContext.Err(); ctxErr != nil {
+			return 0, extraData, ctxErr
+		}
+		val := val
+		message.RequestRawInterfaceRelative = &val
+		flag, _, err := evalNode(evalContext, c.Node, message)
+		evalErr = firstError(evalErr, err)
+		evalContext.trace.setArrayElement(i, flag)
+		if flag {
+			count++
+			if c.ReturnValueJsonpath != nil {
+				extraDataTemp := getExtraDataFromInterface(c.ReturnValuePreparedJsonpathQuery, c.ReturnValuePreparedJsonpathQueryRelativeFlag, c.ReturnValueJsonpath, message)
+				extraData = append(extraData, extraDataTemp)
+			}
+		}
+	}
+
+	return count, extraData, evalErr
+}
+
+func evalCountRawBytes(evalContext *EvalContext, c *Count, message *MessageAttributes) (int, []map[string]interface{}, error) {
+
+	rawArrayData, err := getArrayOfJsons(c, message)
+	if err != nil {
+		return 0, []map[string]interface{}{}, nil
+	}
+
+	extraData := []map[string]interface{}{}
+	count := 0
+	var evalErr error
+	originalRequestJsonRawRelative := message.RequestJsonRawRelative
+	defer func() { message.RequestJsonRawRelative = originalRequestJsonRawRelative }()
+	for i, val := range rawArrayData {
+		if ctxErr := evalContext.Err(); ctxErr != nil {
+			return 0, extraData, ctxErr
+		}
+		val := val
+		message.RequestJsonRawRelative = &val
+		flag, _, err := evalNode(evalContext, c.Node, message)
+		evalErr = firstError(evalErr, err)
+		evalContext.trace.setArrayElement(i, flag)
+		if flag {
+			count++
+			if c.ReturnValueJsonpath != nil {
+				extraDataTemp := getExtraDataFromByteArray(c.ReturnValueJsonpath, c.ReturnValuePreparedJsonpathQueryRelativeFlag, message)
+				extraData = append(extraData, extraDataTemp)
+			}
+		}
+	}
+
+	return count, extraData, evalErr
+}
+
+func compareCount(count int, method string, value int) bool {
+	switch method {
+	case "EQ":
+		return count == value
+	case "NEQ", "NE":
+		return count != value
+	case "GT":
+		return count > value
+	case "GE":
+		return count >= value
+	case "LT":
+		return count < value
+	case "LE":
+		return count <= value
+	}
+	return false
+}
+
+func (c *Count) Append(node Node) {
+	c.Node = node
+}
+
+func (c *Count) PrepareAndValidate(stringsAndlists PredefinedStringsAndLists) error {
+
+	switch c.Method {
+	case "EQ", "NEQ", "NE", "GT", "GE", "LT", "LE":
+	default:
+		return fmt.Errorf("invalid method [%v] in COUNT node", c.Method)
+	}
+	if c.Value < 0 {
+		return fmt.Errorf("invalid value [%v] in COUNT node", c.Value)
+	}
+
+	err := c.Node.PrepareAndValidate(stringsAndlists)
+	if err != nil {
+		return err
+	}
+
+	c.ParentJsonpathAttributeArray = strings.Split(c.GetParentJsonpathAttribute(), ",")
+
+	for _, j := range c.GetParentJsonpathAttributeArray() {
+		preparedJsonpath, err := prepareJsonpathQuery(j)
+		if err != nil {
+			return err
+		}
+		c.PreparedJsonpathQuery = append(c.PreparedJsonpathQuery, preparedJsonpath)
+	}
+	return nil
+}
+
+func (c *Count) String() string {
+	str1 := c.ParentJsonpathAttribute
+	if len(c.ParentJsonpathAttributeOriginal) > 0 {
+		str1 = c.ParentJsonpathAttributeOriginal
+	}
+	str2 := c.ReturnValueJsonpath
+	if len(c.ReturnValueJsonpathOriginal) > 0 {
+		str2 = c.ReturnValueJsonpathOriginal
+	}
+	str := fmt.Sprintf("[COUNT<%v;%v;%v-%v>:%v]", str1, str2, c.Method, c.Value, c.Node.String())
+	return str
+}
+
+func (c *Count) SetParentJsonpathAttribute(parentJsonpathAttribute string) {
+	c.ParentJsonpathAttributeOriginal = parentJsonpathAttribute
+	c.ParentJsonpathAttribute = strings.Replace(parentJsonpathAttribute, "jsonpath:", "", -1)
+}
+
+func (c *Count) GetParentJsonpathAttribute() string {
+	return c.ParentJsonpathAttribute
+}
+
+func (c *Count) GetParentJsonpathAttributeArray() []string {
+	return c.ParentJsonpathAttributeArray
+}
+
+func (c *Count) SetReturnValueJsonpath(returnValueJsonpath map[string]string) {
+	dc.Copy(&c.ReturnValueJsonpathOriginal, &returnValueJsonpath)
+	dc.Copy(&c.ReturnValueJsonpath, &returnValueJsonpath)
+	c.ReturnValuePreparedJsonpathQuery = make(map[string]jsonpath.FilterFunc)
+	c.ReturnValuePreparedJsonpathQueryRelativeFlag = make(map[string]bool)
+	for queryName, queryString := range returnValueJsonpath {
+		c.ReturnValuePreparedJsonpathQueryRelativeFlag[queryName] = false
+		if strings.HasPrefix(queryString, "jsonpath:$RELATIVE") {
+			c.ReturnValuePreparedJsonpathQueryRelativeFlag[queryName] = true
+		}
+		c.ReturnValueJsonpath[queryName] = strings.Replace(queryString, "jsonpath:$RELATIVE", "$", 1)
+		preparedQuery, err := prepareJsonpathQuery(c.ReturnValueJsonpath[queryName])
+		if err == nil {
+			c.ReturnValuePreparedJsonpathQuery[queryName] = preparedQuery
+		} else {
+			c.ReturnValuePreparedJsonpathQuery[queryName] = nil
+		}
+	}
+}
+
+func (c *Count) GetReturnValueJsonpath() map[string]string {
+	return c.ReturnValueJsonpathOriginal
+}
+
+func (c *Count) GetPreparedJsonpathQuery() []jsonpath.FilterFunc {
+	return c.PreparedJsonpathQuery
+}
+
+//--------------------------------------
+// Ref Node
+//--------------------------------------
+
+// Ref is a reference to a predefined condition (a named fragment of a conditions tree, see PredefinedStringsAndLists).
+// The reference is resolved (to a prepared copy of the predefined condition) in PrepareAndValidate.
+type Ref struct {
+	Name string `yaml:"REF,omitempty" json:"REF,omitempty" bson:"REF,omitempty" structs:"REF,omitempty"`
+	Node Node   `yaml:"-" json:"-" bson:"-" structs:"-"` // the resolved predefined condition
+}
+
+func (r *Ref) Eval(message *MessageAttributes) (bool, []map[string]interface{}) {
+	return evalAndLogErrors(r, message)
+}
+
+func (r *Ref) EvalWithContext(evalContext *EvalContext, message *MessageAttributes) (bool, []map[string]interface{}, error) {
+	trace, evalContext := evalContext.traceNode("REF", r.Name)
+	if r.Node == nil {
+		err := fmt.Errorf("predefined condition [%v] was not resolved", r.Name)
+		trace.setResult(false, err)
+		return false, []map[string]interface{}{}, err
+	}
+	flag, extraData, err := evalNode(evalContext, r.Node, message)
+	trace.setResult(flag, err)
+	return flag, extraData, err
+}
+
+func (r *Ref) Append(node Node) {
+	r.Node = node
+}
+
+func (r *Ref) PrepareAndValidate(stringsAndlists PredefinedStringsAndLists) error {
+
+	for i, name := range stringsAndlists.resolvedConditions {
+		if name == r.Name {
+			cycle := append(append([]string{}, stringsAndlists.resolvedConditions[i:]...), r.Name)
+			return fmt.Errorf("cycle in predefined conditions [%v]", strings.Join(cycle, " -> "))
+		}
+	}
+
+	predefinedCondition, ok := stringsAndlists.PredefinedConditions[r.Name]
+	if !ok || predefinedCondition.ConditionsTree == nil {
+		if stringsAndlists.allowUnresolvedConditions {
+			return nil // the predefined conditions are not known when the rule is validated by itself
+		}
+		return fmt.Errorf("missing predefined condition [%v]", r.Name)
+	}
+
+	node, err := copyNode(predefinedCondition.ConditionsTree) // every reference is prepared separately
+	if err != nil {
+		return fmt.Errorf("predefined condition [%v]: %v", r.Name, err)
+	}
+	stringsAndlists.resolvedConditions = append(append([]string{}, stringsAndlists.resolvedConditions...), r.Name)
+	err = node.PrepareAndValidate(stringsAndlists)
+	if err != nil {
+		return fmt.Errorf("predefined condition [%v]: %v", r.Name, err)
+	}
+
+	r.Node = node
+	return nil
+}
+
+func (r *Ref) String() string {
+	return fmt.Sprintf("[REF<%v>]", r.Name)
+}
+
+// copyNode gives a deep copy of the node (using the json marshaller)
+func copyNode(node Node) (Node, error) {
+	data, err := json.Marshal(ConditionsTree{ConditionsTree: node})
+	if err != nil {
+		return nil, err
+	}
+	var c ConditionsTree
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, err
+	}
+	return c.ConditionsTree, nil
+}
+
 //--------------------------------------
 // True Node (used in unit tests)
 //--------------------------------------
@@ -630,6 +1271,11 @@ type True struct{}
 func (t True) Eval(message *MessageAttributes) (bool, []map[string]interface{}) {
 	return true, []map[string]interface{}{}
 }
+func (t True) EvalWithContext(evalContext *EvalContext, message *MessageAttributes) (bool, []map[string]interface{}, error) {
+	trace, _ := evalContext.traceNode("TRUE", "")
+	trace.setResult(true, nil)
+	return true, []map[string]interface{}{}, nil
+}
 func (t True) Append(node Node) {
 }
 func (t True) PrepareAndValidate(stringsAndlists PredefinedStringsAndLists) error {
@@ -638,6 +1284,14 @@ func (t True) PrepareAndValidate(stringsAndlists PredefinedStringsAndLists) erro
 func (t True) String() string {
 	return "true"
 }
+
+// MarshalJSON and MarshalYAML write the TRUE node as a condition on the "true" attribute (which is always true)
+func (t True) MarshalJSON() ([]byte, error) {
+	return (&Condition{Attribute: "true", Method: "EX"}).MarshalJSON()
+}
+func (t True) MarshalYAML() (interface{}, error) {
+	return (&Condition{Attribute: "true", Method: "EX"}).MarshalYAML()
+}
 func (t True) ToMongoQuery(base, str string, inArrayCounter int) (bson.M, []bson.M, error) {
 	return bson.M{}, []bson.M{}, fmt.Errorf("not supported")
 }
@@ -650,6 +1304,11 @@ type False struct{}
 func (f False) Eval(message *MessageAttributes) (bool, []map[string]interface{}) {
 	return false, []map[string]interface{}{}
 }
+func (f False) EvalWithContext(evalContext *EvalContext, message *MessageAttributes) (bool, []map[string]interface{}, error) {
+	trace, _ := evalContext.traceNode("FALSE", "")
+	trace.setResult(false, nil)
+	return false, []map[string]interface{}{}, nil
+}
 func (f False) Append(node Node) {
 }
 func (f False) PrepareAndValidate(stringsAndlists PredefinedStringsAndLists) error {
@@ -658,6 +1317,14 @@ func (f False) PrepareAndValidate(stringsAndlists PredefinedStringsAndLists) err
 func (f False) String() string {
 	return "false"
 }
+
+// MarshalJSON and MarshalYAML write the FALSE node as a condition on the "false" attribute (which is always false)
+func (f False) MarshalJSON() ([]byte, error) {
+	return (&Condition{Attribute: "false", Method: "EX"}).MarshalJSON()
+}
+func (f False) MarshalYAML() (interface{}, error) {
+	return (&Condition{Attribute: "false", Method: "EX"}).MarshalYAML()
+}
 func (f False) ToMongoQuery(base, str string, inArrayCounter int) (bson.M, []bson.M, error) {
 	return bson.M{}, []bson.M{}, fmt.Errorf("not supported")
 }
@@ -666,7 +1333,19 @@ func (f False) ToMongoQuery(base, str string, inArrayCounter int) (bson.M, []bso
 // Basic Condition Node
 //--------------------------------------
 func (c *Condition) Eval(message *MessageAttributes) (bool, []map[string]interface{}) {
-	return testOneCondition(c, message)
+	return evalAndLogErrors(c, message)
+}
+func (c *Condition) EvalWithContext(evalContext *EvalContext, message *MessageAttributes) (bool, []map[string]interface{}, error) {
+	if ctxErr := evalContext.Err(); ctxErr != nil {
+		return false, []map[string]interface{}{}, ctxErr
+	}
+	trace, _ := evalContext.traceNode("CONDITION", c.String())
+	flag, extraData, err := testOneCondition(evalContext, c, message)
+	if trace != nil {
+		trace.setResult(flag, err)
+		trace.setValue(resolveConditionValue(c, message))
+	}
+	return flag, extraData, err
 }
 func (c *Condition) Append(node Node) {
 }
@@ -695,6 +1374,13 @@ func (c *Condition) PrepareAndValidate(stringsAndlists PredefinedStringsAndLists
 		}
 		c.PreparedJsonpathQuery = preparedJsonpath
 	}
+	if c.ValueIsJsonpath {
+		preparedJsonpath, err := prepareJsonpathQuery(c.ValueJsonpathQuery)
+		if err != nil {
+			return err
+		}
+		c.PreparedValueJsonpathQuery = preparedJsonpath
+	}
 
 	return nil
 
@@ -723,6 +1409,12 @@ func InterpretNode(node interface{}, parentString string) (Node, error) {
 	case map[interface{}]interface{}:
 		return handleMapInterfaceInterface(v, parentString)
 
+	case string:
+		if parentString == "REF" {
+			return &Ref{Name: v}, nil
+		}
+		return nil, fmt.Errorf("can't parse conditions %+v", v)
+
 	case []interface{}: // array of nodes
 		if parentString == "" {
 			if len(v) != 1 {
@@ -742,6 +1434,10 @@ func InterpretNode(node interface{}, parentString string) (Node, error) {
 
 func handleMapInterfaceInterface(v map[interface{}]interface{}, parentString string) (Node, error) {
 
+	switch parentString {
+	case "AT_LEAST", "AT_MOST", "EXACTLY":
+		v = thresholdNodeKeys(v)
+	}
 	v2 := mapInterfaceToMapString(v)
 	return handleMapStringInterface(v2, parentString)
 
@@ -768,7 +1464,13 @@ func handleMapStringInterface(v2 map[string]interface{}, parentString string) (N
 	case "NOT":
 		notNode, err := getNotNode(v2, parentString)
 		return notNode, err
-	case "OR", "AND", "", "condition", "conditions", "conditionsTree":
+	case "AT_LEAST", "AT_MOST", "EXACTLY":
+		thresholdNode, err := getThresholdNode(v2, parentString)
+		return thresholdNode, err
+	case "COUNT":
+		countNode, err := getCountNode(v2, parentString)
+		return countNode, err
+	case "OR", "AND", "XOR", "", "condition", "conditions", "conditionsTree":
 		val, nodeType, err := getNodeValType(v2, parentString)
 		if err != nil {
 			return nil, err
@@ -830,6 +1532,17 @@ func getAnyAllNode(v2 map[string]interface{}, parentString string) (Node, error)
 		anyAllNode = &All{}
 	}
 
+	err = setAnyAllNode(anyAllNode, v2)
+	if err != nil {
+		return nil, err
+	}
+
+	return anyAllNode, nil
+}
+
+// setAnyAllNode sets the parentJsonpathAttribute, the returnValueJsonpath and the inner node of an ANY/ALL (or COUNT) node
+func setAnyAllNode(anyAllNode AnyAllNode, v2 map[string]interface{}) error {
+
 	for key, val := range v2 {
 		switch key {
 		case "parentJsonpathAttribute":
@@ -837,7 +1550,7 @@ func getAnyAllNode(v2 map[string]interface{}, parentString string) (Node, error)
 			if isValidParentJsonpathAttribute(parentJsonpathAttribute) {
 				anyAllNode.SetParentJsonpathAttribute(parentJsonpathAttribute)
 			} else {
-				return nil, fmt.Errorf("invalid parentJsonpathAttribute [%v]", parentJsonpathAttribute)
+				return fmt.Errorf("invalid parentJsonpathAttribute [%v]", parentJsonpathAttribute)
 			}
 		case "returnValueJsonpath":
 			returnValueJsonpath := map[string]interface{}{}
@@ -847,7 +1560,7 @@ func getAnyAllNode(v2 map[string]interface{}, parentString string) (Node, error)
 			case map[interface{}]interface{}:
 				returnValueJsonpath = mapInterfaceToMapString(val.(map[interface{}]interface{}))
 			default:
-				return nil, fmt.Errorf("invalid returnValueJsonpath [%v is not map[string]interface]", val)
+				return fmt.Errorf("invalid returnValueJsonpath [%v is not map[string]interface]", val)
 			}
 
 			returnValueJsonpathMap := map[string]string{}
@@ -856,23 +1569,84 @@ func getAnyAllNode(v2 map[string]interface{}, parentString string) (Node, error)
 				if strings.HasPrefix(vString, "jsonpath:$RELATIVE") {
 					returnValueJsonpathMap[k] = vString
 				} else {
-					return nil, fmt.Errorf("invalid returnValueJsonpath [%v] [should start with jsonpath:$RELATIVE]", returnValueJsonpath[k])
+					return fmt.Errorf("invalid returnValueJsonpath [%v] [should start with jsonpath:$RELATIVE]", returnValueJsonpath[k])
 				}
 				anyAllNode.SetReturnValueJsonpath(returnValueJsonpathMap)
 			}
 		default:
 			node, err := InterpretNode(val, key) // recursion!
 			if err != nil {
-				return nil, err
+				return err
 			}
 			anyAllNode.Append(node)
 		}
 	}
 	if anyAllNode.GetParentJsonpathAttribute() == "" {
-		return nil, fmt.Errorf("parentJsonpathAttribute is missing")
+		return fmt.Errorf("parentJsonpathAttribute is missing")
 	}
 
-	return anyAllNode, nil
+	return nil
+}
+
+func isValidCountNode(v map[string]interface{}) error {
+	keys := getKeys(v)
+	if len(keys) != 4 && len(keys) != 5 {
+		return fmt.Errorf("map of size different than 4 or 5 [COUNT node]")
+	}
+	if !slice.ContainsString(keys, "parentJsonpathAttribute") || !slice.ContainsString(keys, "method") || !slice.ContainsString(keys, "value") {
+		return fmt.Errorf("COUNT node without 'parentJsonpathAttribute', 'method' or 'value' key")
+	}
+	return nil
+}
+
+func getCountNode(v2 map[string]interface{}, parentString string) (Node, error) {
+
+	err := isValidCountNode(v2)
+	if err != nil {
+		return nil, err
+	}
+
+	method, ok := v2["method"].(string)
+	if !ok {
+		return nil, fmt.Errorf("method of COUNT node is not a string [%v]", v2["method"])
+	}
+	var value int
+	switch val := v2["value"].(type) {
+	case int:
+		value = val
+	case int64:
+		value = int(val)
+	case float64: // json numbers
+		if val != float64(int(val)) {
+			return nil, fmt.Errorf("value of COUNT node is not an integer [%v]", val)
+		}
+		value = int(val)
+	case string:
+		value, err = strconv.Atoi(val)
+		if err != nil {
+			return nil, fmt.Errorf("value of COUNT node is not an integer [%v]", val)
+		}
+	default:
+		return nil, fmt.Errorf("value of COUNT node is not an integer [%v]", val)
+	}
+	countNode := &Count{Method: strings.ToUpper(method), Value: value}
+
+	// the other keys are handled as in ANY/ALL nodes:
+	anyAllKeys := map[string]interface{}{}
+	for key, val := range v2 {
+		if key != "method" && key != "value" {
+			anyAllKeys[key] = val
+		}
+	}
+	err = setAnyAllNode(countNode, anyAllKeys)
+	if err != nil {
+		return nil, err
+	}
+	if countNode.Node == nil {
+		return nil, fmt.Errorf("COUNT node without condition")
+	}
+
+	return countNode, nil
 }
 
 func isValidNotNode(v map[string]interface{}) error {
@@ -901,6 +1675,83 @@ func getNotNode(v2 map[string]interface{}, parentString string) (Node, error) {
 	return notNode, nil
 }
 
+func isValidThresholdNode(v map[string]interface{}) error {
+	keys := getKeys(v)
+	if len(keys) != 2 || !slice.ContainsString(keys, "n") || !slice.ContainsString(keys, "conditions") {
+		return fmt.Errorf("AT_LEAST/AT_MOST/EXACTLY node should have exactly the keys 'n' and 'conditions'")
+	}
+	return nil
+}
+
+// thresholdNodeKeys replaces the boolean key false of a threshold node with the key n: yaml (v1.1) reads an unquoted n key as the boolean false.
+// a quoted "n" key is a string and the string key "false" is not replaced (it is rejected as any other key).
+func thresholdNodeKeys(v map[interface{}]interface{}) map[interface{}]interface{} {
+	val, ok := v[false]
+	if !ok {
+		return v
+	}
+	if _, ok := v["n"]; ok {
+		return v // both keys are rejected by isValidThresholdNode
+	}
+	v2 := make(map[interface{}]interface{}, len(v))
+	for key, keyVal := range v {
+		v2[key] = keyVal
+	}
+	delete(v2, false)
+	v2["n"] = val
+	return v2
+}
+
+func getThresholdNode(v2 map[string]interface{}, parentString string) (Node, error) {
+
+	err := isValidThresholdNode(v2)
+	if err != nil {
+		return nil, err
+	}
+
+	var n int
+	switch val := v2["n"].(type) {
+	case int:
+		n = val
+	case int64:
+		n = int(val)
+	case float64: // json numbers
+		if val != float64(int(val)) {
+			return nil, fmt.Errorf("n is not an integer [%v]", val)
+		}
+		n = int(val)
+	default:
+		return nil, fmt.Errorf("n is not an integer [%v]", val)
+	}
+
+	conditions, ok := v2["conditions"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("conditions of %v node are not an array", parentString)
+	}
+
+	var thresholdNode Node
+	switch parentString {
+	case "AT_LEAST":
+		thresholdNode = &AtLeast{N: n}
+	case "AT_MOST":
+		thresholdNode = &AtMost{N: n}
+	default:
+		thresholdNode = &Exactly{N: n}
+	}
+	for _, subNode := range conditions {
+		node, err := InterpretNode(subNode, "") // recursion!
+		if err != nil {
+			return nil, fmt.Errorf("can't parse subNode [%+v]: %v", subNode, err)
+		}
+		thresholdNode.Append(node)
+	}
+	if n < 0 || n > len(conditions) {
+		return nil, fmt.Errorf("invalid n [%v] in %v node with %v conditions", n, parentString, len(conditions))
+	}
+
+	return thresholdNode, nil
+}
+
 func isValidParentJsonpathAttribute(parentJsonpathAttribute string) bool {
 	flag1 := strings.HasPrefix(parentJsonpathAttribute, "jsonpath:.")
 	flag2 := strings.HasPrefix(parentJsonpathAttribute, "jsonpath:$.")
@@ -917,7 +1768,7 @@ func isValidParentJsonpathAttribute(parentJsonpathAttribute string) bool {
 func mapInterfaceToMapString(node map[interface{}]interface{}) map[string]interface{} {
 	node_out := make(map[string]interface{})
 	for k, val := range node {
-		node_out[k.(string)] = val
+		node_out[fmt.Sprint(k)] = val
 	}
 	return node_out
 }
@@ -975,9 +1826,21 @@ func getNodeByParentString(parentString string) (Node, error) {
 	case "NOT":
 		return &Not{}, nil
 
+	case "XOR":
+		return &Xor{}, nil
+
+	case "AT_LEAST", "AT_MOST", "EXACTLY":
+		return nil, fmt.Errorf("node of type AT_LEAST/AT_MOST/EXACTLY not according to spec")
+
 	case "ANY", "ALL":
 		return nil, fmt.Errorf("node of type ANY/ALL not according to spec")
 
+	case "COUNT":
+		return nil, fmt.Errorf("node of type COUNT not according to spec")
+
+	case "REF":
+		return nil, fmt.Errorf("node of type REF not according to spec")
+
 	default:
 		return nil, fmt.Errorf("node type not supported. possible error: array of conditions without AND,OR (etc) parent")
 	}
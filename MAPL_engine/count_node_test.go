@@ -0,0 +1,262 @@
+package MAPL_engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"go.mongodb.org/mongo-driver/bson"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+)
+
+const countNodeTestRules = `
+rules:
+  - ruleID: "root-containers"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      COUNT:
+        parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+        returnValueJsonpath:
+          name: "jsonpath:$RELATIVE.name"
+        method: GT
+        value: 2
+        condition:
+          attribute: "jsonpath:$RELATIVE.securityContext.runAsUser"
+          method: EQ
+          value: 0
+    decision: block
+
+  - ruleID: "probes"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      COUNT:
+        parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+        method: LT
+        value: 2
+        condition:
+          attribute: "jsonpath:$RELATIVE.livenessProbe"
+          method: EX
+    decision: block
+
+  - ruleID: "root-busybox"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      AND:
+      - attribute: "jsonpath:$.kind"
+        method: EQ
+        value: "Pod"
+      - COUNT:
+          parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+          method: EQ
+          value: 2
+          AND:
+          - attribute: "jsonpath:$RELATIVE.image"
+            method: EQ
+            value: "busybox"
+          - attribute: "jsonpath:$RELATIVE.securityContext.runAsUser"
+            method: EQ
+            value: 0
+    decision: alert
+`
+
+func TestCountNode(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test rules with COUNT nodes"
+		fmt.Println(str)
+
+		rules, err := YamlReadRulesFromString(countNodeTestRules)
+		So(err, ShouldBeNil)
+		messages, err := YamlReadMessagesFromFile("../files/messages/messages_base_jsonpath.yaml")
+		So(err, ShouldBeNil)
+		data, err := ReadBinaryFile("../files/raw_json_data/count/json_raw_data_4containers.json")
+		So(err, ShouldBeNil)
+		var dataInterface interface{}
+		err = json.Unmarshal(data, &dataInterface)
+		So(err, ShouldBeNil)
+
+		messageBytes := messages.Messages[0]
+		messageBytes.RequestJsonRaw = &data
+		messageInterface := messages.Messages[0]
+		messageInterface.RequestRawInterface = &dataInterface
+
+		for _, message := range []MessageAttributes{messageBytes, messageInterface} {
+			decision, _, _, results, _, _, extraData := Check(&message, &rules)
+			So(results, ShouldResemble, []int{BLOCK, DEFAULT, ALERT})
+			So(decision, ShouldEqual, BLOCK)
+			So(extraData[0], ShouldResemble, []map[string]interface{}{{"name": "c1"}, {"name": "c2"}, {"name": "c4"}}) // every root container
+		}
+
+		str = "test the trace of COUNT nodes"
+		fmt.Println(str)
+
+		result, err := CheckWithContext(context.Background(), &messageInterface, &rules, WithTrace())
+		So(err, ShouldBeNil)
+		countTrace := result.Trace.Rules[1].Conditions
+		So(countTrace.Type, ShouldEqual, "COUNT")
+		So(countTrace.Node, ShouldEqual, "$.spec.containers[:] LT 2")
+		So(countTrace.Value, ShouldEqual, 2)
+		So(countTrace.MatchedElements, ShouldResemble, []int{0, 2})
+		So(countTrace.Children, ShouldHaveLength, 4) // all of the elements are evaluated
+		So(result.Trace.String(), ShouldContainSubstring, "COUNT $.spec.containers[:] LT 2: false (value: 2) (matched elements: [0 2])")
+
+		str = "test the string, json and bson of COUNT nodes"
+		fmt.Println(str)
+
+		So(rules.Rules[1].Conditions.ConditionsTree.String(), ShouldEqual, "[COUNT<jsonpath:$.spec.containers[:];map[];LT-2>:<jsonpath:$RELATIVE.livenessProbe-EX->]")
+
+		for _, rule := range rules.Rules {
+			conditionsJson, err := json.Marshal(rule.Conditions)
+			So(err, ShouldBeNil)
+			var conditions ConditionsTree
+			err = json.Unmarshal(conditionsJson, &conditions)
+			So(err, ShouldBeNil)
+			So(conditions.ConditionsTree.String(), ShouldEqual, rule.Conditions.ConditionsTree.String())
+
+			conditionsBson, err := bson.Marshal(rule.Conditions)
+			So(err, ShouldBeNil)
+			conditions = ConditionsTree{}
+			err = bson.Unmarshal(conditionsBson, &conditions)
+			So(err, ShouldBeNil)
+			So(conditions.ConditionsTree.String(), ShouldEqual, rule.Conditions.ConditionsTree.String())
+		}
+
+		conditionsJson, err := json.Marshal(rules.Rules[1].Conditions)
+		So(err, ShouldBeNil)
+		So(string(conditionsJson), ShouldContainSubstring, `{"COUNT":{"parentJsonpathAttribute":"jsonpath:$.spec.containers[:]","method":"LT","value":2,"condition":`)
+
+		str = "test the mongo queries of COUNT nodes"
+		fmt.Println(str)
+
+		rule := rules.Rules[1].GetPreparedRule()
+		q, pipeline, err := rule.Conditions.ConditionsTree.ToMongoQuery("raw", "", 0)
+		So(err, ShouldBeNil)
+		So(pipeline, ShouldHaveLength, 1)
+		addFields := pipeline[0]["$addFields"].(bson.M)
+		So(addFields, ShouldHaveLength, 1)
+		for countField, count := range addFields {
+			So(strings.HasPrefix(countField, "addedField.count_"), ShouldBeTrue)
+			So(q, ShouldResemble, bson.M{countField: bson.M{"$lt": 2}})
+			filter := count.(bson.M)["$size"].(bson.M)["$filter"].(bson.M)
+			So(filter["input"], ShouldResemble, bson.M{"$ifNull": []interface{}{"$raw.spec.containers", []interface{}{}}})
+			So(filter["as"], ShouldEqual, "element")
+			So(filter["cond"], ShouldResemble, bson.M{"$ne": []interface{}{bson.M{"$type": "$$element.livenessProbe"}, "missing"}})
+		}
+
+		rule = rules.Rules[2].GetPreparedRule()
+		q, pipeline, err = rule.Conditions.ConditionsTree.ToMongoQuery("raw", "", 0)
+		So(err, ShouldBeNil)
+		So(pipeline, ShouldHaveLength, 1)
+		So(q["$and"], ShouldHaveLength, 2)
+		for _, count := range pipeline[0]["$addFields"].(bson.M) {
+			filter := count.(bson.M)["$size"].(bson.M)["$filter"].(bson.M)
+			So(filter["cond"], ShouldResemble, bson.M{"$and": []interface{}{
+				bson.M{"$eq": []interface{}{"$$element.image", "busybox"}},
+				bson.M{"$eq": []interface{}{"$$element.securityContext.runAsUser", 0.0}},
+			}})
+		}
+
+		for i := 0; i < 20; i++ { // the order of the expressions doesn't depend on the order of the map
+			expression, err := mongoOperatorsToExpression("$$element.replicas", bson.M{"$lte": 5.0, "$gt": 1.0, "$exists": true, "$ne": 3.0})
+			So(err, ShouldBeNil)
+			So(expression, ShouldResemble, bson.M{"$and": []interface{}{
+				bson.M{"$ne": []interface{}{bson.M{"$type": "$$element.replicas"}, "missing"}},
+				bson.M{"$and": []interface{}{bson.M{"$isNumber": "$$element.replicas"}, bson.M{"$gt": []interface{}{"$$element.replicas", 1.0}}}},
+				bson.M{"$and": []interface{}{bson.M{"$isNumber": "$$element.replicas"}, bson.M{"$lte": []interface{}{"$$element.replicas", 5.0}}}},
+				bson.M{"$ne": []interface{}{"$$element.replicas", 3.0}},
+			}})
+		}
+
+		var conditionsWithArray ConditionsTree
+		err = json.Unmarshal([]byte(`{"ANY":{"parentJsonpathAttribute":"jsonpath:$.spec.containers[:]","condition":{"COUNT":{"parentJsonpathAttribute":"jsonpath:$RELATIVE.ports[:]","method":"GT","value":0,"condition":{"condition":{"attribute":"jsonpath:$RELATIVE.containerPort","method":"EX"}}}}}}`), &conditionsWithArray)
+		So(err, ShouldBeNil)
+		_, _, err = conditionsWithArray.ConditionsTree.ToMongoQuery("raw", "", 0)
+		So(err, ShouldNotBeNil) // COUNT within array is not supported
+
+		str = "test COUNT nodes on a missing array"
+		fmt.Println(str)
+
+		messagesWithoutArray := methodTestMessages(messages.Messages[0], `{"kind":"Pod","spec":{}}`)
+		for _, testCase := range []struct {
+			method   string
+			value    int
+			expected bool
+		}{
+			{"LT", 2, true}, // a missing array has no elements (as the $ifNull of the mongo query)
+			{"LE", 0, true},
+			{"EQ", 0, true},
+			{"GT", 0, false},
+			{"NEQ", 0, false},
+		} {
+			c := normalizeTestConditionsTree(fmt.Sprintf(`
+COUNT:
+  parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+  method: %v
+  value: %v
+  condition:
+    attribute: "jsonpath:$RELATIVE.livenessProbe"
+    method: EX`, testCase.method, testCase.value))
+			err = c.ConditionsTree.PrepareAndValidate(PredefinedStringsAndLists{})
+			So(err, ShouldBeNil)
+			testEvalOnMessages(c.ConditionsTree, testCase.expected, messagesWithoutArray)
+		}
+
+		str = "test invalid COUNT nodes"
+		fmt.Println(str)
+
+		invalidConditions := []string{
+			`{"COUNT":{"parentJsonpathAttribute":"jsonpath:$.spec.containers[:]","method":"XX","value":2,"condition":{"condition":{"attribute":"jsonpath:$RELATIVE.name","method":"EX"}}}}`,
+			`{"COUNT":{"parentJsonpathAttribute":"jsonpath:$.spec.containers[:]","method":"GT","value":-1,"condition":{"condition":{"attribute":"jsonpath:$RELATIVE.name","method":"EX"}}}}`,
+			`{"COUNT":{"parentJsonpathAttribute":"jsonpath:$.spec.containers[:]","method":"GT","value":1.5,"condition":{"condition":{"attribute":"jsonpath:$RELATIVE.name","method":"EX"}}}}`,
+			`{"COUNT":{"parentJsonpathAttribute":"jsonpath:$.spec.containers[:]","method":"GT","value":"abc","condition":{"condition":{"attribute":"jsonpath:$RELATIVE.name","method":"EX"}}}}`,
+			`{"COUNT":{"parentJsonpathAttribute":"jsonpath:$.spec.containers[:]","value":2,"condition":{"condition":{"attribute":"jsonpath:$RELATIVE.name","method":"EX"}}}}`,
+			`{"COUNT":{"parentJsonpathAttribute":"jsonpath:$.spec.containers[:]","method":"GT","value":2}}`,
+			`{"COUNT":{"parentJsonpathAttribute":"spec.containers[:]","method":"GT","value":2,"condition":{"condition":{"attribute":"jsonpath:$RELATIVE.name","method":"EX"}}}}`,
+		}
+		for _, invalidCondition := range invalidConditions {
+			var conditions ConditionsTree
+			err = json.Unmarshal([]byte(invalidCondition), &conditions)
+			if err == nil {
+				err = conditions.ConditionsTree.PrepareAndValidate(PredefinedStringsAndLists{})
+			}
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
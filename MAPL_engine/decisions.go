@@ -0,0 +1,216 @@
+package MAPL_engine
+
+import (
+	"fmt"
+)
+
+//--------------------------------------
+// User-Defined Decisions and Obligations
+//--------------------------------------
+
+// DecisionDefinition declares a user-defined decision in the header of the rules
+type DecisionDefinition struct {
+	Name     string  `yaml:"name" json:"name" bson:"name"`
+	Severity float64 `yaml:"severity" json:"severity" bson:"severity"`                         // decisions with larger severity override decisions with smaller severity (allow=1, alert=2, block=3)
+	Effect   string  `yaml:"effect,omitempty" json:"effect,omitempty" bson:"effect,omitempty"` // allow, alert or block (alert by default). used by the allow-overrides and deny-overrides combining algorithms
+}
+
+// Obligation is a structured payload that a rule returns alongside its decision (for example, a notification channel or a ticket template)
+type Obligation struct {
+	Type    string                 `yaml:"type" json:"type" bson:"type" structs:"type"`
+	Payload map[string]interface{} `yaml:"payload,omitempty" json:"payload,omitempty" bson:"payload,omitempty" structs:"payload,omitempty"`
+}
+
+func (o *Obligation) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var aux struct {
+		Type    string                 `yaml:"type"`
+		Payload map[string]interface{} `yaml:"payload,omitempty"`
+	}
+	if err := unmarshal(&aux); err != nil {
+		return err
+	}
+	o.Type = aux.Type
+	o.Payload = nil
+	if aux.Payload != nil {
+		o.Payload = convertYamlMap(aux.Payload).(map[string]interface{}) // yaml gives map[interface{}]interface{} which can't be marshalled to json
+	}
+	return nil
+}
+
+// convertYamlMap converts the nested map[interface{}]interface{} of yaml to map[string]interface{}
+func convertYamlMap(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			out[fmt.Sprintf("%v", key)] = convertYamlMap(val)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			out[key] = convertYamlMap(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, val := range v {
+			out[i] = convertYamlMap(val)
+		}
+		return out
+	}
+	return v
+}
+
+// decisionVocabulary holds the built-in and the user-defined decisions.
+// the code of a decision is its index. the user-defined decisions follow the built-in decisions (DEFAULT, ALLOW, ALERT, BLOCK, NONE).
+type decisionVocabulary struct {
+	names     []string
+	severity  []float64
+	effect    []int // the built-in decision that has the same effect
+	userCodes map[string]int
+}
+
+var builtinDecisionVocabulary = decisionVocabulary{
+	names:     DecisionNames[:],
+	severity:  []float64{DEFAULT: 0, ALLOW: 1, ALERT: 2, BLOCK: 3, NONE: 0},
+	effect:    []int{DEFAULT: DEFAULT, ALLOW: ALLOW, ALERT: ALERT, BLOCK: BLOCK, NONE: NONE},
+	userCodes: map[string]int{},
+}
+
+func newDecisionVocabulary(definitions []DecisionDefinition) (decisionVocabulary, error) {
+
+	if len(definitions) == 0 {
+		return builtinDecisionVocabulary, nil
+	}
+
+	v := decisionVocabulary{
+		names:     append([]string{}, builtinDecisionVocabulary.names...),
+		severity:  append([]float64{}, builtinDecisionVocabulary.severity...),
+		effect:    append([]int{}, builtinDecisionVocabulary.effect...),
+		userCodes: make(map[string]int, len(definitions)),
+	}
+	for _, definition := range definitions {
+		if definition.Name == "" {
+			return builtinDecisionVocabulary, fmt.Errorf("decision without a name")
+		}
+		if code := builtinDecisionVocabulary.code(definition.Name); code != -1 {
+			return builtinDecisionVocabulary, fmt.Errorf("decision is already defined [%v]", definition.Name)
+		}
+		if _, ok := v.userCodes[definition.Name]; ok {
+			return builtinDecisionVocabulary, fmt.Errorf("decision is defined twice [%v]", definition.Name)
+		}
+		if definition.Severity <= 0 {
+			return builtinDecisionVocabulary, fmt.Errorf("decision severity must be positive [%v]", definition.Name)
+		}
+		effect := ALERT
+		switch definition.Effect {
+		case "":
+		case "allow", "ALLOW", "Allow":
+			effect = ALLOW
+		case "alert", "ALERT", "Alert":
+			effect = ALERT
+		case "block", "BLOCK", "Block":
+			effect = BLOCK
+		default:
+			return builtinDecisionVocabulary, fmt.Errorf("decision effect not supported [%v]", definition.Effect)
+		}
+
+		v.userCodes[definition.Name] = len(v.names)
+		v.names = append(v.names, definition.Name)
+		v.severity = append(v.severity, definition.Severity)
+		v.effect = append(v.effect, effect)
+	}
+	return v, nil
+}
+
+// code gives the code of the decision (-1 if the decision is not supported)
+func (v decisionVocabulary) code(decision string) int {
+	switch decision {
+	case "allow", "ALLOW", "Allow":
+		return ALLOW
+	case "alert", "ALERT", "Alert":
+		return ALERT
+	case "block", "BLOCK", "Block":
+		return BLOCK
+	}
+	if code, ok := v.userCodes[decision]; ok {
+		return code
+	}
+	return -1
+}
+
+// validateDecisions tests the user-defined decisions and that every rule's decision is defined
+func validateDecisions(rules *Rules) error {
+	v, err := newDecisionVocabulary(rules.Decisions)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules.Rules {
+		if rule.Decision != "" && v.code(rule.Decision) == -1 {
+			return fmt.Errorf("decision not supported [%v] in rule %v", rule.Decision, rule.RuleID)
+		}
+	}
+	if rules.NoMatchDecision != "" && v.code(rules.NoMatchDecision) == -1 {
+		return fmt.Errorf("no-match decision not supported [%v]", rules.NoMatchDecision)
+	}
+	if rules.ErrorDecision != "" && v.code(rules.ErrorDecision) == -1 {
+		return fmt.Errorf("error decision not supported [%v]", rules.ErrorDecision)
+	}
+	return nil
+}
+
+//--------------------------------------
+// No-Match and Error Decisions
+//--------------------------------------
+
+// Outcome tells how the decision of a check was reached
+type Outcome string
+
+const (
+	OutcomeMatch   Outcome = "match"    // the decision is the decision of a rule that applies to the message
+	OutcomeNoMatch Outcome = "no-match" // no rule applies to the message. the decision is the no-match decision
+	OutcomeError   Outcome = "error"    // the decision is the decision of a rule whose evaluation failed, or no rule applies and the evaluation of some rules failed
+)
+
+// getNoMatchAndErrorDecisions gives the codes of the no-match decision (DEFAULT if not set) and of the error decision (-1 if not set)
+func (p *PolicySet) getNoMatchAndErrorDecisions(opts checkOptions) (int, int, error) {
+
+	noMatchDecision, errorDecision := DEFAULT, -1
+	if opts.ignoreDefaultsErr {
+		return noMatchDecision, errorDecision, nil
+	}
+	if decision := opts.getNoMatchDecision(p.rules); decision != "" {
+		noMatchDecision = p.decisions.code(decision)
+		if noMatchDecision == -1 {
+			return DEFAULT, -1, fmt.Errorf("no-match decision not supported [%v]", decision)
+		}
+	}
+	if decision := opts.getErrorDecision(p.rules); decision != "" {
+		errorDecision = p.decisions.code(decision)
+		if errorDecision == -1 {
+			return DEFAULT, -1, fmt.Errorf("error decision not supported [%v]", decision)
+		}
+	}
+	return noMatchDecision, errorDecision, nil
+}
+
+// setOutcome sets the outcome of the result (and the no-match decision if no rule gives the decision)
+func setOutcome(result *Result, p *PolicySet, ruleErrors []error, noMatchDecision int) {
+
+	switch {
+	case result.RelevantRuleIndex >= 0 && ruleErrors[result.RelevantRuleIndex] != nil:
+		result.Outcome = OutcomeError
+	case result.RelevantRuleIndex >= 0:
+		result.Outcome = OutcomeMatch
+	case len(result.Errors) > 0:
+		result.Outcome = OutcomeError
+	default:
+		result.Outcome = OutcomeNoMatch
+	}
+
+	if result.RelevantRuleIndex == -1 {
+		result.Decision = noMatchDecision
+		result.DecisionString = p.decisions.names[noMatchDecision]
+	}
+}
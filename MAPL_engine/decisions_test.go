@@ -0,0 +1,198 @@
+package MAPL_engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+const decisionsTestHeader = `
+decisions:
+  - name: warn
+    severity: 1.5
+    effect: allow
+  - name: quarantine
+    severity: 4
+    effect: block
+`
+
+const decisionsTestRules = `
+rules:
+  - ruleID: "warn"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "*"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "*"
+    protocol: http
+    resource:
+      resourceType: path
+      resourceName: "/*"
+    operation: GET
+    decision: warn
+    obligations:
+      - type: notify
+        payload:
+          channel: "#security"
+          template:
+            title: "access to B"
+            labels: ["a", "b"]
+
+  - ruleID: "allow"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "*"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "*"
+    protocol: http
+    resource:
+      resourceType: path
+      resourceName: "/*"
+    operation: GET
+    decision: allow
+
+  - ruleID: "quarantine"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "*"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "*"
+    protocol: http
+    resource:
+      resourceType: path
+      resourceName: "/admin/*"
+    operation: GET
+    decision: quarantine
+    obligations:
+      - type: ticket
+        payload:
+          queue: "SEC"
+`
+
+const decisionsTestMessages = `
+messages:
+- message_id: 0
+  sender_service: A.my_namespace
+  receiver_service: B.my_namespace
+  request_protocol: HTTP
+  request_path: /book/123
+  request_method: GET
+  request_time: 2018-07-29T14:30:00-07:00
+- message_id: 1
+  sender_service: A.my_namespace
+  receiver_service: B.my_namespace
+  request_protocol: HTTP
+  request_path: /admin/123
+  request_method: GET
+  request_time: 2018-07-29T14:30:00-07:00
+`
+
+func TestUserDefinedDecisions(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		rules, err := YamlReadRulesFromString(decisionsTestHeader + decisionsTestRules)
+		So(err, ShouldBeNil)
+		messages, err := YamlReadMessagesFromString(decisionsTestMessages)
+		So(err, ShouldBeNil)
+
+		str := "test user-defined decisions and their severities"
+		fmt.Println(str)
+
+		message := messages.Messages[0]
+		result, err := CheckWithContext(context.Background(), &message, &rules)
+		So(err, ShouldBeNil)
+		So(result.Errors, ShouldBeEmpty)
+		So(result.DecisionString, ShouldEqual, "warn")
+		So(result.RelevantRuleIndex, ShouldEqual, 0)
+		So(result.Decision, ShouldBeGreaterThan, NONE)
+		So(result.Results[1], ShouldEqual, ALLOW)
+
+		decision, decisionString, _, _, _, _, _ := Check(&message, &rules)
+		So(decision, ShouldEqual, result.Decision)
+		So(decisionString, ShouldEqual, "warn")
+
+		message = messages.Messages[1]
+		result, err = CheckWithContext(context.Background(), &message, &rules)
+		So(err, ShouldBeNil)
+		So(result.DecisionString, ShouldEqual, "quarantine")
+		So(result.RelevantRuleIndex, ShouldEqual, 2)
+
+		result, err = CheckWithContext(context.Background(), &message, &rules, WithCombiningAlgorithm(AllowOverrides)) // warn has the allow effect and a larger severity than allow
+		So(err, ShouldBeNil)
+		So(result.DecisionString, ShouldEqual, "warn")
+
+		result, err = CheckWithContext(context.Background(), &message, &rules, WithCombiningAlgorithm(FirstApplicable))
+		So(err, ShouldBeNil)
+		So(result.DecisionString, ShouldEqual, "warn")
+
+		str = "test user-defined decisions of a single rule"
+		fmt.Println(str)
+
+		message = messages.Messages[0]
+		decision, _ = CheckOneRule(&message, &rules.Rules[0]) // a single rule supports only the built-in decisions
+		So(decision, ShouldEqual, DEFAULT)
+		decision, _ = rules.Rules[0].Check(&message)
+		So(decision, ShouldEqual, DEFAULT)
+		decision, _ = CheckOneRule(&message, &rules.Rules[1])
+		So(decision, ShouldEqual, ALLOW)
+		_, decisionString, _, results, _, _, _ := Check(&message, &rules) // the decisions of the rules in the rule set's decisions
+		So(decisionString, ShouldEqual, "warn")
+		So(results[0], ShouldBeGreaterThan, NONE)
+
+		str = "test obligations"
+		fmt.Println(str)
+
+		message = messages.Messages[0]
+		result, err = CheckWithContext(context.Background(), &message, &rules)
+		So(err, ShouldBeNil)
+		So(result.Obligations, ShouldHaveLength, 1)
+		So(result.Obligations[0].Type, ShouldEqual, "notify")
+		So(result.Obligations[0].Payload["channel"], ShouldEqual, "#security")
+		So(result.Obligations[0].Payload["template"], ShouldResemble, map[string]interface{}{"title": "access to B", "labels": []interface{}{"a", "b"}})
+
+		resultJson, err := json.Marshal(result)
+		So(err, ShouldBeNil)
+		So(string(resultJson), ShouldContainSubstring, `"obligations":[{"type":"notify","payload":{"channel":"#security"`)
+
+		message = messages.Messages[1]
+		result, err = CheckWithContext(context.Background(), &message, &rules)
+		So(err, ShouldBeNil)
+		So(result.Obligations, ShouldResemble, []Obligation{{Type: "ticket", Payload: map[string]interface{}{"queue": "SEC"}}})
+
+		str = "test invalid decisions"
+		fmt.Println(str)
+
+		_, err = YamlReadRulesFromString(decisionsTestRules) // warn and quarantine are not defined
+		So(err, ShouldNotBeNil)
+
+		invalidHeaders := []string{
+			"decisions:\n  - name: block\n    severity: 4\n",
+			"decisions:\n  - name: warn\n    severity: 1.5\n  - name: warn\n    severity: 2\n",
+			"decisions:\n  - name: warn\n    severity: 0\n",
+			"decisions:\n  - name: warn\n    severity: 1.5\n    effect: deny\n",
+			"decisions:\n  - severity: 1.5\n",
+		}
+		for _, header := range invalidHeaders {
+			_, err = YamlReadRulesFromString(header + "rules: []\n")
+			So(err, ShouldNotBeNil)
+		}
+
+		rules.Rules[1].Decision = "no-such-decision" // not validated when changed after loading
+		result, err = CheckWithContext(context.Background(), &message, &rules)
+		So(err, ShouldBeNil)
+		So(result.Errors, ShouldHaveLength, 1)
+		So(result.Errors[0].RuleIndex, ShouldEqual, 1)
+		So(result.Results[1], ShouldEqual, DEFAULT)
+	})
+}
@@ -4,4 +4,8 @@ type PredefinedStringsAndLists struct {
 	PredefinedStrings map[string]string `yaml:"predefinedStrings,omitempty" json:"predefinedStrings,omitempty" bson:"predefinedStrings" structs:"predefinedStrings,omitempty"`
 	PredefinedLists map[string][]string `yaml:"predefinedLists,omitempty" json:"predefinedLists,omitempty" bson:"predefinedLists" structs:"predefinedLists,omitempty"`
 	PredefinedListsWithoutRefs map[string][]string `yaml:"-,omitempty" json:"-,omitempty" bson:"predefinedListsWithoutRefs" structs:"predefinedListsWithoutRefs,omitempty"`
+	PredefinedConditions map[string]ConditionsTree `yaml:"predefinedConditions,omitempty" json:"predefinedConditions,omitempty" bson:"predefinedConditions" structs:"predefinedConditions,omitempty"` // named fragments of conditions trees (referenced with REF)
+
+	resolvedConditions        []string // the predefined conditions that are being resolved (to detect cycles)
+	allowUnresolvedConditions bool     // references to missing predefined conditions are left unresolved instead of being an error (see ValidateRule)
 }
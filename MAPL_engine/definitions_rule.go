@@ -9,6 +9,7 @@ import (
 	"net"
 	"regexp"
 	"strings"
+	"time"
 )
 
 // -------------------rules-------------------------------------
@@ -59,6 +60,11 @@ type Condition struct {
 	ValueFloat       *float64       `yaml:"-" json:"-,omitempty" bson:"valueFloat,omitempty" structs:"valueFloat,omitempty"`
 	ValueRegex       *regexp.Regexp `yaml:"-" json:"-,omitempty" bson:"valueRegex,omitempty" structs:"valueRegex,omitempty"`
 	ValueStringRegex *regexp.Regexp `yaml:"-" json:"-,omitempty" bson:"valueStringRegex,omitempty" structs:"valueStringRegex,omitempty"`
+	ValueSemverRange semverRange    `yaml:"-" json:"-,omitempty" bson:"-"` // the prepared value of the SEMVER methods
+	ValueCIDRs       []net.IPNet    `yaml:"-" json:"-,omitempty" bson:"-"` // the prepared value of the IN_CIDR/NIN_CIDR methods
+	ValueTime        *time.Time     `yaml:"-" json:"-,omitempty" bson:"-"` // the prepared value of the BEFORE/AFTER methods
+	ValueDuration    *time.Duration `yaml:"-" json:"-,omitempty" bson:"-"` // the prepared value of the OLDER_THAN/NEWER_THAN methods
+	ValueTypes       []string       `yaml:"-" json:"-,omitempty" bson:"-"` // the prepared value of the IS_TYPE method
 
 	AttributeIsSenderLabel    bool   `yaml:"-" json:"-,omitempty" bson:"attributeIsSenderLabel,omitempty" structs:"attributeIsSenderLabel,omitempty"`
 	AttributeSenderLabelKey   string `yaml:"-" json:"-,omitempty" bson:"attributeSenderLabelKey,omitempty" structs:"attributeSenderLabelKey,omitempty"`
@@ -79,6 +85,11 @@ type Condition struct {
 	AttributeJsonpathQuery      string              `yaml:"-" json:"-,omitempty" bson:"attributeJsonpathQuery,omitempty" structs:"attributeJsonpathQuery,omitempty"`
 	PreparedJsonpathQuery       jsonpath.FilterFunc `yaml:"-" json:"-,omitempty"`
 
+	ValueIsJsonpath            bool                `yaml:"-" json:"-,omitempty" bson:"valueIsJsonpath,omitempty" structs:"valueIsJsonpath,omitempty"` // the value is a reference to another field of the data (compared to the attribute)
+	ValueIsJsonpathRelative    bool                `yaml:"-" json:"-,omitempty" bson:"valueIsJsonpathRelative,omitempty" structs:"valueIsJsonpathRelative,omitempty"`
+	ValueJsonpathQuery         string              `yaml:"-" json:"-,omitempty" bson:"valueJsonpathQuery,omitempty" structs:"valueJsonpathQuery,omitempty"`
+	PreparedValueJsonpathQuery jsonpath.FilterFunc `yaml:"-" json:"-,omitempty"`
+
 	ReturnValueJsonpath                          map[string]string              `yaml:"-" json:"returnValueJsonpath,omitempty" bson:"returnValueJsonpath,omitempty"`
 	ReturnValueJsonpathOriginal                  map[string]string              `yaml:"-" json:"returnValueJsonpathOriginal,omitempty" bson:"returnValueJsonpath,omitempty"`
 	PreparedReturnValueJsonpathQuery             map[string]jsonpath.FilterFunc `yaml:"-" json:"-,omitempty"`
@@ -104,21 +115,28 @@ type Rule struct {
 
 	Decision string `yaml:"decision,omitempty" json:"decision,omitempty" bson:"decision" structs:"decision,omitempty"`
 
+	Obligations []Obligation `yaml:"obligations,omitempty" json:"obligations,omitempty" bson:"obligations,omitempty" structs:"obligations,omitempty"` // returned alongside the decision when the rule gives the decision
+
 	Metadata map[string]string `yaml:"metadata,omitempty" json:"metadata,omitempty" bson:"metadata" structs:"metadata,omitempty"`
 
 	Hash string `yaml:"hash,omitempty" json:"hash,omitempty" bson:"hash" structs:"hash,omitempty"`
 
-	OperationRegex                    *regexp.Regexp `yaml:"operationRegex,omitempty" json:"operationRegex,omitempty" bson:"operationRegex,omitempty" structs:"operationRegex,omitempty"`
+	OperationRegex                    *regexp.Regexp `yaml:"-" json:"operationRegex,omitempty" bson:"operationRegex,omitempty" structs:"operationRegex,omitempty"`
 	AlreadyConvertedFieldsToRegexFlag bool           `yaml:"-,omitempty" json:"-,omitempty" bson:"-,omitempty" structs:"-,omitempty"` // default is false
 
 	predefinedStringsAndLists PredefinedStringsAndLists
 	ruleAlreadyPrepared       bool
 	preparedRule              *Rule
+	preparationErr            error // the error of the preparation by a check (see Rules.prepare). reset by SetPredefinedStringsAndLists
 }
 
 // Rules structure contains a list of rules
 type Rules struct {
-	Rules []Rule `yaml:"rules,omitempty" json:"rules,omitempty"`
+	CombiningAlgorithm CombiningAlgorithm   `yaml:"combiningAlgorithm,omitempty" json:"combiningAlgorithm,omitempty"` // how the decisions of the rules are combined (max-decision by default)
+	Decisions          []DecisionDefinition `yaml:"decisions,omitempty" json:"decisions,omitempty"`                   // user-defined decisions (in addition to allow, alert and block)
+	NoMatchDecision    string               `yaml:"noMatchDecision,omitempty" json:"noMatchDecision,omitempty"`       // the decision when no rule applies to the message (DEFAULT if empty)
+	ErrorDecision      string               `yaml:"errorDecision,omitempty" json:"errorDecision,omitempty"`           // the decision of rules whose evaluation failed (the result of the evaluation if empty)
+	Rules              []Rule               `yaml:"rules,omitempty" json:"rules,omitempty"`
 }
 
 type ConditionNode struct {
@@ -281,37 +299,39 @@ func (c *Condition) String() string {
 	return fmt.Sprintf("<%v-%v-%v>", stringAttribute, stringMethod, stringValue)
 }
 
-func (c *Condition) MarshalJSON() ([]byte, error) {
+// conditionDocument is the serialized form of a condition. it keeps the original attribute, method and value (before IN is converted to RE etc.)
+type conditionDocument struct {
+	Attribute           string            `yaml:"attribute" json:"attribute"`
+	Method              string            `yaml:"method" json:"method"`
+	Value               string            `yaml:"value,omitempty" json:"value"`
+	ReturnValueJsonpath map[string]string `yaml:"returnValueJsonpath,omitempty" json:"returnValueJsonpath,omitempty"`
+}
+
+func (c *Condition) document() conditionDocument {
 
-	attributeString := c.Attribute
+	doc := conditionDocument{Attribute: c.Attribute, Method: c.Method, Value: c.Value, ReturnValueJsonpath: c.ReturnValueJsonpath}
 	if len(c.OriginalAttribute) > 0 {
-		attributeString = c.OriginalAttribute
+		doc.Attribute = c.OriginalAttribute
 	}
-	attributeString = strings.Replace(attributeString, "\\", "\\\\", -1)
-	attributeString = strings.Replace(attributeString, "\"", "\\\"", -1)
-
-	methodString := c.Method
 	if len(c.OriginalMethod) > 0 {
-		methodString = c.OriginalMethod
+		doc.Method = c.OriginalMethod
 	}
-
-	valueString := c.Value
 	if len(c.OriginalValue) > 0 {
-		valueString = c.OriginalValue
+		doc.Value = c.OriginalValue
 	}
-	valueString = strings.Replace(valueString, "\\", "\\\\", -1)
-	valueString = strings.Replace(valueString, "\"", "\\\"", -1)
-
-	returnValueJsonpath := c.ReturnValueJsonpath
 	if len(c.ReturnValueJsonpathOriginal) > 0 {
-		returnValueJsonpath = c.ReturnValueJsonpathOriginal
+		doc.ReturnValueJsonpath = c.ReturnValueJsonpathOriginal
 	}
+	return doc
+}
 
-	str := fmt.Sprintf(`{"condition":{"attribute":"%v","method":"%v","value":"%v"}}`, attributeString, methodString, valueString)
+func (c *Condition) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Condition conditionDocument `json:"condition"`
+	}{c.document()})
+}
 
-	if returnValueJsonpath != nil {
-		returnValueJsonpathJson, _ := json.Marshal(returnValueJsonpath)
-		str = fmt.Sprintf(`{"condition":{"attribute":"%v","method":"%v","value":"%v","returnValueJsonpath":%v}}`, attributeString, methodString, valueString, string(returnValueJsonpathJson))
-	}
-	return []byte(str), nil
+// MarshalYAML returns the condition in the syntax of the rules files (attribute, method and value without a "condition" key)
+func (c *Condition) MarshalYAML() (interface{}, error) {
+	return c.document(), nil
 }
@@ -0,0 +1,86 @@
+package MAPL_engine
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"go.mongodb.org/mongo-driver/bson"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+var globTestCases = []conditionMethodTestCase{
+	{"jsonpath:$.spec.image", "GLOB", "registry.io/*", false}, // "*" doesn't match "/"
+	{"jsonpath:$.spec.image", "GLOB", "registry.io/**", true},
+	{"jsonpath:$.spec.image", "GLOB", "registry.io/*/nginx:*", true},
+	{"jsonpath:$.spec.image", "GLOB", "registry.io/*/nginx:1.2?", true},
+	{"jsonpath:$.spec.image", "GLOB", "registry.io/*/nginx:1.[0-1]*", false},
+	{"jsonpath:$.spec.image", "GLOB", "registry.io/*/nginx:1.[!0-1]*", true},
+	{"jsonpath:$.spec.image", "NGLOB", "registry.io/**", false},
+	{"jsonpath:$.spec.image", "nglob", "docker.io/**", true},
+	{"jsonpath:$.spec.image", "GLOB", "library/**", false}, // the pattern is anchored
+	{"jsonpath:$.spec.path", "GLOB", "/var/**/*.log", true},
+	{"jsonpath:$.spec.path", "GLOB", "/var/*.log", false},
+	{"jsonpath:$.spec.path", "GLOB", `/var/log/\[app\]/*.log`, true},
+	{"jsonpath:$.spec.path", "GLOB", `/var/log/[][]app[]]/*.log`, true},
+	{"jsonpath:$.missing", "NGLOB", "*", false},
+	{"senderLabel[app]", "GLOB", "front*", true},
+	{"receiverLabel[team]", "NGLOB", "dev?ps", false},
+	{"$sender.namespace", "GLOB", "prod-*", true},
+	{"requestUseragent", "GLOB", "Mozilla/5.0 (**", true},
+	{"domain", "GLOB", "*.example.com", true},
+	{"domain", "GLOB", "*.com", true}, // "*" matches dots (only "/" separates the parts of a path)
+}
+
+func TestGlob(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test the glob methods"
+		fmt.Println(str)
+
+		messages := methodTestMessages(MessageAttributes{
+			SourceLabels:      map[string]string{"app": "frontend"},
+			DestinationLabels: map[string]string{"team": "devops"},
+			SourceNamespace:   "prod-web",
+			RequestUseragent:  "Mozilla/5.0 (X11; Linux x86_64)",
+			Domain:            "api.example.com",
+		}, `{"spec":{"image":"registry.io/library/nginx:1.25","path":"/var/log/[app]/error.log"}}`)
+		testConditionMethods(globTestCases, PredefinedStringsAndLists{}, messages)
+		testConditionMethodsStrings(globTestCases)
+
+		str = "test the negation and the mongo queries of the glob methods"
+		fmt.Println(str)
+
+		c := normalizeTestConditionsTree(`
+NOT:
+  attribute: "jsonpath:$.spec.image"
+  method: GLOB
+  value: "registry.io/**"`)
+		So(NormalizeWithNegatedMethods(c.ConditionsTree).String(), ShouldEqual, "<jsonpath:$.spec.image-NGLOB-registry.io/**>")
+
+		g := Condition{Attribute: "jsonpath:$.spec.image", Method: "GLOB", Value: "registry.io/*:1.?"}
+		err := g.PrepareAndValidate(PredefinedStringsAndLists{})
+		So(err, ShouldBeNil)
+		q, _, err := g.ToMongoQuery("raw", "", 0)
+		So(err, ShouldBeNil)
+		So(q, ShouldResemble, bson.M{"raw.spec.image": bson.M{"$regex": `^registry\.io/[^/]*:1\.[^/]$`}})
+
+		str = "test the validation of the glob methods"
+		fmt.Println(str)
+
+		for _, invalid := range []Condition{
+			{Attribute: "jsonpath:$.spec.image", Method: "GLOB", Value: ""},
+			{Attribute: "jsonpath:$.spec.image", Method: "GLOB", Value: "registry.io/[a-"},
+			{Attribute: "jsonpath:$.spec.image", Method: "NGLOB", Value: `registry.io/\`},
+			{Attribute: "jsonpath:$.spec.image", Method: "GLOB", Value: "[z-a]*"},
+			{Attribute: "payloadSize", Method: "GLOB", Value: "1*"},
+		} {
+			_, err = ValidateOneCondition(&invalid)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
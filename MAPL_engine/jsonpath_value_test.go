@@ -0,0 +1,160 @@
+package MAPL_engine
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+const jsonpathValueTestData = `{
+  "kind": "Deployment",
+  "metadata": {"name": "a", "labels": {"app": "a", "team": "b"}},
+  "spec": {
+    "replicas": 3,
+    "maxReplicas": 5,
+    "minReplicas": "3",
+    "template": {"spec": {"containers": [
+      {"name": "a", "resources": {"limits": {"memory": "1Gi"}, "requests": {"memory": "512Mi"}}},
+      {"name": "b", "resources": {"limits": {"memory": "256Mi"}, "requests": {"memory": "0.5Gi"}}}
+    ]}}
+  }
+}`
+
+var jsonpathValueTestCases = []struct {
+	conditions string
+	expected   bool
+}{
+	{conditions: `
+attribute: "jsonpath:$.spec.replicas"
+method: LE
+value: "jsonpath:$.spec.maxReplicas"`, expected: true},
+	{conditions: `
+attribute: "jsonpath:$.spec.replicas"
+method: GT
+value: "jsonpath:$.spec.maxReplicas"`, expected: false},
+	{conditions: ` # a number in a string
+attribute: "jsonpath:$.spec.replicas"
+method: EQ
+value: "jsonpath:$.spec.minReplicas"`, expected: true},
+	{conditions: `
+attribute: "jsonpath:$.metadata.name"
+method: EQ
+value: "jsonpath:$.metadata.labels.app"`, expected: true},
+	{conditions: `
+attribute: "jsonpath:$.metadata.name"
+method: NEQ
+value: "jsonpath:$.metadata.labels['team']"`, expected: true},
+	{conditions: ` # strings are compared only with EQ and NEQ
+attribute: "jsonpath:$.kind"
+method: GT
+value: "jsonpath:$.metadata.name"`, expected: false},
+	{conditions: ` # a missing field
+attribute: "jsonpath:$.spec.replicas"
+method: NEQ
+value: "jsonpath:$.spec.missing"`, expected: false},
+	{conditions: ` # units
+ANY:
+  parentJsonpathAttribute: "jsonpath:$.spec.template.spec.containers[:]"
+  condition:
+    attribute: "jsonpath:$RELATIVE.resources.limits.memory"
+    method: GE
+    value: "jsonpath:$RELATIVE.resources.requests.memory"`, expected: true},
+	{conditions: `
+ALL:
+  parentJsonpathAttribute: "jsonpath:$.spec.template.spec.containers[:]"
+  condition:
+    attribute: "jsonpath:$RELATIVE.resources.limits.memory"
+    method: GE
+    value: "jsonpath:$RELATIVE.resources.requests.memory"`, expected: false},
+	{conditions: ` # an absolute reference inside an ANY node
+ANY:
+  parentJsonpathAttribute: "jsonpath:$.spec.template.spec.containers[:]"
+  condition:
+    attribute: "jsonpath:$RELATIVE.name"
+    method: EQ
+    value: "jsonpath:$.metadata.labels.team"`, expected: true},
+	{conditions: `
+ALL:
+  parentJsonpathAttribute: "jsonpath:$.spec.template.spec.containers[:]"
+  condition:
+    attribute: "jsonpath:$RELATIVE.name"
+    method: EQ
+    value: "jsonpath:$.metadata.name"`, expected: false},
+}
+
+func TestJsonpathValue(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test conditions that compare two fields of the data"
+		fmt.Println(str)
+
+		data := []byte(jsonpathValueTestData)
+		var dataInterface interface{}
+		err := json.Unmarshal(data, &dataInterface)
+		So(err, ShouldBeNil)
+		messageWithInterface := MessageAttributes{RequestJsonRaw: &data, RequestRawInterface: &dataInterface}
+		messageWithBytes := MessageAttributes{RequestJsonRaw: &data}
+
+		for _, testCase := range jsonpathValueTestCases {
+			c := normalizeTestConditionsTree(testCase.conditions)
+			err = c.ConditionsTree.PrepareAndValidate(PredefinedStringsAndLists{})
+			So(err, ShouldBeNil)
+
+			flag, _ := c.ConditionsTree.Eval(&messageWithInterface)
+			So(flag, ShouldEqual, testCase.expected)
+			flag, _ = c.ConditionsTree.Eval(&messageWithBytes)
+			So(flag, ShouldEqual, testCase.expected)
+
+			yamlBytes, err := yaml.Marshal(c)
+			So(err, ShouldBeNil)
+			So(normalizeTestConditionsTree(string(yamlBytes)).ConditionsTree.String(), ShouldEqual, c.ConditionsTree.String())
+		}
+
+		str = "test the validation of jsonpath values"
+		fmt.Println(str)
+
+		for _, conditions := range []string{`
+attribute: "jsonpath:$.metadata.name"
+method: RE
+value: "jsonpath:$.metadata.labels.app"`, `
+attribute: "payloadSize"
+method: EQ
+value: "jsonpath:$.spec.replicas"`, `
+attribute: "jsonpath:$.metadata.name"
+method: EQ
+value: "jsonpath:$.spec.containers[:].name"`, `
+attribute: "jsonpath:$.metadata.name"
+method: EQ
+value: "jsonpath:$..name"`, `
+attribute: "jsonpath:$.metadata.name"
+method: EQ
+value: "jsonpath:metadata.name"`} {
+			var c ConditionsTree
+			err = yaml.Unmarshal([]byte(conditions), &c)
+			So(err, ShouldNotBeNil)
+		}
+
+		str = "test that the static analysis ignores jsonpath values"
+		fmt.Println(str)
+
+		c := normalizeTestConditionsTree(`
+AND:
+- attribute: "jsonpath:$.spec.replicas"
+  method: EQ
+  value: "jsonpath:$.spec.minReplicas"
+- attribute: "jsonpath:$.spec.replicas"
+  method: EQ
+  value: "jsonpath:$.spec.maxReplicas"`)
+		warnings, err := ValidateRuleWithWarnings(&Rule{Conditions: c})
+		So(err, ShouldBeNil)
+		So(warnings, ShouldBeEmpty)
+	})
+}
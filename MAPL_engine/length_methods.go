@@ -0,0 +1,92 @@
+package MAPL_engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//--------------------------------------
+// Length Methods
+//--------------------------------------
+
+var lengthMethods = []string{"LEN_EQ", "LEN_GT", "LEN_GE", "LEN_LT", "LEN_LE"}
+
+var lengthMongoOperators = map[string]string{
+	"LEN_EQ": "$eq",
+	"LEN_GT": "$gt",
+	"LEN_GE": "$gte",
+	"LEN_LT": "$lt",
+	"LEN_LE": "$lte",
+}
+
+func isLengthMethod(method string) bool {
+	method = strings.ToUpper(method)
+	for _, m := range lengthMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// lengthOfValue returns the length of a string (in characters), the number of elements of an array or the number of keys of a map
+func lengthOfValue(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case string:
+		return int64(utf8.RuneCountInString(v)), true
+	case []interface{}:
+		return int64(len(v)), true
+	case map[string]interface{}:
+		return int64(len(v)), true
+	}
+	return 0, false
+}
+
+// compareLengthFunc compares the length of the value to the value of the condition. it returns false for numbers, booleans and null
+func compareLengthFunc(value1 interface{}, c *Condition) bool {
+	length, ok := lengthOfValue(value1)
+	if !ok {
+		return false
+	}
+	return compareIntFunc(length, strings.TrimPrefix(strings.ToUpper(c.Method), "LEN_"), c.ValueInt)
+}
+
+// compareLengthOfJsonFunc compares the length of a json value (a result of jsonslice.Get) to the value of the condition
+func compareLengthOfJsonFunc(value1 []byte, c *Condition) bool {
+	var valueInterface interface{}
+	err := json.Unmarshal(value1, &valueInterface)
+	if err != nil {
+		return false
+	}
+	return compareLengthFunc(valueInterface, c)
+}
+
+// lengthMongoQuery returns an $expr query that compares the length of the field ($strLenCP of strings, $size of arrays and of the keys of objects)
+func lengthMongoQuery(field string, c *Condition) (bson.M, error) {
+	operator, ok := lengthMongoOperators[strings.ToUpper(c.Method)]
+	if !ok || c.ValueInt == nil {
+		return bson.M{}, fmt.Errorf("invalid length method [%v]", c.Method)
+	}
+	for _, fieldPart := range strings.Split(field, ".") {
+		if _, err := strconv.Atoi(fieldPart); err == nil { // the field paths of aggregation expressions don't support array indices
+			return bson.M{}, fmt.Errorf("length methods on array elements are not supported")
+		}
+	}
+	fieldExpression := "$" + field
+	lengthExpression := bson.M{"$switch": bson.M{
+		"branches": []bson.M{
+			{"case": bson.M{"$isArray": fieldExpression}, "then": bson.M{"$size": fieldExpression}},
+			{"case": bson.M{"$eq": []interface{}{bson.M{"$type": fieldExpression}, "string"}}, "then": bson.M{"$strLenCP": fieldExpression}},
+			{"case": bson.M{"$eq": []interface{}{bson.M{"$type": fieldExpression}, "object"}}, "then": bson.M{"$size": bson.M{"$objectToArray": fieldExpression}}},
+		},
+		"default": nil,
+	}}
+	return bson.M{"$expr": bson.M{"$and": []interface{}{
+		bson.M{"$ne": []interface{}{lengthExpression, nil}}, // null (the length of other types) is lower than any number
+		bson.M{operator: []interface{}{lengthExpression, *c.ValueInt}},
+	}}}, nil
+}
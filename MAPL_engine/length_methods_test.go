@@ -0,0 +1,133 @@
+package MAPL_engine
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"go.mongodb.org/mongo-driver/bson"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+)
+
+var lengthMethodsTestCases = []struct {
+	conditions string
+	expected   bool
+}{
+	{conditions: `
+attribute: "jsonpath:$.spec.containers[0].env"
+method: LEN_GT
+value: 10`, expected: true},
+	{conditions: `
+attribute: "jsonpath:$.spec.containers[0].env"
+method: LEN_EQ
+value: 11`, expected: true},
+	{conditions: `
+attribute: "jsonpath:$.spec.containers[0].env"
+method: LEN_LT
+value: 11`, expected: false},
+	{conditions: ` # the number of keys of a map
+attribute: "jsonpath:$.metadata.annotations"
+method: len_ge
+value: 2`, expected: true},
+	{conditions: ` # the length of a string
+attribute: "jsonpath:$.metadata.annotations.description"
+method: LEN_GT
+value: 256`, expected: true},
+	{conditions: ` # in characters (not in bytes)
+attribute: "jsonpath:$.metadata.name"
+method: LEN_EQ
+value: 5`, expected: true},
+	{conditions: `
+attribute: "jsonpath:$.metadata.annotations['empty']"
+method: LEN_LE
+value: 0`, expected: true},
+	{conditions: ` # a number has no length
+attribute: "jsonpath:$.spec.replicas"
+method: LEN_LT
+value: 100`, expected: false},
+	{conditions: `
+attribute: "jsonpath:$.spec.missing"
+method: LEN_LT
+value: 100`, expected: false},
+	{conditions: `
+ANY:
+  parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+  condition:
+    attribute: "jsonpath:$RELATIVE.env"
+    method: LEN_EQ
+    value: 0`, expected: true},
+	{conditions: `
+ALL:
+  parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+  condition:
+    attribute: "jsonpath:$RELATIVE.env"
+    method: LEN_GE
+    value: 1`, expected: false},
+}
+
+func TestLengthMethods(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test the length methods"
+		fmt.Println(str)
+
+		env := []string{}
+		for i := 0; i < 11; i++ {
+			env = append(env, fmt.Sprintf(`{"name":"VAR%v","value":"%v"}`, i, i))
+		}
+		messages := methodTestMessages(MessageAttributes{}, fmt.Sprintf(`{"metadata":{"name":"ñandú","annotations":{"description":"%v","empty":""}},
+"spec":{"replicas":3,"containers":[{"name":"a","env":[%v]},{"name":"b","env":[]}]}}`, strings.Repeat("x", 300), strings.Join(env, ",")))
+
+		for _, testCase := range lengthMethodsTestCases {
+			c := normalizeTestConditionsTree(testCase.conditions)
+			err := c.ConditionsTree.PrepareAndValidate(PredefinedStringsAndLists{})
+			So(err, ShouldBeNil)
+			testEvalOnMessages(c.ConditionsTree, testCase.expected, messages)
+		}
+
+		str = "test the mongo queries of the length methods"
+		fmt.Println(str)
+
+		c := normalizeTestConditionsTree(lengthMethodsTestCases[3].conditions)
+		err := c.ConditionsTree.PrepareAndValidate(PredefinedStringsAndLists{})
+		So(err, ShouldBeNil)
+		q, pipeline, err := c.ConditionsTree.ToMongoQuery("raw", "", 0)
+		So(err, ShouldBeNil)
+		So(pipeline, ShouldBeEmpty)
+		expression := q["$expr"].(bson.M)["$and"].([]interface{})
+		So(expression, ShouldHaveLength, 2)
+		So(expression[1].(bson.M)["$gte"].([]interface{})[1], ShouldEqual, 2)
+		lengthExpression := expression[1].(bson.M)["$gte"].([]interface{})[0].(bson.M)["$switch"].(bson.M)
+		So(lengthExpression["branches"].([]bson.M)[0]["then"], ShouldResemble, bson.M{"$size": "$raw.metadata.annotations"})
+		So(lengthExpression["branches"].([]bson.M)[1]["then"], ShouldResemble, bson.M{"$strLenCP": "$raw.metadata.annotations"})
+		So(lengthExpression["branches"].([]bson.M)[2]["then"], ShouldResemble, bson.M{"$size": bson.M{"$objectToArray": "$raw.metadata.annotations"}})
+
+		for _, i := range []int{0, len(lengthMethodsTestCases) - 1} { // an array element and a condition within an array
+			c = normalizeTestConditionsTree(lengthMethodsTestCases[i].conditions)
+			err = c.ConditionsTree.PrepareAndValidate(PredefinedStringsAndLists{})
+			So(err, ShouldBeNil)
+			_, _, err = c.ConditionsTree.ToMongoQuery("raw", "", 0)
+			So(err, ShouldNotBeNil)
+		}
+
+		str = "test the validation of the length methods"
+		fmt.Println(str)
+
+		for _, invalid := range []Condition{
+			{Attribute: "jsonpath:$.spec.containers", Method: "LEN_GT", Value: ""},
+			{Attribute: "jsonpath:$.spec.containers", Method: "LEN_GT", Value: "-1"},
+			{Attribute: "jsonpath:$.spec.containers", Method: "LEN_EQ", Value: "1.5"},
+			{Attribute: "jsonpath:$.spec.containers", Method: "LEN_EQ", Value: "jsonpath:$.spec.replicas"},
+			{Attribute: "requestUseragent", Method: "LEN_GT", Value: "10"},
+			{Attribute: "senderLabel[app]", Method: "LEN_LT", Value: "10"},
+		} {
+			_, err = ValidateOneCondition(&invalid)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
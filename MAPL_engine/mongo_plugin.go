@@ -1,8 +1,10 @@
 package MAPL_engine
 
 import (
+	"crypto/md5"
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -60,6 +62,115 @@ func (n *Not) ToMongoQuery(base string, parentString string, inArrayCounter int)
 	return q_not, pipeline, nil
 }
 
+func (r *Ref) ToMongoQuery(base string, parentString string, inArrayCounter int) (bson.M, []bson.M, error) {
+	if r.Node == nil {
+		return bson.M{}, []bson.M{}, fmt.Errorf("predefined condition [%v] was not resolved", r.Name)
+	}
+	return r.Node.ToMongoQuery(base, parentString, inArrayCounter)
+}
+
+func (a *AtLeast) ToMongoQuery(base string, parentString string, inArrayCounter int) (bson.M, []bson.M, error) { //parentString is irrelevant here
+	return thresholdToMongoQuery(a.Nodes, a.N, len(a.Nodes), base, inArrayCounter)
+}
+
+func (a *AtMost) ToMongoQuery(base string, parentString string, inArrayCounter int) (bson.M, []bson.M, error) { //parentString is irrelevant here
+	return thresholdToMongoQuery(a.Nodes, 0, a.N, base, inArrayCounter)
+}
+
+func (e *Exactly) ToMongoQuery(base string, parentString string, inArrayCounter int) (bson.M, []bson.M, error) { //parentString is irrelevant here
+	return thresholdToMongoQuery(e.Nodes, e.N, e.N, base, inArrayCounter)
+}
+
+func (x *Xor) ToMongoQuery(base string, parentString string, inArrayCounter int) (bson.M, []bson.M, error) { //parentString is irrelevant here
+	return thresholdToMongoQuery(x.Nodes, 1, 1, base, inArrayCounter)
+}
+
+// thresholdToMongoQuery gives a query that tests that the number of true nodes is between min and max.
+// at least n == OR over all the combinations of n nodes of AND(nodes). at most n == NOT(at least n+1)
+func thresholdToMongoQuery(nodes []Node, min, max int, base string, inArrayCounter int) (bson.M, []bson.M, error) {
+
+	q_array := []bson.M{}
+	pipeline := []bson.M{}
+	for _, node := range nodes {
+		q, pipelineAppend, err := node.ToMongoQuery(base, "", inArrayCounter)
+		if err != nil {
+			return bson.M{}, []bson.M{}, err
+		}
+		q_array = append(q_array, q)
+		for _, p := range pipelineAppend {
+			pipeline = append(pipeline, p)
+		}
+	}
+
+	q_parts := []bson.M{}
+	if min > 0 {
+		q_atLeast, err := atLeastMongoQuery(q_array, min)
+		if err != nil {
+			return bson.M{}, []bson.M{}, err
+		}
+		q_parts = append(q_parts, q_atLeast)
+	}
+	if max < len(q_array) {
+		q_atLeast, err := atLeastMongoQuery(q_array, max+1)
+		if err != nil {
+			return bson.M{}, []bson.M{}, err
+		}
+		q_parts = append(q_parts, bson.M{"$nor": []bson.M{q_atLeast}})
+	}
+
+	switch len(q_parts) {
+	case 0:
+		return bson.M{}, pipeline, nil // always true
+	case 1:
+		return q_parts[0], pipeline, nil
+	default:
+		return bson.M{"$and": q_parts}, pipeline, nil
+	}
+}
+
+func atLeastMongoQuery(q_array []bson.M, n int) (bson.M, error) {
+
+	if numberOfCombinations(len(q_array), n) > maxCombinations {
+		return bson.M{}, fmt.Errorf("too many combinations in threshold node [%v of %v]", n, len(q_array))
+	}
+
+	q_or := []bson.M{}
+	combination := make([]int, n)
+	var addCombinations func(start, depth int)
+	addCombinations = func(start, depth int) {
+		if depth == n {
+			q_and := []bson.M{}
+			for _, i := range combination {
+				q_and = append(q_and, q_array[i])
+			}
+			q_or = append(q_or, bson.M{"$and": q_and})
+			return
+		}
+		for i := start; i <= len(q_array)-(n-depth); i++ {
+			combination[depth] = i
+			addCombinations(i+1, depth+1)
+		}
+	}
+	addCombinations(0, 0)
+
+	return bson.M{"$or": q_or}, nil
+}
+
+// numberOfCombinations gives k choose n (bounded by maxCombinations+1 to avoid overflows)
+func numberOfCombinations(k, n int) int {
+	if n > k-n {
+		n = k - n
+	}
+	result := 1
+	for i := 1; i <= n; i++ {
+		result = result * (k - n + i) / i
+		if result > maxCombinations {
+			return maxCombinations + 1
+		}
+	}
+	return result
+}
+
 func (a *All) ToMongoQuery(base string, parentString string, inArrayCounter int) (bson.M, []bson.M, error) { //parentString is irrelevant here
 	if strings.HasSuffix(a.ParentJsonpathAttributeOriginal, "[:]") || strings.HasSuffix(a.ParentJsonpathAttributeOriginal, "[*]") {
 		inArrayCounter += 1
@@ -125,6 +236,9 @@ func (c *Condition) ToMongoQuery(base string, parentString string, inArrayCounte
 	if c.Attribute != "jsonpath" {
 		return bson.M{}, []bson.M{}, fmt.Errorf("attribute is not a jsonpath")
 	}
+	if c.ValueIsJsonpath {
+		return bson.M{}, []bson.M{}, fmt.Errorf("comparison to a jsonpath value is not supported")
+	}
 
 	var field string
 	if strings.HasPrefix(c.OriginalAttribute, "jsonpath:$RELATIVE") {
@@ -216,6 +330,25 @@ func (c *Condition) ToMongoQuery(base string, parentString string, inArrayCounte
 		// db.raw_data.find({"$and":[{"raw.metadata.labels.foo":{"$not":{"$regex":"ar2"}}},{"raw.metadata.labels.foo":{"$exists":true}}]})
 	case "IN", "NIN": // it is not supported natively. we convert it to RE/NRE first which are supported.
 		return bson.M{}, []bson.M{}, fmt.Errorf("methods IN,NIN are not supported yet")
+	case "SEMVER_LT", "SEMVER_LE", "SEMVER_GT", "SEMVER_GE", "SEMVER_EQ", "SEMVER_IN_RANGE":
+		return bson.M{}, []bson.M{}, fmt.Errorf("semver methods are not supported")
+	case "IN_CIDR", "NIN_CIDR", "IS_PRIVATE_IP", "IS_PUBLIC_IP":
+		return bson.M{}, []bson.M{}, fmt.Errorf("ip methods are not supported")
+	case "BEFORE", "AFTER", "OLDER_THAN", "NEWER_THAN":
+		return bson.M{}, []bson.M{}, fmt.Errorf("time methods are not supported")
+	case "LEN_EQ", "LEN_GT", "LEN_GE", "LEN_LT", "LEN_LE":
+		if inArrayCounter > 0 || len(initialSteps) > 0 {
+			return bson.M{}, []bson.M{}, fmt.Errorf("length methods within arrays are not supported")
+		}
+		q, err = lengthMongoQuery(field, c)
+		if err != nil {
+			return bson.M{}, []bson.M{}, err
+		}
+	case "IS_TYPE", "IS_NULL", "NOT_NULL":
+		if inArrayCounter > 0 || len(initialSteps) > 0 {
+			return bson.M{}, []bson.M{}, fmt.Errorf("type methods within arrays are not supported")
+		}
+		q = typeMongoQuery(field, c)
 	}
 
 	return q, initialSteps, nil
@@ -258,3 +391,170 @@ func removeQuotes(str string) (string, error) {
 
 	return str, nil
 }
+
+func (c *Count) ToMongoQuery(base string, parentString string, inArrayCounter int) (bson.M, []bson.M, error) { //parentString is irrelevant here
+
+	if inArrayCounter > 0 {
+		return bson.M{}, []bson.M{}, fmt.Errorf("COUNT within array is not supported")
+	}
+	if strings.HasSuffix(c.ParentJsonpathAttributeOriginal, "[:]") || strings.HasSuffix(c.ParentJsonpathAttributeOriginal, "[*]") {
+		inArrayCounter += 1
+	}
+	if strings.HasPrefix(c.ParentJsonpathAttributeOriginal, "jsonpath:$..") {
+		return bson.M{}, []bson.M{}, fmt.Errorf("deepscan is not supported")
+	}
+	parentField := strings.Replace(c.ParentJsonpathAttributeOriginal, "jsonpath:$.", base+".", 1)
+	parentField = strings.Replace(parentField, "[:]", "", -1)
+	parentField = strings.Replace(parentField, "[*]", "", -1)
+
+	q, pipeline, err := c.Node.ToMongoQuery(base, parentField, inArrayCounter+1)
+	if err != nil {
+		return bson.M{}, []bson.M{}, err
+	}
+	if len(pipeline) != 0 {
+		return bson.M{}, []bson.M{}, fmt.Errorf("KEY/VALUE in COUNT node is not supported")
+	}
+
+	// the query of the inner node is converted to an expression on the array elements. the number of elements that satisfy it is added as a field:
+	cond, err := mongoQueryToExpression(q, base)
+	if err != nil {
+		return bson.M{}, []bson.M{}, err
+	}
+	countField := fmt.Sprintf("addedField.count_%x", md5.Sum([]byte(c.String())))
+	input := bson.M{"$ifNull": []interface{}{"$" + parentField, []interface{}{}}}
+	addFieldStep := bson.M{"$addFields": bson.M{countField: bson.M{"$size": bson.M{"$filter": bson.M{"input": input, "as": "element", "cond": cond}}}}}
+
+	var q_count bson.M
+	switch c.Method {
+	case "EQ":
+		q_count = bson.M{countField: bson.M{"$eq": c.Value}}
+	case "NEQ", "NE":
+		q_count = bson.M{countField: bson.M{"$ne": c.Value}}
+	case "GT":
+		q_count = bson.M{countField: bson.M{"$gt": c.Value}}
+	case "GE":
+		q_count = bson.M{countField: bson.M{"$gte": c.Value}}
+	case "LT":
+		q_count = bson.M{countField: bson.M{"$lt": c.Value}}
+	case "LE":
+		q_count = bson.M{countField: bson.M{"$lte": c.Value}}
+	default:
+		return bson.M{}, []bson.M{}, fmt.Errorf("invalid method [%v] in COUNT node", c.Method)
+	}
+
+	return q_count, []bson.M{addFieldStep}, nil
+}
+
+// mongoQueryToExpression converts a query on the elements of an array (as in $elemMatch) to an aggregation expression on the $$element variable (as in $filter).
+// fields that start with the base are fields of the document (and not of the element).
+func mongoQueryToExpression(q bson.M, base string) (interface{}, error) {
+
+	keys := []string{}
+	for key := range q {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	expressions := []interface{}{}
+	for _, key := range keys {
+		switch key {
+		case "$and", "$or", "$nor":
+			subQueries, ok := q[key].([]bson.M)
+			if !ok {
+				return nil, fmt.Errorf("can't convert query [%v] to an expression", q)
+			}
+			subExpressions := []interface{}{}
+			for _, subQuery := range subQueries {
+				subExpression, err := mongoQueryToExpression(subQuery, base)
+				if err != nil {
+					return nil, err
+				}
+				subExpressions = append(subExpressions, subExpression)
+			}
+			if key == "$nor" {
+				expressions = append(expressions, bson.M{"$not": []interface{}{bson.M{"$or": subExpressions}}})
+			} else {
+				expressions = append(expressions, bson.M{key: subExpressions})
+			}
+		default:
+			field := "$$element." + key
+			if len(base) > 0 && strings.HasPrefix(key, base+".") {
+				field = "$" + key
+			}
+			operators, ok := q[key].(bson.M)
+			if !ok {
+				expressions = append(expressions, bson.M{"$eq": []interface{}{field, q[key]}})
+				continue
+			}
+			expression, err := mongoOperatorsToExpression(field, operators)
+			if err != nil {
+				return nil, err
+			}
+			expressions = append(expressions, expression)
+		}
+	}
+
+	switch len(expressions) {
+	case 0:
+		return true, nil
+	case 1:
+		return expressions[0], nil
+	default:
+		return bson.M{"$and": expressions}, nil
+	}
+}
+
+func mongoOperatorsToExpression(field string, operators bson.M) (interface{}, error) {
+
+	isString := bson.M{"$eq": []interface{}{bson.M{"$type": field}, "string"}}
+	sameType := func(value interface{}) interface{} { // the comparison operators of queries compare values of the same type only
+		if _, ok := value.(float64); ok {
+			return bson.M{"$isNumber": field}
+		}
+		return isString
+	}
+
+	ops := []string{}
+	for op := range operators {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops) // the same order of expressions on every conversion
+
+	expressions := []interface{}{}
+	for _, op := range ops {
+		value := operators[op]
+		switch op {
+		case "$eq", "$ne":
+			expressions = append(expressions, bson.M{op: []interface{}{field, value}})
+		case "$gt", "$gte", "$lt", "$lte":
+			expressions = append(expressions, bson.M{"$and": []interface{}{sameType(value), bson.M{op: []interface{}{field, value}}}})
+		case "$exists":
+			if value == true {
+				expressions = append(expressions, bson.M{"$ne": []interface{}{bson.M{"$type": field}, "missing"}})
+			} else {
+				expressions = append(expressions, bson.M{"$eq": []interface{}{bson.M{"$type": field}, "missing"}})
+			}
+		case "$regex":
+			expressions = append(expressions, bson.M{"$and": []interface{}{isString, bson.M{"$regexMatch": bson.M{"input": field, "regex": value}}}})
+		case "$not":
+			notOperators, ok := value.(bson.M)
+			if !ok {
+				return nil, fmt.Errorf("can't convert operator [%v] to an expression", op)
+			}
+			expression, err := mongoOperatorsToExpression(field, notOperators)
+			if err != nil {
+				return nil, err
+			}
+			expressions = append(expressions, bson.M{"$not": []interface{}{expression}})
+		case "$elemMatch":
+			return nil, fmt.Errorf("arrays within COUNT node are not supported")
+		default:
+			return nil, fmt.Errorf("can't convert operator [%v] to an expression", op)
+		}
+	}
+
+	if len(expressions) == 1 {
+		return expressions[0], nil
+	}
+	return bson.M{"$and": expressions}, nil
+}
@@ -0,0 +1,148 @@
+package MAPL_engine
+
+import (
+	"context"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+const noMatchDecisionTestMessages = `
+messages:
+- message_id: 0
+  sender_service: A.my_namespace
+  receiver_service: C.my_namespace
+  request_protocol: HTTP
+  request_path: /book/123
+  request_method: GET
+  request_time: 2018-07-29T14:30:00-07:00
+`
+
+func TestNoMatchAndErrorDecisions(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		messages, err := YamlReadMessagesFromString(checkWithContextTestMessages)
+		So(err, ShouldBeNil)
+		otherMessages, err := YamlReadMessagesFromString(noMatchDecisionTestMessages)
+		So(err, ShouldBeNil)
+		messageWithError := messages.Messages[0]        // without encryptionVersion (rule 0 fails)
+		messageWithMatch := messages.Messages[1]        // rule 0 alerts
+		messageWithNoMatch := otherMessages.Messages[0] // to C.my_namespace
+
+		str := "test the outcome without no-match and error decisions"
+		fmt.Println(str)
+
+		rules, err := YamlReadRulesFromString(checkWithContextTestRules)
+		So(err, ShouldBeNil)
+
+		result, err := CheckWithContext(context.Background(), &messageWithMatch, &rules)
+		So(err, ShouldBeNil)
+		So(result.Outcome, ShouldEqual, OutcomeMatch)
+		So(result.Decision, ShouldEqual, ALERT)
+
+		result, err = CheckWithContext(context.Background(), &messageWithNoMatch, &rules)
+		So(err, ShouldBeNil)
+		So(result.Outcome, ShouldEqual, OutcomeNoMatch)
+		So(result.Decision, ShouldEqual, DEFAULT)
+		So(result.DecisionString, ShouldEqual, DecisionNames[DEFAULT])
+
+		result, err = CheckWithContext(context.Background(), &messageWithError, &rules) // rule 1 allows without errors
+		So(err, ShouldBeNil)
+		So(result.Outcome, ShouldEqual, OutcomeMatch)
+		So(result.Decision, ShouldEqual, ALLOW)
+		So(result.Errors, ShouldHaveLength, 1)
+
+		result, err = CheckWithContext(context.Background(), &messageWithError, &rules, WithFailMode(FailClosed))
+		So(err, ShouldBeNil)
+		So(result.Outcome, ShouldEqual, OutcomeError)
+		So(result.Decision, ShouldEqual, BLOCK)
+
+		rules.Rules = rules.Rules[:1] // only the rule that fails
+		result, err = CheckWithContext(context.Background(), &messageWithError, &rules)
+		So(err, ShouldBeNil)
+		So(result.Outcome, ShouldEqual, OutcomeError) // not a no-match
+		So(result.Decision, ShouldEqual, DEFAULT)
+		So(result.RelevantRuleIndex, ShouldEqual, -1)
+
+		str = "test the no-match and error decisions of the rule set"
+		fmt.Println(str)
+
+		rules, err = YamlReadRulesFromString("noMatchDecision: allow\nerrorDecision: alert\n" + checkWithContextTestRules)
+		So(err, ShouldBeNil)
+		So(rules.NoMatchDecision, ShouldEqual, "allow")
+		So(rules.ErrorDecision, ShouldEqual, "alert")
+
+		result, err = CheckWithContext(context.Background(), &messageWithNoMatch, &rules)
+		So(err, ShouldBeNil)
+		So(result.Outcome, ShouldEqual, OutcomeNoMatch)
+		So(result.Decision, ShouldEqual, ALLOW)
+		So(result.DecisionString, ShouldEqual, "allow")
+		So(result.RelevantRuleIndex, ShouldEqual, -1)
+		So(result.AppliedRulesIndices, ShouldBeEmpty)
+
+		decision, decisionString, _, _, _, _, _ := Check(&messageWithNoMatch, &rules)
+		So(decision, ShouldEqual, ALLOW)
+		So(decisionString, ShouldEqual, "allow")
+
+		result, err = CheckWithContext(context.Background(), &messageWithError, &rules)
+		So(err, ShouldBeNil)
+		So(result.Outcome, ShouldEqual, OutcomeError)
+		So(result.Decision, ShouldEqual, ALERT)
+		So(result.RelevantRuleIndex, ShouldEqual, 0)
+		So(result.Results, ShouldResemble, []int{ALERT, ALLOW})
+
+		result, err = CheckWithContext(context.Background(), &messageWithMatch, &rules)
+		So(err, ShouldBeNil)
+		So(result.Outcome, ShouldEqual, OutcomeMatch)
+		So(result.Decision, ShouldEqual, ALERT)
+
+		str = "test the no-match and error decisions options"
+		fmt.Println(str)
+
+		result, err = CheckWithContext(context.Background(), &messageWithNoMatch, &rules, WithNoMatchDecision("block"))
+		So(err, ShouldBeNil)
+		So(result.Outcome, ShouldEqual, OutcomeNoMatch)
+		So(result.Decision, ShouldEqual, BLOCK)
+
+		result, err = CheckWithContext(context.Background(), &messageWithError, &rules, WithErrorDecision("block"))
+		So(err, ShouldBeNil)
+		So(result.Decision, ShouldEqual, BLOCK)
+
+		result, err = CheckWithContext(context.Background(), &messageWithError, &rules, WithFailMode(FailClosed)) // overrides the rule set's error decision
+		So(err, ShouldBeNil)
+		So(result.Decision, ShouldEqual, BLOCK)
+
+		_, err = CheckWithContext(context.Background(), &messageWithNoMatch, &rules, WithNoMatchDecision("deny"))
+		So(err, ShouldNotBeNil)
+		_, err = CheckWithContext(context.Background(), &messageWithNoMatch, &rules, WithErrorDecision("deny"))
+		So(err, ShouldNotBeNil)
+
+		rules.NoMatchDecision = "deny"
+		decision, _, _, _, _, _, _ = Check(&messageWithNoMatch, &rules) // Check ignores (and logs) decisions that are not valid
+		So(decision, ShouldEqual, DEFAULT)
+
+		str = "test user-defined no-match decisions"
+		fmt.Println(str)
+
+		rules, err = YamlReadRulesFromString(decisionsTestHeader + "noMatchDecision: warn\n" + checkWithContextTestRules)
+		So(err, ShouldBeNil)
+		result, err = CheckWithContext(context.Background(), &messageWithNoMatch, &rules)
+		So(err, ShouldBeNil)
+		So(result.DecisionString, ShouldEqual, "warn")
+		So(result.Outcome, ShouldEqual, OutcomeNoMatch)
+
+		str = "test invalid no-match and error decisions"
+		fmt.Println(str)
+
+		_, err = YamlReadRulesFromString("noMatchDecision: deny\n" + checkWithContextTestRules)
+		So(err, ShouldNotBeNil)
+		_, err = YamlReadRulesFromString("errorDecision: warn\n" + checkWithContextTestRules) // warn is not defined
+		So(err, ShouldNotBeNil)
+	})
+}
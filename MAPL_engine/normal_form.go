@@ -0,0 +1,246 @@
+package MAPL_engine
+
+import (
+	"fmt"
+)
+
+//--------------------------------------
+// Disjunctive and Conjunctive Normal Forms
+//--------------------------------------
+
+const maxCombinations = 1000 // the maximal number of clauses in a DNF/CNF and of combinations in the mongo query of a threshold node
+
+// ToDNF returns the disjunctive normal form of the conditions tree: an OR node whose nodes are AND nodes of literals.
+// The literals are the leaves of the tree (conditions, ANY, ALL, COUNT and unresolved REF nodes) or their negations.
+// NOT nodes are pushed inward only through AND/OR nodes: NOT(EQ) and NEQ (or NOT(ANY) and ALL(NOT)) differ for missing attributes and arrays, so they
+// are kept as negated literals and the DNF evaluates to the same result as the tree. Threshold nodes are expanded to the combinations of their nodes
+// and resolved REF nodes are replaced by the predefined conditions. TRUE is an OR with one empty AND and FALSE is an empty OR.
+// The literals are shared with the given tree (it is not changed). An error is returned if the DNF has more than 1000 clauses.
+func ToDNF(node Node) (*Or, error) {
+	clauses, err := dnfClauses(node, false)
+	if err != nil {
+		return nil, err
+	}
+	or := Or{Nodes: []Node{}}
+	for _, clause := range clauses {
+		or.Nodes = append(or.Nodes, &And{Nodes: clause})
+	}
+	return &or, nil
+}
+
+// ToCNF returns the conjunctive normal form of the conditions tree: an AND node whose nodes are OR nodes of literals (see ToDNF).
+// TRUE is an empty AND and FALSE is an AND with one empty OR. An error is returned if the CNF has more than 1000 clauses.
+func ToCNF(node Node) (*And, error) {
+	clauses, err := dnfClauses(node, true) // CNF(x) == NOT(DNF(NOT(x)))
+	if err != nil {
+		return nil, err
+	}
+	and := And{Nodes: []Node{}}
+	for _, clause := range clauses {
+		or := Or{Nodes: []Node{}}
+		for _, literal := range clause {
+			or.Nodes = append(or.Nodes, negateLiteral(literal))
+		}
+		and.Nodes = append(and.Nodes, &or)
+	}
+	return &and, nil
+}
+
+// dnfClauses returns the clauses of the DNF of the node (or of its negation if negate is true). each clause is a conjunction of literals.
+func dnfClauses(node Node, negate bool) ([][]Node, error) {
+
+	switch n := node.(type) {
+	case nil:
+		return nil, fmt.Errorf("nil node")
+	case True, *True:
+		if negate {
+			return [][]Node{}, nil
+		}
+		return [][]Node{{}}, nil
+	case False, *False:
+		if negate {
+			return [][]Node{{}}, nil
+		}
+		return [][]Node{}, nil
+	case *Not:
+		return dnfClauses(n.Node, !negate)
+	case *And:
+		if negate {
+			return dnfDisjunction(n.Nodes, true) // De Morgan
+		}
+		return dnfConjunction(n.Nodes, false)
+	case *Or:
+		if negate {
+			return dnfConjunction(n.Nodes, true) // De Morgan
+		}
+		return dnfDisjunction(n.Nodes, false)
+	case *AtLeast:
+		return dnfThreshold(n.N, len(n.Nodes)+1, n.Nodes, negate)
+	case *AtMost:
+		return dnfThreshold(0, n.N+1, n.Nodes, negate)
+	case *Exactly:
+		return dnfThreshold(n.N, n.N+1, n.Nodes, negate)
+	case *Xor:
+		return dnfThreshold(1, 2, n.Nodes, negate)
+	case *Ref:
+		if n.Node != nil {
+			return dnfClauses(n.Node, negate)
+		}
+	}
+	if negate {
+		return [][]Node{{&Not{Node: node}}}, nil
+	}
+	return [][]Node{{node}}, nil
+}
+
+// dnfDisjunction returns the DNF clauses of the OR of the nodes (or of their negations)
+func dnfDisjunction(nodes []Node, negate bool) ([][]Node, error) {
+	clauses := [][]Node{}
+	seen := map[string]bool{}
+	for _, node := range nodes {
+		nodeClauses, err := dnfClauses(node, negate)
+		if err != nil {
+			return nil, err
+		}
+		for _, clause := range nodeClauses {
+			str := (&And{Nodes: clause}).String()
+			if !seen[str] {
+				seen[str] = true
+				clauses = append(clauses, clause)
+			}
+		}
+		if len(clauses) > maxCombinations {
+			return nil, fmt.Errorf("too many clauses in the normal form of the conditions [>%v]", maxCombinations)
+		}
+	}
+	return absorbClauses(clauses), nil
+}
+
+// dnfConjunction returns the DNF clauses of the AND of the nodes (or of their negations): the product of the clauses of the nodes
+func dnfConjunction(nodes []Node, negate bool) ([][]Node, error) {
+	clauses := [][]Node{{}}
+	for _, node := range nodes {
+		nodeClauses, err := dnfClauses(node, negate)
+		if err != nil {
+			return nil, err
+		}
+		if len(clauses)*len(nodeClauses) > maxCombinations {
+			return nil, fmt.Errorf("too many clauses in the normal form of the conditions [>%v]", maxCombinations)
+		}
+		product := [][]Node{}
+		seen := map[string]bool{}
+		for _, clause := range clauses {
+			for _, nodeClause := range nodeClauses {
+				newClause, ok := appendLiterals(clause, nodeClause)
+				if !ok {
+					continue // x && !x
+				}
+				str := (&And{Nodes: newClause}).String()
+				if !seen[str] {
+					seen[str] = true
+					product = append(product, newClause)
+				}
+			}
+		}
+		clauses = absorbClauses(product)
+	}
+	return clauses, nil
+}
+
+// absorbClauses removes the clauses that contain another clause (x || (x && y) == x)
+func absorbClauses(clauses [][]Node) [][]Node {
+	literalSets := make([]map[string]bool, len(clauses))
+	for i, clause := range clauses {
+		literalSets[i] = map[string]bool{}
+		for _, literal := range clause {
+			literalSets[i][literal.String()] = true
+		}
+	}
+	absorbed := [][]Node{}
+	for i, clause := range clauses {
+		contains := false
+		for j := range clauses {
+			if j != i && len(literalSets[j]) <= len(literalSets[i]) && (len(literalSets[j]) < len(literalSets[i]) || j < i) && isSubset(literalSets[j], literalSets[i]) {
+				contains = true
+				break
+			}
+		}
+		if !contains {
+			absorbed = append(absorbed, clause)
+		}
+	}
+	return absorbed
+}
+
+func isSubset(set1, set2 map[string]bool) bool {
+	for k := range set1 {
+		if !set2[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// appendLiterals returns a new clause with the literals of both clauses (without duplicates). ok is false if the clause contains a literal and its negation.
+func appendLiterals(clause1, clause2 []Node) (clause []Node, ok bool) {
+	clause = make([]Node, 0, len(clause1)+len(clause2))
+	seen := map[string]bool{}
+	for _, literal := range append(append([]Node{}, clause1...), clause2...) {
+		str := literal.String()
+		if seen[str] {
+			continue
+		}
+		if seen[negateLiteral(literal).String()] {
+			return nil, false
+		}
+		seen[str] = true
+		clause = append(clause, literal)
+	}
+	return clause, true
+}
+
+// dnfThreshold returns the DNF clauses of "at least min and less than max of the nodes are true" (or of its negation)
+func dnfThreshold(min, max int, nodes []Node, negate bool) ([][]Node, error) {
+	atLeastMin, err := atLeastCombinations(min, nodes)
+	if err != nil {
+		return nil, err
+	}
+	atLeastMax, err := atLeastCombinations(max, nodes)
+	if err != nil {
+		return nil, err
+	}
+	return dnfClauses(&And{Nodes: []Node{atLeastMin, &Not{Node: atLeastMax}}}, negate)
+}
+
+// atLeastCombinations returns the OR of the ANDs of every n of the nodes (the AND/OR form of AT_LEAST)
+func atLeastCombinations(n int, nodes []Node) (Node, error) {
+	if n <= 0 {
+		return True{}, nil
+	}
+	if n > len(nodes) {
+		return False{}, nil
+	}
+	if numberOfCombinations(len(nodes), n) > maxCombinations {
+		return nil, fmt.Errorf("too many combinations in threshold node [%v of %v]", n, len(nodes))
+	}
+	or := Or{}
+	var combine func(start int, chosen []Node)
+	combine = func(start int, chosen []Node) {
+		if len(chosen) == n {
+			or.Nodes = append(or.Nodes, &And{Nodes: append([]Node{}, chosen...)})
+			return
+		}
+		for i := start; i <= len(nodes)-(n-len(chosen)); i++ {
+			combine(i+1, append(chosen, nodes[i]))
+		}
+	}
+	combine(0, []Node{})
+	return &or, nil
+}
+
+func negateLiteral(literal Node) Node {
+	if n, ok := literal.(*Not); ok {
+		return n.Node
+	}
+	return &Not{Node: literal}
+}
@@ -0,0 +1,232 @@
+package MAPL_engine
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+var normalFormTestCases = []struct {
+	conditions string
+	dnfClauses int
+	cnfClauses int
+}{
+	{ // (a || b) && (c || d)
+		conditions: `
+AND:
+- OR:
+  - attribute: "jsonpath:$.kind"
+    method: EQ
+    value: "Pod"
+  - attribute: "jsonpath:$.metadata.labels.app"
+    method: EQ
+    value: "x"
+- OR:
+  - ANY:
+      parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+      condition:
+        attribute: "jsonpath:$RELATIVE.image"
+        method: EQ
+        value: "nginx"
+  - attribute: "jsonpath:$.spec.replicas"
+    method: GT
+    value: 5`,
+		dnfClauses: 4,
+		cnfClauses: 2,
+	},
+	{ // NOT is kept over conditions and ANY nodes
+		conditions: `
+NOT:
+  AND:
+  - attribute: "jsonpath:$.metadata.labels.app"
+    method: EQ
+    value: "x"
+  - NOT:
+      ANY:
+        parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+        condition:
+          attribute: "jsonpath:$RELATIVE.image"
+          method: EQ
+          value: "alpine"`,
+		dnfClauses: 2,
+		cnfClauses: 1,
+	},
+	{ // NOT over ALL
+		conditions: `
+OR:
+- NOT:
+    ALL:
+      parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+      condition:
+        attribute: "jsonpath:$RELATIVE.image"
+        method: EQ
+        value: "busybox"
+- attribute: "jsonpath:$.spec.replicas"
+  method: GT
+  value: 5`,
+		dnfClauses: 2,
+		cnfClauses: 1,
+	},
+	{ // threshold nodes are expanded
+		conditions: `
+AT_LEAST:
+  n: 2
+  conditions:
+  - attribute: "jsonpath:$.kind"
+    method: EQ
+    value: "Pod"
+  - attribute: "jsonpath:$.metadata.labels.app"
+    method: EQ
+    value: "x"
+  - attribute: "jsonpath:$.spec.replicas"
+    method: LT
+    value: 5`,
+		dnfClauses: 3,
+		cnfClauses: 3,
+	},
+	{
+		conditions: `
+XOR:
+- attribute: "jsonpath:$.kind"
+  method: EQ
+  value: "Pod"
+- attribute: "jsonpath:$.spec.replicas"
+  method: GT
+  value: 5`,
+		dnfClauses: 2,
+		cnfClauses: 2,
+	},
+}
+
+func TestNormalForms(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test the DNF and CNF of conditions trees"
+		fmt.Println(str)
+
+		messages := []MessageAttributes{}
+		for _, data := range []string{"../files/raw_json_data/count/json_raw_data_4containers.json", "../files/raw_json_data/any_all/json_raw_data_2containers_cpu2_mem2000.json"} {
+			data, err := ReadBinaryFile(data)
+			So(err, ShouldBeNil)
+			var dataInterface interface{}
+			err = json.Unmarshal(data, &dataInterface)
+			So(err, ShouldBeNil)
+			messages = append(messages, MessageAttributes{RequestJsonRaw: &data, RequestRawInterface: &dataInterface})
+		}
+		emptyData := []byte("{}")
+		var emptyDataInterface interface{} = map[string]interface{}{}
+		messages = append(messages, MessageAttributes{RequestJsonRaw: &emptyData, RequestRawInterface: &emptyDataInterface})
+
+		for _, testCase := range normalFormTestCases {
+			c := normalizeTestConditionsTree(testCase.conditions)
+			err := c.ConditionsTree.PrepareAndValidate(PredefinedStringsAndLists{})
+			So(err, ShouldBeNil)
+			originalString := c.ConditionsTree.String()
+
+			dnf, err := ToDNF(c.ConditionsTree)
+			So(err, ShouldBeNil)
+			So(dnf.Nodes, ShouldHaveLength, testCase.dnfClauses)
+			for _, clause := range dnf.Nodes {
+				for _, literal := range clause.(*And).Nodes {
+					So(isNormalFormLiteral(literal), ShouldBeTrue)
+				}
+			}
+
+			cnf, err := ToCNF(c.ConditionsTree)
+			So(err, ShouldBeNil)
+			So(cnf.Nodes, ShouldHaveLength, testCase.cnfClauses)
+			for _, clause := range cnf.Nodes {
+				for _, literal := range clause.(*Or).Nodes {
+					So(isNormalFormLiteral(literal), ShouldBeTrue)
+				}
+			}
+
+			for _, message := range messages {
+				flag, _ := c.ConditionsTree.Eval(&message)
+				flagDNF, _ := dnf.Eval(&message)
+				flagCNF, _ := cnf.Eval(&message)
+				So(flagDNF, ShouldEqual, flag)
+				So(flagCNF, ShouldEqual, flag)
+			}
+			So(c.ConditionsTree.String(), ShouldEqual, originalString) // the tree is not changed
+		}
+
+		c := normalizeTestConditionsTree(normalFormTestCases[1].conditions)
+		dnf, err := ToDNF(c.ConditionsTree)
+		So(err, ShouldBeNil)
+		So(dnf.Nodes[0].(*And).Nodes[0].(*Not).Node.(*Condition).Method, ShouldEqual, "EQ") // not NEQ
+		So(dnf.Nodes[1].(*And).Nodes[0], ShouldHaveSameTypeAs, &Any{})                      // the double negation is removed
+
+		str = "test the DNF and CNF of TRUE and FALSE"
+		fmt.Println(str)
+
+		message := MessageAttributes{}
+		for _, testCase := range []struct {
+			node     Node
+			expected bool
+		}{{True{}, true}, {False{}, false}, {&Not{Node: &And{Nodes: []Node{True{}, False{}}}}, true}} {
+			dnf, err := ToDNF(testCase.node)
+			So(err, ShouldBeNil)
+			cnf, err := ToCNF(testCase.node)
+			So(err, ShouldBeNil)
+			flagDNF, _ := dnf.Eval(&message)
+			flagCNF, _ := cnf.Eval(&message)
+			So(flagDNF, ShouldEqual, testCase.expected)
+			So(flagCNF, ShouldEqual, testCase.expected)
+		}
+		dnf, _ = ToDNF(False{})
+		So(dnf.Nodes, ShouldBeEmpty)
+		cnf, _ := ToCNF(True{})
+		So(cnf.Nodes, ShouldBeEmpty)
+
+		str = "test the size limit of the normal forms"
+		fmt.Println(str)
+
+		and := And{}
+		for i := 0; i < 11; i++ {
+			and.Nodes = append(and.Nodes, &Or{Nodes: []Node{
+				&Condition{Attribute: fmt.Sprintf("jsonpath:$.a%v", i), Method: "EX"},
+				&Condition{Attribute: fmt.Sprintf("jsonpath:$.b%v", i), Method: "EX"},
+			}})
+		}
+		_, err = ToDNF(&and)
+		So(err, ShouldNotBeNil)
+		cnf, err = ToCNF(&and)
+		So(err, ShouldBeNil)
+		So(cnf.Nodes, ShouldHaveLength, 11)
+		or := Or{}
+		for _, node := range and.Nodes {
+			or.Nodes = append(or.Nodes, &And{Nodes: node.(*Or).Nodes})
+		}
+		_, err = ToCNF(&or)
+		So(err, ShouldNotBeNil)
+		dnf, err = ToDNF(&or)
+		So(err, ShouldBeNil)
+		So(dnf.Nodes, ShouldHaveLength, 11)
+
+		atLeast := AtLeast{N: 10}
+		for i := 0; i < 20; i++ {
+			atLeast.Nodes = append(atLeast.Nodes, &Condition{Attribute: fmt.Sprintf("jsonpath:$.a%v", i), Method: "EX"})
+		}
+		_, err = ToDNF(&atLeast)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func isNormalFormLiteral(node Node) bool {
+	if n, ok := node.(*Not); ok {
+		node = n.Node
+	}
+	switch node.(type) {
+	case *Condition, *Any, *All, *Count:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,236 @@
+package MAPL_engine
+
+import (
+	"strings"
+)
+
+//--------------------------------------
+// Normalization of Conditions Trees
+//--------------------------------------
+
+// negatedMethods are the pairs of methods that negate each other
+var negatedMethods = map[string]string{
+	"EQ":  "NEQ",
+	"NEQ": "EQ",
+	"NE":  "EQ",
+	"EX":  "NEX",
+	"NEX": "EX",
+	"RE":  "NRE",
+	"NRE": "RE",
+	"IN":  "NIN",
+	"NIN": "IN",
+
+	"PREFIX":    "NPREFIX",
+	"NPREFIX":   "PREFIX",
+	"SUFFIX":    "NSUFFIX",
+	"NSUFFIX":   "SUFFIX",
+	"CONTAINS":  "NCONTAINS",
+	"NCONTAINS": "CONTAINS",
+	"EQ_CI":     "NEQ_CI",
+	"NEQ_CI":    "EQ_CI",
+	"IN_CI":     "NIN_CI",
+	"NIN_CI":    "IN_CI",
+	"GLOB":      "NGLOB",
+	"NGLOB":     "GLOB",
+	"IS_NULL":   "NOT_NULL",
+	"NOT_NULL":  "IS_NULL",
+	"IN_CIDR":   "NIN_CIDR",
+	"NIN_CIDR":  "IN_CIDR",
+}
+
+// Normalize returns the canonical form of the conditions tree (the given tree is not changed):
+// nested AND (OR) nodes are flattened, duplicate children of AND/OR nodes are removed, NOT nodes are pushed inward through AND/OR nodes (by De Morgan's laws),
+// double NOT nodes are removed and TRUE/FALSE nodes are folded.
+// NOT nodes over conditions and ANY/ALL nodes are kept since NOT(EQ) and NEQ (or NOT(ANY) and ALL(NOT)) differ for missing attributes.
+// Trees that differ only by these transformations evaluate to the same result and have the same normalized form (and string).
+// The normalized form is used to compare and hash conditions.
+func Normalize(node Node) Node {
+	return normalize(node, false, false)
+}
+
+// NormalizeWithNegatedMethods returns the normalized form of the conditions tree where NOT nodes are also pushed into conditions
+// (by negating their methods [EQ<->NEQ, EX<->NEX, RE<->NRE, IN<->NIN, PREFIX<->NPREFIX etc.]) and into ANY/ALL nodes (by replacing ANY with ALL and vice versa).
+// It is not meant for evaluation, comparison or hashing: the negated methods differ from the NOT nodes for missing attributes.
+func NormalizeWithNegatedMethods(node Node) Node {
+	return normalize(node, false, true)
+}
+
+// normalize returns the normalized form of the node (or of its negation if negate is true).
+// the methods of conditions and ANY/ALL nodes are negated only if negateMethods is true.
+func normalize(node Node, negate, negateMethods bool) Node {
+
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case True, *True:
+		if negate {
+			return False{}
+		}
+		return True{}
+	case False, *False:
+		if negate {
+			return True{}
+		}
+		return False{}
+	case *Not:
+		return normalize(n.Node, !negate, negateMethods)
+	case *And:
+		if negate {
+			return normalizeOr(n.Nodes, true, negateMethods) // De Morgan
+		}
+		return normalizeAnd(n.Nodes, false, negateMethods)
+	case *Or:
+		if negate {
+			return normalizeAnd(n.Nodes, true, negateMethods) // De Morgan
+		}
+		return normalizeOr(n.Nodes, false, negateMethods)
+	case *Condition:
+		if negate && !negateMethods {
+			return &Not{Node: n}
+		}
+		if negate {
+			negatedMethod, ok := negatedMethods[strings.ToUpper(n.Method)]
+			negatedOriginalMethod := negatedMethod
+			if ok && len(n.OriginalMethod) > 0 { // a prepared condition (for example IN that was converted to RE)
+				negatedOriginalMethod, ok = negatedMethods[strings.ToUpper(n.OriginalMethod)]
+			}
+			if !ok {
+				return &Not{Node: n}
+			}
+			c := *n
+			c.Method = negatedMethod
+			if len(c.OriginalMethod) > 0 {
+				c.OriginalMethod = negatedOriginalMethod
+			}
+			return &c
+		}
+		return n
+	case *Any:
+		if negate && negateMethods && len(n.ReturnValueJsonpath) == 0 { // NOT(ANY(x)) == ALL(NOT(x))
+			a := All{
+				ParentJsonpathAttribute:         n.ParentJsonpathAttribute,
+				ParentJsonpathAttributeArray:    n.ParentJsonpathAttributeArray,
+				ParentJsonpathAttributeOriginal: n.ParentJsonpathAttributeOriginal,
+				Node:                            normalize(n.Node, true, negateMethods),
+				PreparedJsonpathQuery:           n.PreparedJsonpathQuery,
+			}
+			return &a
+		}
+		a := *n
+		a.Node = normalize(n.Node, false, negateMethods)
+		return negateIf(&a, negate)
+	case *All:
+		if negate && negateMethods { // NOT(ALL(x)) == ANY(NOT(x))
+			a := Any{
+				ParentJsonpathAttribute:         n.ParentJsonpathAttribute,
+				ParentJsonpathAttributeArray:    n.ParentJsonpathAttributeArray,
+				ParentJsonpathAttributeOriginal: n.ParentJsonpathAttributeOriginal,
+				Node:                            normalize(n.Node, true, negateMethods),
+				PreparedJsonpathQuery:           n.PreparedJsonpathQuery,
+			}
+			return &a
+		}
+		a := *n
+		a.Node = normalize(n.Node, false, negateMethods)
+		return negateIf(&a, negate)
+	case *Count:
+		c := *n
+		c.Node = normalize(n.Node, false, negateMethods)
+		return negateIf(&c, negate)
+	case *AtLeast:
+		return negateIf(&AtLeast{N: n.N, Nodes: normalizeNodes(n.Nodes, negateMethods)}, negate)
+	case *AtMost:
+		return negateIf(&AtMost{N: n.N, Nodes: normalizeNodes(n.Nodes, negateMethods)}, negate)
+	case *Exactly:
+		return negateIf(&Exactly{N: n.N, Nodes: normalizeNodes(n.Nodes, negateMethods)}, negate)
+	case *Xor:
+		return negateIf(&Xor{Nodes: normalizeNodes(n.Nodes, negateMethods)}, negate)
+	default: // REF nodes etc...
+		return negateIf(node, negate)
+	}
+}
+
+func negateIf(node Node, negate bool) Node {
+	if negate {
+		return &Not{Node: node}
+	}
+	return node
+}
+
+func normalizeNodes(nodes []Node, negateMethods bool) []Node {
+	normalizedNodes := make([]Node, len(nodes))
+	for i, node := range nodes {
+		normalizedNodes[i] = normalize(node, false, negateMethods)
+	}
+	return normalizedNodes
+}
+
+// normalizeAnd returns the normalized AND of the nodes (or of their negations)
+func normalizeAnd(nodes []Node, negate, negateMethods bool) Node {
+
+	normalizedNodes := []Node{}
+	seen := map[string]bool{}
+	for _, node := range nodes {
+		normalizedNode := normalize(node, negate, negateMethods)
+		subNodes := []Node{normalizedNode}
+		switch n := normalizedNode.(type) {
+		case True:
+			continue
+		case False:
+			return False{}
+		case *And: // flatten
+			subNodes = n.Nodes
+		}
+		for _, subNode := range subNodes {
+			str := subNode.String()
+			if !seen[str] {
+				seen[str] = true
+				normalizedNodes = append(normalizedNodes, subNode)
+			}
+		}
+	}
+
+	switch len(normalizedNodes) {
+	case 0:
+		return True{}
+	case 1:
+		return normalizedNodes[0]
+	default:
+		return &And{Nodes: normalizedNodes}
+	}
+}
+
+// normalizeOr returns the normalized OR of the nodes (or of their negations)
+func normalizeOr(nodes []Node, negate, negateMethods bool) Node {
+
+	normalizedNodes := []Node{}
+	seen := map[string]bool{}
+	for _, node := range nodes {
+		normalizedNode := normalize(node, negate, negateMethods)
+		subNodes := []Node{normalizedNode}
+		switch n := normalizedNode.(type) {
+		case False:
+			continue
+		case True:
+			return True{}
+		case *Or: // flatten
+			subNodes = n.Nodes
+		}
+		for _, subNode := range subNodes {
+			str := subNode.String()
+			if !seen[str] {
+				seen[str] = true
+				normalizedNodes = append(normalizedNodes, subNode)
+			}
+		}
+	}
+
+	switch len(normalizedNodes) {
+	case 0:
+		return False{}
+	case 1:
+		return normalizedNodes[0]
+	default:
+		return &Or{Nodes: normalizedNodes}
+	}
+}
@@ -0,0 +1,334 @@
+package MAPL_engine
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+var normalizeTestCases = []struct {
+	conditions    string
+	normalized    string // the equivalent conditions (already in normalized form)
+	negateMethods bool   // normalize with NormalizeWithNegatedMethods
+}{
+	{ // nested AND nodes are flattened
+		conditions: `
+AND:
+- attribute: "jsonpath:$.a"
+  method: EQ
+  value: "1"
+- AND:
+  - attribute: "jsonpath:$.b"
+    method: EQ
+    value: "2"
+  - AND:
+    - attribute: "jsonpath:$.c"
+      method: EQ
+      value: "3"`,
+		normalized: `
+AND:
+- attribute: "jsonpath:$.c"
+  method: EQ
+  value: "3"
+- attribute: "jsonpath:$.b"
+  method: EQ
+  value: "2"
+- attribute: "jsonpath:$.a"
+  method: EQ
+  value: "1"`,
+	},
+	{ // duplicates are removed
+		conditions: `
+OR:
+- attribute: "jsonpath:$.a"
+  method: EQ
+  value: "1"
+- attribute: "jsonpath:$.b"
+  method: EX
+- attribute: "jsonpath:$.a"
+  method: EQ
+  value: "1"`,
+		normalized: `
+OR:
+- attribute: "jsonpath:$.b"
+  method: EX
+- attribute: "jsonpath:$.a"
+  method: EQ
+  value: "1"`,
+	},
+	{ // double NOT
+		conditions: `
+NOT:
+  NOT:
+    attribute: "jsonpath:$.a"
+    method: RE
+    value: "^abc"`,
+		normalized: `
+attribute: "jsonpath:$.a"
+method: RE
+value: "^abc"`,
+	},
+	{ // NOT is pushed inward by De Morgan (but not into conditions)
+		conditions: `
+NOT:
+  AND:
+  - attribute: "jsonpath:$.a"
+    method: EQ
+    value: "1"
+  - attribute: "jsonpath:$.b"
+    method: NEX
+  - attribute: "jsonpath:$.c"
+    method: RE
+    value: "x"
+  - attribute: "jsonpath:$.d"
+    method: GT
+    value: 5`,
+		normalized: `
+OR:
+- NOT:
+    attribute: "jsonpath:$.a"
+    method: EQ
+    value: "1"
+- NOT:
+    attribute: "jsonpath:$.b"
+    method: NEX
+- NOT:
+    attribute: "jsonpath:$.c"
+    method: RE
+    value: "x"
+- NOT:
+    attribute: "jsonpath:$.d"
+    method: GT
+    value: 5`,
+	},
+	{ // NOT(ANY) is kept
+		conditions: `
+NOT:
+  ANY:
+    parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+    condition:
+      attribute: "jsonpath:$RELATIVE.image"
+      method: EQ
+      value: "busybox"`,
+		normalized: `
+NOT:
+  ANY:
+    parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+    condition:
+      attribute: "jsonpath:$RELATIVE.image"
+      method: EQ
+      value: "busybox"`,
+	},
+	{ // NOT(ALL) is kept and the tree in the ALL node is normalized
+		conditions: `
+NOT:
+  ALL:
+    parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+    AND:
+    - attribute: "jsonpath:$RELATIVE.image"
+      method: EQ
+      value: "busybox"
+    - NOT:
+        OR:
+        - attribute: "jsonpath:$RELATIVE.name"
+          method: EX
+        - attribute: "jsonpath:$RELATIVE.name"
+          method: EQ
+          value: "c1"`,
+		normalized: `
+NOT:
+  ALL:
+    parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+    AND:
+    - attribute: "jsonpath:$RELATIVE.image"
+      method: EQ
+      value: "busybox"
+    - NOT:
+        attribute: "jsonpath:$RELATIVE.name"
+        method: EX
+    - NOT:
+        attribute: "jsonpath:$RELATIVE.name"
+        method: EQ
+        value: "c1"`,
+	},
+	{ // NOT is pushed inward (De Morgan and negated methods)
+		negateMethods: true,
+		conditions: `
+NOT:
+  AND:
+  - attribute: "jsonpath:$.a"
+    method: EQ
+    value: "1"
+  - attribute: "jsonpath:$.b"
+    method: NEX
+  - attribute: "jsonpath:$.c"
+    method: RE
+    value: "x"
+  - attribute: "jsonpath:$.d"
+    method: GT
+    value: 5`,
+		normalized: `
+OR:
+- attribute: "jsonpath:$.a"
+  method: NEQ
+  value: "1"
+- attribute: "jsonpath:$.b"
+  method: EX
+- attribute: "jsonpath:$.c"
+  method: NRE
+  value: "x"
+- NOT:
+    attribute: "jsonpath:$.d"
+    method: GT
+    value: 5`,
+	},
+	{ // NOT(ANY) == ALL(NOT)
+		negateMethods: true,
+		conditions: `
+NOT:
+  ANY:
+    parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+    condition:
+      attribute: "jsonpath:$RELATIVE.image"
+      method: EQ
+      value: "busybox"`,
+		normalized: `
+ALL:
+  parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+  condition:
+    attribute: "jsonpath:$RELATIVE.image"
+    method: NEQ
+    value: "busybox"`,
+	},
+	{ // NOT(ALL) == ANY(NOT) and nested ORs in the ANY node are flattened
+		negateMethods: true,
+		conditions: `
+NOT:
+  ALL:
+    parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+    AND:
+    - attribute: "jsonpath:$RELATIVE.image"
+      method: EQ
+      value: "busybox"
+    - NOT:
+        OR:
+        - attribute: "jsonpath:$RELATIVE.name"
+          method: EX
+        - attribute: "jsonpath:$RELATIVE.name"
+          method: EQ
+          value: "c1"`,
+		normalized: `
+ANY:
+  parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+  OR:
+  - attribute: "jsonpath:$RELATIVE.name"
+    method: EX
+  - attribute: "jsonpath:$RELATIVE.image"
+    method: NEQ
+    value: "busybox"
+  - attribute: "jsonpath:$RELATIVE.name"
+    method: EQ
+    value: "c1"`,
+	},
+}
+
+func normalizeTestConditionsTree(conditions string) ConditionsTree {
+	var c ConditionsTree
+	err := yaml.Unmarshal([]byte(conditions), &c)
+	So(err, ShouldBeNil)
+	return c
+}
+
+func TestNormalize(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test the normalization of conditions trees"
+		fmt.Println(str)
+
+		for _, testCase := range normalizeTestCases {
+			c := normalizeTestConditionsTree(testCase.conditions)
+			expected := normalizeTestConditionsTree(testCase.normalized)
+			originalString := c.ConditionsTree.String()
+
+			normalize := Normalize
+			if testCase.negateMethods {
+				normalize = NormalizeWithNegatedMethods
+			}
+			So(normalize(c.ConditionsTree).String(), ShouldEqual, expected.ConditionsTree.String())
+			So(normalize(expected.ConditionsTree).String(), ShouldEqual, expected.ConditionsTree.String()) // the normalized form is a fixed point
+			So(normalize(normalize(c.ConditionsTree)).String(), ShouldEqual, expected.ConditionsTree.String())
+			So(c.ConditionsTree.String(), ShouldEqual, originalString) // the tree is not changed
+
+			rule1 := Rule{Conditions: c}
+			rule2 := Rule{Conditions: expected}
+			So(rule1.ConditionsEqual(rule2), ShouldEqual, !testCase.negateMethods)
+			So(RuleMD5Hash(rule1) == RuleMD5Hash(rule2), ShouldEqual, !testCase.negateMethods)
+		}
+
+		str = "test the folding of TRUE/FALSE nodes"
+		fmt.Println(str)
+
+		c := normalizeTestConditionsTree("attribute: \"jsonpath:$.a\"\nmethod: EQ\nvalue: \"1\"")
+		a := c.ConditionsTree
+		So(Normalize(&And{Nodes: []Node{a, True{}}}).String(), ShouldEqual, a.String())
+		So(Normalize(&And{Nodes: []Node{a, False{}}}), ShouldResemble, False{})
+		So(Normalize(&Or{Nodes: []Node{a, True{}}}), ShouldResemble, True{})
+		So(Normalize(&Or{Nodes: []Node{a, False{}}}).String(), ShouldEqual, a.String())
+		So(Normalize(&Not{Node: &And{Nodes: []Node{a, False{}}}}), ShouldResemble, True{})
+		So(Normalize(&Not{Node: &Or{Nodes: []Node{False{}, False{}}}}), ShouldResemble, True{})
+		So(Normalize(&AtLeast{N: 1, Nodes: []Node{&Not{Node: &Not{Node: a}}, True{}}}).String(), ShouldEqual, (&AtLeast{N: 1, Nodes: []Node{a, True{}}}).String())
+		So(Normalize(nil), ShouldBeNil)
+
+		str = "test that different conditions are not equal"
+		fmt.Println(str)
+
+		c1 := normalizeTestConditionsTree(normalizeTestCases[3].conditions)
+		c2 := normalizeTestConditionsTree(normalizeTestCases[4].conditions)
+		So(Rule{Conditions: c1}.ConditionsEqual(Rule{Conditions: c2}), ShouldBeFalse)
+		c3 := normalizeTestConditionsTree("NOT:\n  attribute: \"jsonpath:$.a\"\n  method: EQ\n  value: \"1\"")
+		So(Rule{Conditions: c3}.ConditionsEqual(Rule{Conditions: c}), ShouldBeFalse)
+
+		str = "test that NOT(EQ) and NEQ are not equal"
+		fmt.Println(str)
+
+		c4 := normalizeTestConditionsTree("attribute: \"jsonpath:$.a\"\nmethod: NEQ\nvalue: \"1\"")
+		So(Rule{Conditions: c3}.ConditionsEqual(Rule{Conditions: c4}), ShouldBeFalse) // a missing attribute satisfies NOT(EQ) but not NEQ
+		So(RuleMD5HashConditions(Rule{Conditions: c3}), ShouldNotEqual, RuleMD5HashConditions(Rule{Conditions: c4}))
+		So(NormalizeWithNegatedMethods(c3.ConditionsTree).String(), ShouldEqual, NormalizeWithNegatedMethods(c4.ConditionsTree).String())
+		So(c3.ConditionsTree.PrepareAndValidate(PredefinedStringsAndLists{}), ShouldBeNil)
+		So(c4.ConditionsTree.PrepareAndValidate(PredefinedStringsAndLists{}), ShouldBeNil)
+		emptyData := []byte(`{"b":"2"}`)
+		emptyMessage := MessageAttributes{RequestJsonRaw: &emptyData}
+		flag3, _ := c3.ConditionsTree.Eval(&emptyMessage)
+		flag4, _ := c4.ConditionsTree.Eval(&emptyMessage)
+		So(flag3, ShouldBeTrue)
+		So(flag4, ShouldBeFalse)
+
+		str = "test the evaluation of normalized conditions"
+		fmt.Println(str)
+
+		data, err := ReadBinaryFile("../files/raw_json_data/count/json_raw_data_4containers.json")
+		So(err, ShouldBeNil)
+		var dataInterface interface{}
+		err = json.Unmarshal(data, &dataInterface)
+		So(err, ShouldBeNil)
+		message := MessageAttributes{RequestJsonRaw: &data, RequestRawInterface: &dataInterface}
+
+		for _, testCase := range normalizeTestCases {
+			c := normalizeTestConditionsTree(testCase.conditions)
+			err = c.ConditionsTree.PrepareAndValidate(PredefinedStringsAndLists{})
+			So(err, ShouldBeNil)
+			flag1, _ := c.ConditionsTree.Eval(&message)
+			flag2, _ := Normalize(c.ConditionsTree).Eval(&message)
+			So(flag1, ShouldEqual, flag2)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package MAPL_engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//--------------------------------------
+// PolicyHolder
+//--------------------------------------
+
+// PolicyHolder holds the current version of an immutable PolicySet.
+// A new version is swapped in atomically: checks that already loaded the previous version complete with it and the following checks use the new one.
+type PolicyHolder struct {
+	current atomic.Value // policyVersion
+
+	lock      sync.Mutex // serializes the swaps and the change events
+	version   uint64
+	listeners []func(PolicyChangeEvent)
+}
+
+type policyVersion struct {
+	policySet *PolicySet
+	version   uint64
+}
+
+// PolicyChangeEvent is emitted when a new version of the PolicySet is swapped in
+type PolicyChangeEvent struct {
+	Version           uint64     // the version that was swapped in
+	PreviousVersion   uint64     // the version that was swapped out (0 if there was none)
+	PolicySet         *PolicySet // the PolicySet that was swapped in
+	PreviousPolicySet *PolicySet // the PolicySet that was swapped out (nil if there was none)
+	Time              time.Time
+}
+
+// NewPolicyHolder returns a holder of the PolicySet (as version 1). The PolicySet may be nil if it is loaded later (see Swap).
+func NewPolicyHolder(policySet *PolicySet) *PolicyHolder {
+	h := &PolicyHolder{}
+	h.current.Store(policyVersion{})
+	if policySet != nil {
+		h.Swap(policySet)
+	}
+	return h
+}
+
+// Load returns the current PolicySet and its version (nil and 0 if no PolicySet was swapped in)
+func (h *PolicyHolder) Load() (*PolicySet, uint64) {
+	current := h.current.Load().(policyVersion)
+	return current.policySet, current.version
+}
+
+// Swap atomically replaces the PolicySet and returns the version of the new PolicySet.
+// The change event is sent to the listeners (in the order they were added) before Swap returns.
+func (h *PolicyHolder) Swap(policySet *PolicySet) uint64 {
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	previous := h.current.Load().(policyVersion)
+	h.version++
+	h.current.Store(policyVersion{policySet: policySet, version: h.version})
+
+	event := PolicyChangeEvent{
+		Version:           h.version,
+		PreviousVersion:   previous.version,
+		PolicySet:         policySet,
+		PreviousPolicySet: previous.policySet,
+		Time:              time.Now(),
+	}
+	for _, listener := range h.listeners {
+		listener(event)
+	}
+	return h.version
+}
+
+// Reload compiles the rule set (see CompilePolicySet) and swaps it in. If the compilation fails then the current PolicySet is kept.
+func (h *PolicyHolder) Reload(rules *Rules, stringsAndlists PredefinedStringsAndLists, options ...CheckOption) (uint64, error) {
+
+	policySet, err := CompilePolicySet(rules, stringsAndlists, options...)
+	if err != nil {
+		return 0, err
+	}
+	return h.Swap(policySet), nil
+}
+
+// OnChange adds a listener of the change events. Listeners are called synchronously and must not swap the PolicySet.
+func (h *PolicyHolder) OnChange(listener func(PolicyChangeEvent)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.listeners = append(h.listeners, listener)
+}
+
+// CheckWithContext checks the message against the current PolicySet (see MAPL_engine.CheckWithContext).
+// The version of the PolicySet that was used is given in the result.
+func (h *PolicyHolder) CheckWithContext(ctx context.Context, message *MessageAttributes, options ...CheckOption) (Result, error) {
+
+	policySet, version := h.Load()
+	if policySet == nil {
+		return Result{}, fmt.Errorf("no policy set was loaded")
+	}
+	result, err := policySet.CheckWithContext(ctx, message, options...)
+	result.PolicyVersion = version
+	return result, err
+}
@@ -0,0 +1,190 @@
+package MAPL_engine
+
+import (
+	"context"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"io/ioutil"
+	"log"
+	"sync"
+	"testing"
+)
+
+const policyHolderTestRules = `
+rules:
+  - ruleID: "senders"
+    sender:
+      senderName: "#senders"
+      senderType: "*"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "*"
+    protocol: http
+    resource:
+      resourceType: path
+      resourceName: "/*"
+    operation: GET
+    decision: allow
+`
+
+func TestPolicyHolder(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		messages, err := YamlReadMessagesFromString(decisionsTestMessages)
+		So(err, ShouldBeNil)
+		message := messages.Messages[1] // A.my_namespace -> B.my_namespace GET /admin/123
+
+		str := "test an immutable policy set"
+		fmt.Println(str)
+
+		rules, err := YamlReadRulesFromString(decisionsTestHeader + decisionsTestRules)
+		So(err, ShouldBeNil)
+		policySet, err := CompilePolicySet(&rules, PredefinedStringsAndLists{})
+		So(err, ShouldBeNil)
+		So(policySet.NumberOfRules(), ShouldEqual, 3)
+
+		result, err := policySet.CheckWithContext(context.Background(), &message)
+		So(err, ShouldBeNil)
+		So(result.DecisionString, ShouldEqual, "quarantine")
+
+		rules.Rules[2].Decision = "allow" // changes to the rule set don't affect the compiled policy set
+		rules.Rules[2].Sender.SenderName = "C.my_namespace"
+		rules.Rules[2].Obligations[0].Payload["queue"] = "OPS"
+		result, err = policySet.CheckWithContext(context.Background(), &message)
+		So(err, ShouldBeNil)
+		So(result.DecisionString, ShouldEqual, "quarantine")
+		So(result.Obligations[0].Payload["queue"], ShouldEqual, "SEC")
+
+		decision, decisionString, _, _, _, _, _ := policySet.Check(&message)
+		So(decision, ShouldEqual, result.Decision)
+		So(decisionString, ShouldEqual, "quarantine")
+
+		str = "test the default options of a policy set"
+		fmt.Println(str)
+
+		rules, err = YamlReadRulesFromString(decisionsTestHeader + decisionsTestRules)
+		So(err, ShouldBeNil)
+		policySet, err = CompilePolicySet(&rules, PredefinedStringsAndLists{}, WithCombiningAlgorithm(FirstApplicable))
+		So(err, ShouldBeNil)
+		result, err = policySet.CheckWithContext(context.Background(), &message)
+		So(err, ShouldBeNil)
+		So(result.DecisionString, ShouldEqual, "warn")
+		result, err = policySet.CheckWithContext(context.Background(), &message, WithCombiningAlgorithm(MaxDecision)) // overrides the default option
+		So(err, ShouldBeNil)
+		So(result.DecisionString, ShouldEqual, "quarantine")
+
+		_, err = CompilePolicySet(&rules, PredefinedStringsAndLists{}, WithCombiningAlgorithm("no-such-algorithm"))
+		So(err, ShouldNotBeNil)
+
+		str = "test the predefined strings and lists of a policy set"
+		fmt.Println(str)
+
+		rules, err = YamlReadRulesFromString(policyHolderTestRules)
+		So(err, ShouldBeNil)
+		listsWithA := PredefinedStringsAndLists{PredefinedLists: map[string][]string{"senders": {"A.my_namespace", "C.my_namespace"}}}
+		listsWithoutA := PredefinedStringsAndLists{PredefinedLists: map[string][]string{"senders": {"C.my_namespace"}}}
+
+		policySetWithA, err := CompilePolicySet(&rules, listsWithA)
+		So(err, ShouldBeNil)
+		policySetWithoutA, err := CompilePolicySet(&rules, listsWithoutA)
+		So(err, ShouldBeNil)
+		listsWithA.PredefinedLists["senders"][0] = "D.my_namespace" // changes to the lists don't affect the compiled policy set
+
+		result, err = policySetWithA.CheckWithContext(context.Background(), &message)
+		So(err, ShouldBeNil)
+		So(result.Decision, ShouldEqual, ALLOW)
+		result, err = policySetWithoutA.CheckWithContext(context.Background(), &message)
+		So(err, ShouldBeNil)
+		So(result.Decision, ShouldEqual, DEFAULT)
+
+		_, err = CompilePolicySet(&rules, PredefinedStringsAndLists{PredefinedLists: map[string][]string{"senders": {"#missing"}}})
+		So(err, ShouldNotBeNil)
+
+		str = "test swapping policy sets"
+		fmt.Println(str)
+
+		holder := NewPolicyHolder(nil)
+		_, err = holder.CheckWithContext(context.Background(), &message)
+		So(err, ShouldNotBeNil)
+
+		events := []PolicyChangeEvent{}
+		holder.OnChange(func(event PolicyChangeEvent) {
+			events = append(events, event)
+		})
+
+		version := holder.Swap(policySetWithA)
+		So(version, ShouldEqual, 1)
+		result, err = holder.CheckWithContext(context.Background(), &message)
+		So(err, ShouldBeNil)
+		So(result.Decision, ShouldEqual, ALLOW)
+		So(result.PolicyVersion, ShouldEqual, 1)
+
+		version, err = holder.Reload(&rules, listsWithoutA)
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, 2)
+		result, err = holder.CheckWithContext(context.Background(), &message)
+		So(err, ShouldBeNil)
+		So(result.Decision, ShouldEqual, DEFAULT)
+		So(result.PolicyVersion, ShouldEqual, 2)
+
+		_, err = holder.Reload(&rules, PredefinedStringsAndLists{PredefinedLists: map[string][]string{"senders": {"#missing"}}})
+		So(err, ShouldNotBeNil)
+		current, version := holder.Load()
+		So(version, ShouldEqual, 2) // the current policy set is kept
+		So(current, ShouldNotBeNil)
+
+		So(events, ShouldHaveLength, 2)
+		So(events[0].Version, ShouldEqual, 1)
+		So(events[0].PreviousVersion, ShouldEqual, 0)
+		So(events[0].PreviousPolicySet, ShouldBeNil)
+		So(events[0].PolicySet, ShouldEqual, policySetWithA)
+		So(events[1].Version, ShouldEqual, 2)
+		So(events[1].PreviousPolicySet, ShouldEqual, policySetWithA)
+		So(events[1].PolicySet, ShouldEqual, current)
+
+		str = "test checks that run while the policy set is swapped (run with go test -race)"
+		fmt.Println(str)
+
+		holder = NewPolicyHolder(policySetWithA)
+		var wg sync.WaitGroup
+		errs := make(chan error, 64)
+		for g := 0; g < 16; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				messageCopy := message
+				for r := 0; r < 50; r++ {
+					result, err := holder.CheckWithContext(context.Background(), &messageCopy)
+					if err != nil {
+						errs <- err
+						return
+					}
+					expected := ALLOW // odd versions allow and even versions don't
+					if result.PolicyVersion%2 == 0 {
+						expected = DEFAULT
+					}
+					if result.Decision != expected {
+						errs <- fmt.Errorf("version %v: decision %v", result.PolicyVersion, result.Decision)
+						return
+					}
+				}
+			}()
+		}
+		for r := 0; r < 50; r++ {
+			if r%2 == 0 {
+				holder.Swap(policySetWithoutA)
+			} else {
+				holder.Swap(policySetWithA)
+			}
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			So(err, ShouldBeNil)
+		}
+	})
+}
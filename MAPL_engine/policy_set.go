@@ -0,0 +1,506 @@
+package MAPL_engine
+
+import (
+	"context"
+	"fmt"
+	"gopkg.in/getlantern/deepcopy.v1"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+//--------------------------------------
+// PolicySet
+//--------------------------------------
+
+// PolicySet is a compiled view of a rule set.
+// It indexes the rules by protocol, resource type, operation verb and literal or prefix sender/receiver names so that
+// Check evaluates only the rules that can possibly apply to a message instead of scanning all of them.
+// The index is only a pre-filter: every candidate rule is still checked with CheckOneRule, so the results are the same as the linear scan.
+type PolicySet struct {
+	rules   *Rules
+	options []CheckOption // the default options of checks against the PolicySet (see CompilePolicySet)
+
+	specificity []int // the specificity of each rule (used by the most-specific combining algorithm)
+
+	decisions     decisionVocabulary
+	decisionsErr  error // the error in the user-defined decisions (the built-in decisions are used instead)
+	ruleDecisions []int // the decision code of each rule (-1 if the decision is not supported)
+
+	indexed           bool // false if every rule is a candidate (see newLinearPolicySet)
+	protocolIndex     policySetIndex
+	resourceTypeIndex policySetIndex
+	operationIndex    policySetIndex
+	senderIndex       policySetIndex
+	receiverIndex     policySetIndex
+}
+
+// policySetIndex maps the values of one message attribute to the rules that may match it
+type policySetIndex struct {
+	exact    map[string]ruleBitset
+	prefix   map[string]ruleBitset
+	wildcard ruleBitset // rules that match any value (or that we can't index)
+}
+
+const (
+	senderReceiverWorkloadNamespace = "workload\x00"
+	senderReceiverHostnameNamespace = "hostname\x00"
+)
+
+var rulesPreparationLock sync.RWMutex // guards the preparation of rules by concurrent checks (see Rules.prepare)
+
+var rulesGeneration uint64 // incremented on every preparation of a rule (see Rule.SetPredefinedStringsAndLists). invalidates the cached PolicySets
+
+const maxCachedPolicySets = 64
+
+// policySetCache holds the PolicySets compiled by the checks that take the rules instead of a PolicySet (see cachedPolicySet)
+var policySetCache struct {
+	entries sync.Map // *Rules -> *cachedRulesPolicySet
+	lock    sync.Mutex
+	size    int
+}
+
+// cachedRulesPolicySet is a PolicySet compiled from a rule set and the state of the rule set when it was compiled
+type cachedRulesPolicySet struct {
+	policySet  *PolicySet
+	generation uint64
+	rules      []Rule
+	decisions  []DecisionDefinition
+}
+
+// NewPolicySet compiles the rule set into a PolicySet.
+// Rules that were not prepared yet are prepared with the global predefined strings and lists.
+// After that the rules are only read, so the PolicySet (and the rule set) may be checked from many goroutines.
+// The PolicySet should be compiled again (or swapped with a PolicyHolder) when the rules change.
+func NewPolicySet(rules *Rules) *PolicySet {
+
+	p := newLinearPolicySet(rules)
+
+	N := len(rules.Rules)
+	p.indexed = true
+	p.protocolIndex = newPolicySetIndex(N)
+	p.resourceTypeIndex = newPolicySetIndex(N)
+	p.operationIndex = newPolicySetIndex(N)
+	p.senderIndex = newPolicySetIndex(N)
+	p.receiverIndex = newPolicySetIndex(N)
+	for i := range rules.Rules {
+		p.addRule(i, &rules.Rules[i])
+	}
+	return p
+}
+
+// newLinearPolicySet compiles the rule set into a PolicySet without an index (every rule is a candidate)
+func newLinearPolicySet(rules *Rules) *PolicySet {
+
+	rules.prepare()
+
+	N := len(rules.Rules)
+	p := &PolicySet{
+		rules:         rules,
+		specificity:   make([]int, N),
+		ruleDecisions: make([]int, N),
+	}
+
+	p.decisions, p.decisionsErr = newDecisionVocabulary(rules.Decisions)
+
+	for i := range rules.Rules {
+		rule := &rules.Rules[i]
+		p.ruleDecisions[i] = p.decisions.code(rule.Decision)
+		if rule.preparedRule != nil {
+			p.specificity[i] = ruleSpecificity(rule.preparedRule)
+		} else {
+			p.specificity[i] = ruleSpecificity(rule)
+		}
+	}
+	return p
+}
+
+// cachedPolicySet returns the PolicySet of the rule set. it is compiled by the first check and compiled again when the rule set changes:
+// when rules are added, removed or prepared again (a changed rule needs to be prepared again with SetPredefinedStringsAndLists) or when the decisions are replaced.
+// a check with the cached PolicySet doesn't lock or scan the rules.
+func cachedPolicySet(rules *Rules) *PolicySet {
+
+	if entry, ok := policySetCache.entries.Load(rules); ok {
+		cached := entry.(*cachedRulesPolicySet)
+		if cached.generation == atomic.LoadUint64(&rulesGeneration) && cached.isUpToDate(rules) {
+			return cached.policySet
+		}
+	}
+
+	rules.prepare()
+	cached := &cachedRulesPolicySet{
+		generation: atomic.LoadUint64(&rulesGeneration), // a concurrent preparation only makes the next check compile the PolicySet again
+		rules:      rules.Rules,
+		decisions:  rules.Decisions,
+	}
+	cached.policySet = NewPolicySet(rules)
+
+	policySetCache.lock.Lock()
+	defer policySetCache.lock.Unlock()
+	if _, ok := policySetCache.entries.Load(rules); !ok {
+		if policySetCache.size >= maxCachedPolicySets {
+			policySetCache.entries.Range(func(key, value interface{}) bool {
+				policySetCache.entries.Delete(key)
+				return true
+			})
+			policySetCache.size = 0
+		}
+		policySetCache.size++
+	}
+	policySetCache.entries.Store(rules, cached)
+	return cached.policySet
+}
+
+// isUpToDate tests if the rules and the decisions of the rule set are the ones the PolicySet was compiled from
+func (cached *cachedRulesPolicySet) isUpToDate(rules *Rules) bool {
+	return sameSlice(cached.rules, rules.Rules) && len(cached.decisions) == len(rules.Decisions) &&
+		(len(cached.decisions) == 0 || &cached.decisions[0] == &rules.Decisions[0])
+}
+
+func sameSlice(rules1, rules2 []Rule) bool {
+	return len(rules1) == len(rules2) && (len(rules1) == 0 || &rules1[0] == &rules2[0])
+}
+
+// CompilePolicySet compiles an immutable PolicySet from a copy of the rule set.
+// The rules are prepared with the given predefined strings and lists (not the global ones) and the options are the default options of every
+// check against the PolicySet (the options given to a check override them). Changes to the rule set after compilation don't affect the PolicySet.
+func CompilePolicySet(rules *Rules, stringsAndlists PredefinedStringsAndLists, options ...CheckOption) (*PolicySet, error) {
+
+	var stringsAndlistsCopy PredefinedStringsAndLists
+	err := deepcopy.Copy(&stringsAndlistsCopy, &stringsAndlists)
+	if err != nil {
+		return nil, err
+	}
+	stringsAndlists, err = validatePredefinedString(stringsAndlistsCopy)
+	if err != nil {
+		return nil, err
+	}
+
+	rulesCopy := Rules{
+		CombiningAlgorithm: rules.CombiningAlgorithm,
+		Decisions:          append([]DecisionDefinition{}, rules.Decisions...),
+		NoMatchDecision:    rules.NoMatchDecision,
+		ErrorDecision:      rules.ErrorDecision,
+		Rules:              make([]Rule, len(rules.Rules)),
+	}
+	for i := range rules.Rules {
+		err = deepcopy.Copy(&rulesCopy.Rules[i], &rules.Rules[i])
+		if err != nil {
+			return nil, err
+		}
+		err = rulesCopy.Rules[i].SetPredefinedStringsAndLists(stringsAndlists)
+		if err != nil {
+			return nil, fmt.Errorf("rule %v [%v]: %v", i, rules.Rules[i].RuleID, err)
+		}
+	}
+
+	err = validateDecisions(&rulesCopy)
+	if err != nil {
+		return nil, err
+	}
+	p := NewPolicySet(&rulesCopy)
+	p.options = append([]CheckOption{}, options...)
+	err = validateCombiningAlgorithm(p.newCheckOptions(nil).getCombiningAlgorithm(p.rules))
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// newCheckOptions gives the options of a check against the PolicySet (the PolicySet's default options followed by the given options)
+func (p *PolicySet) newCheckOptions(options []CheckOption) checkOptions {
+	if len(p.options) == 0 {
+		return newCheckOptions(options)
+	}
+	allOptions := make([]CheckOption, 0, len(p.options)+len(options))
+	allOptions = append(allOptions, p.options...)
+	return newCheckOptions(append(allOptions, options...))
+}
+
+// NumberOfRules gives the number of rules in the PolicySet
+func (p *PolicySet) NumberOfRules() int {
+	return len(p.rules.Rules)
+}
+
+// prepare prepares the rules that were not prepared yet (see Rule.SetPredefinedStringsAndLists).
+// a rule that fails preparation is left as is (and isn't prepared again by the next checks). the error is reported when the rule is checked.
+func (rules *Rules) prepare() {
+
+	rulesPreparationLock.RLock()
+	prepared := true
+	for i := range rules.Rules {
+		if rules.Rules[i].needsPreparation() {
+			prepared = false
+			break
+		}
+	}
+	rulesPreparationLock.RUnlock()
+	if prepared {
+		return
+	}
+
+	rulesPreparationLock.Lock()
+	defer rulesPreparationLock.Unlock()
+	for i := range rules.Rules {
+		rule := &rules.Rules[i]
+		if rule.needsPreparation() {
+			rule.preparationErr = rule.SetPredefinedStringsAndLists(GlobalPredefinedStringsAndLists)
+		}
+	}
+}
+
+func (rule *Rule) needsPreparation() bool {
+	return !rule.ruleAlreadyPrepared && rule.preparationErr == nil
+}
+
+func (p *PolicySet) addRule(i int, rule *Rule) {
+
+	// protocol and resource type:
+	switch rule.Protocol {
+	case "tcp", "*": // tcp rules test only the port. "*" rules test neither protocol nor resource
+		p.protocolIndex.wildcard.set(i)
+		p.resourceTypeIndex.wildcard.set(i)
+	default:
+		if isASCII(rule.Protocol) {
+			p.protocolIndex.addExact(strings.ToLower(rule.Protocol), i)
+		} else {
+			p.protocolIndex.wildcard.set(i)
+		}
+		if rule.Resource.ResourceType == "*" {
+			p.resourceTypeIndex.wildcard.set(i)
+		} else {
+			p.resourceTypeIndex.addExact(rule.Resource.ResourceType, i)
+		}
+	}
+
+	// operation:
+	switch rule.Operation {
+	case "*":
+		p.operationIndex.wildcard.set(i)
+	case "write", "WRITE":
+		for _, verb := range []string{"POST", "PUT", "DELETE"} {
+			p.operationIndex.addExact(verb, i)
+		}
+	case "read", "READ":
+		for _, verb := range []string{"GET", "HEAD", "OPTIONS", "TRACE", "read", "READ"} {
+			p.operationIndex.addExact(verb, i)
+		}
+	default:
+		p.operationIndex.addNames(strings.Split(rule.Operation, ","), "", strings.TrimSpace, i)
+	}
+
+	// sender and receiver:
+	sender, receiver := rule.Sender, rule.Receiver
+	if rule.preparedRule != nil {
+		sender, receiver = rule.preparedRule.Sender, rule.preparedRule.Receiver
+	}
+	if rule.preparedRule == nil && strings.HasPrefix(sender.SenderName, "#") { // replaced by a predefined string or list only when the rule is prepared
+		p.senderIndex.wildcard.set(i)
+	} else {
+		switch sender.SenderType {
+		case "*", "workload":
+			p.senderIndex.addNames(strings.Split(sender.SenderName, ","), senderReceiverWorkloadNamespace, removeSpaces, i)
+		default: // subnets and unsupported types
+			p.senderIndex.wildcard.set(i)
+		}
+	}
+	if rule.preparedRule == nil && strings.HasPrefix(receiver.ReceiverName, "#") {
+		p.receiverIndex.wildcard.set(i)
+	} else {
+		switch receiver.ReceiverType {
+		case "*", "workload":
+			p.receiverIndex.addNames(strings.Split(receiver.ReceiverName, ","), senderReceiverWorkloadNamespace, removeSpaces, i)
+		case "hostname":
+			p.receiverIndex.addNames(strings.Split(receiver.ReceiverName, ","), senderReceiverHostnameNamespace, removeSpaces, i)
+		default:
+			p.receiverIndex.wildcard.set(i)
+		}
+	}
+}
+
+// Candidates returns the indices (in rule order) of the rules that may apply to the message
+func (p *PolicySet) Candidates(message *MessageAttributes) []int {
+
+	if !p.indexed {
+		candidates := make([]int, len(p.rules.Rules))
+		for i := range candidates {
+			candidates[i] = i
+		}
+		return candidates
+	}
+
+	candidates := p.operationIndex.lookup(message.RequestMethod)
+	candidates.and(p.senderIndex.lookup(senderReceiverWorkloadNamespace + message.SourceService))
+
+	receivers := p.receiverIndex.lookup(senderReceiverWorkloadNamespace + message.DestinationService)
+	receivers.or(p.receiverIndex.lookup(senderReceiverHostnameNamespace + message.RequestHost))
+	candidates.and(receivers)
+
+	if isASCII(message.ContextProtocol) { // otherwise strings.EqualFold may match a rule's protocol in ways strings.ToLower doesn't
+		candidates.and(p.protocolIndex.lookup(strings.ToLower(message.ContextProtocol)))
+	}
+	candidates.and(p.resourceTypeIndex.lookup(message.ContextType))
+
+	return candidates.indices()
+}
+
+// Check gives the same results as MAPL_engine.Check on the rules the PolicySet was compiled from
+func (p *PolicySet) Check(message *MessageAttributes) (decision int, descisionString string, relevantRuleIndex int, results []int, appliedRulesIndices []int, ruleDescription string, checkExtraData [][]map[string]interface{}) {
+	return checkPolicySet(message, p)
+}
+
+// CheckWithContext checks the message against the PolicySet as MAPL_engine.CheckWithContext does
+func (p *PolicySet) CheckWithContext(ctx context.Context, message *MessageAttributes, options ...CheckOption) (Result, error) {
+	return checkPolicySetWithContext(NewEvalContext(ctx), message, p, p.newCheckOptions(options))
+}
+
+// checkRule gives the decision of rule i (in the rules' decision vocabulary) for the message.
+// if trace is not nil then the evaluation of the rule is traced in trace.Rules[i]
+func (p *PolicySet) checkRule(evalContext *EvalContext, message *MessageAttributes, i int, trace *Trace) (int, []map[string]interface{}, error) {
+
+	rule := p.rules.Rules[i] // a copy. the rule is prepared on the copy if it wasn't prepared already
+	if trace != nil {
+		var ruleTrace *RuleTrace
+		ruleTrace, evalContext = evalContext.newRuleTrace(i, rule.RuleID)
+		defer func() { trace.Rules[i] = *ruleTrace }()
+	}
+
+	decision, extraData, err := p.checkPreparedRule(evalContext, message, i, &rule)
+	evalContext.endRuleTrace(p.decisions.names[decision], decision != DEFAULT, err)
+	return decision, extraData, err
+}
+
+func (p *PolicySet) checkPreparedRule(evalContext *EvalContext, message *MessageAttributes, i int, rule *Rule) (int, []map[string]interface{}, error) {
+
+	match, extraData, err := matchOneRule(evalContext, message, rule)
+	if !match {
+		return DEFAULT, []map[string]interface{}{}, err
+	}
+	decision := p.decisions.code(rule.Decision) // the current decision of the rule (it may be changed without preparing the rule again)
+	if decision == -1 {
+		return DEFAULT, []map[string]interface{}{}, firstError(err, fmt.Errorf("decision not supported [%v]", rule.Decision))
+	}
+	return decision, extraData, err
+}
+
+//--------------------------------------
+// index utilities
+//--------------------------------------
+
+func newPolicySetIndex(N int) policySetIndex {
+	return policySetIndex{
+		exact:    make(map[string]ruleBitset),
+		prefix:   make(map[string]ruleBitset),
+		wildcard: newRuleBitset(N),
+	}
+}
+
+func (index *policySetIndex) addExact(key string, i int) {
+	bitset, ok := index.exact[key]
+	if !ok {
+		bitset = newRuleBitset(len(index.wildcard) * 64)
+		index.exact[key] = bitset
+	}
+	bitset.set(i)
+}
+
+func (index *policySetIndex) addPrefix(key string, i int) {
+	bitset, ok := index.prefix[key]
+	if !ok {
+		bitset = newRuleBitset(len(index.wildcard) * 64)
+		index.prefix[key] = bitset
+	}
+	bitset.set(i)
+}
+
+// addNames adds the names of a list (with the same conversion used when the names are converted to regex).
+// literal names are indexed as exact values, names ending with one '*' as prefixes and any other name makes the rule a wildcard.
+func (index *policySetIndex) addNames(names []string, namespace string, normalize func(string) string, i int) {
+	for _, name := range names {
+		name = normalize(name)
+		switch {
+		case isLiteralName(name):
+			index.addExact(namespace+name, i)
+		case strings.HasSuffix(name, "*") && isLiteralName(name[:len(name)-1]):
+			index.addPrefix(namespace+name[:len(name)-1], i)
+		default:
+			index.wildcard.set(i)
+			return
+		}
+	}
+}
+
+func (index *policySetIndex) lookup(value string) ruleBitset {
+	result := index.wildcard.copy()
+	if bitset, ok := index.exact[value]; ok {
+		result.or(bitset)
+	}
+	if len(index.prefix) > 0 {
+		for l := 0; l <= len(value); l++ {
+			if bitset, ok := index.prefix[value[:l]]; ok {
+				result.or(bitset)
+			}
+		}
+	}
+	return result
+}
+
+// isLiteralName tests that the name is matched literally after conversion to regex (see ConvertStringToRegex and ConvertStringToExpandedSenderReceiver)
+func isLiteralName(name string) bool {
+	return !strings.ContainsAny(name, `*?+()[]{}|\`)
+}
+
+func isASCII(str string) bool {
+	for i := 0; i < len(str); i++ {
+		if str[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func removeSpaces(str string) string {
+	return strings.Replace(str, " ", "", -1)
+}
+
+// ruleBitset is a set of rule indices
+type ruleBitset []uint64
+
+func newRuleBitset(N int) ruleBitset {
+	return make(ruleBitset, (N+63)/64)
+}
+
+func (b ruleBitset) set(i int) {
+	b[i/64] |= 1 << uint(i%64)
+}
+
+func (b ruleBitset) copy() ruleBitset {
+	out := make(ruleBitset, len(b))
+	copy(out, b)
+	return out
+}
+
+func (b ruleBitset) or(other ruleBitset) {
+	for i := range b {
+		b[i] |= other[i]
+	}
+}
+
+func (b ruleBitset) and(other ruleBitset) {
+	for i := range b {
+		b[i] &= other[i]
+	}
+}
+
+func (b ruleBitset) indices() []int {
+	out := []int{}
+	for i_word, word := range b {
+		for bit := 0; word != 0; bit++ {
+			if word&1 == 1 {
+				out = append(out, i_word*64+bit)
+			}
+			word >>= 1
+		}
+	}
+	return out
+}
@@ -0,0 +1,146 @@
+package MAPL_engine
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+var policySetTestFiles = [][]string{
+	{"../files/rules/main_fields/rules_basic.yaml", "../files/messages/main_fields/messages_basic_receiver_name.yaml"},
+	{"../files/rules/main_fields/rules_basic.yaml", "../files/messages/main_fields/messages_basic_sender_name.yaml"},
+	{"../files/rules/main_fields/rules_istio.yaml", "../files/messages/main_fields/messages_istio.yaml"},
+	{"../files/rules/main_fields/rules_operation_list.yaml", "../files/messages/main_fields/messages_operations_test_with_list.yaml"},
+	{"../files/rules/main_fields/rules_operations.yaml", "../files/messages/main_fields/messages_operations.yaml"},
+	{"../files/rules/main_fields/rules_receiver_with_wildcards.yaml", "../files/messages/main_fields/messages_receiver_name_test_with_wildcards.yaml"},
+	{"../files/rules/main_fields/rules_resource_lists.yaml", "../files/messages/main_fields/messages_resources_test_with_lists.yaml"},
+	{"../files/rules/main_fields/rules_resources.yaml", "../files/messages/main_fields/messages_resources.yaml"},
+	{"../files/rules/main_fields/rules_resources_with_wildcards.yaml", "../files/messages/main_fields/messages_resources_test_with_wildcards.yaml"},
+	{"../files/rules/main_fields/rules_sender_list.yaml", "../files/messages/main_fields/messages_sender_test_with_lists.yaml"},
+	{"../files/rules/main_fields/rules_sender_with_wildcards.yaml", "../files/messages/main_fields/messages_sender_name_test_with_wildcards.yaml"},
+	{"../files/rules/main_fields/rules_with_receiver_ips.yaml", "../files/messages/main_fields/messages_basic_receiver_ip.yaml"},
+	{"../files/rules/main_fields/rules_with_sender_ips.yaml", "../files/messages/main_fields/messages_basic_sender_ip.yaml"},
+}
+
+func TestPolicySet(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test that the policy set index gives the same results as the linear scan"
+		fmt.Println(str)
+
+		allRules := Rules{}
+		allMessages := Messages{}
+		for _, files := range policySetTestFiles {
+			rules, err := YamlReadRulesFromFile(files[0])
+			So(err, ShouldBeNil)
+			messages, err := YamlReadMessagesFromFile(files[1])
+			So(err, ShouldBeNil)
+
+			for i_message := range messages.Messages {
+				testPolicySetOneMessage(&messages.Messages[i_message], &rules)
+			}
+			allRules.Rules = append(allRules.Rules, rules.Rules...)
+			allMessages.Messages = append(allMessages.Messages, messages.Messages...)
+		}
+
+		// all the rules with all the messages:
+		for i_message := range allMessages.Messages {
+			testPolicySetOneMessage(&allMessages.Messages[i_message], &allRules)
+		}
+
+		// the same with rules prepared with predefined strings:
+		for i_rule := range allRules.Rules {
+			err := allRules.Rules[i_rule].SetPredefinedStringsAndLists(PredefinedStringsAndLists{})
+			So(err, ShouldBeNil)
+		}
+		for i_message := range allMessages.Messages {
+			testPolicySetOneMessage(&allMessages.Messages[i_message], &allRules)
+		}
+
+		str = "test that Check uses the current rules"
+		fmt.Println(str)
+
+		rules, err := YamlReadRulesFromFile("../files/rules/main_fields/rules_basic.yaml")
+		So(err, ShouldBeNil)
+		messages, err := YamlReadMessagesFromFile("../files/messages/main_fields/messages_basic_sender_name.yaml")
+		So(err, ShouldBeNil)
+		message := messages.Messages[1]
+
+		decision, _, _, _, _, _, _ := Check(&message, &rules)
+		So(decision, ShouldEqual, DEFAULT)
+		policySet := NewPolicySet(&rules)
+		decision, _, _, _, _, _, _ = policySet.Check(&message)
+		So(decision, ShouldEqual, DEFAULT)
+
+		newRule := rules.Rules[0]
+		newRule.Sender.SenderName = message.SourceService
+		err = newRule.SetPredefinedStringsAndLists(GlobalPredefinedStringsAndLists) // the rule was copied after it was prepared
+		So(err, ShouldBeNil)
+		rules.Rules = append(rules.Rules, newRule)
+		decision, _, _, _, _, _, _ = Check(&message, &rules)
+		So(decision, ShouldEqual, ALLOW)
+		decision, _, _, _, _, _, _ = NewPolicySet(&rules).Check(&message) // a PolicySet is compiled again when the rules change
+		So(decision, ShouldEqual, ALLOW)
+		So(fmt.Sprintf("%+v", rules), ShouldNotContainSubstring, "policySet") // the rules hold no compiled state
+
+		str = "test the PolicySet that Check compiles and caches"
+		fmt.Println(str)
+
+		policySet = cachedPolicySet(&rules)
+		So(policySet.indexed, ShouldBeTrue) // only the candidate rules are checked
+		So(cachedPolicySet(&rules), ShouldEqual, policySet)
+		err = rules.Rules[0].SetPredefinedStringsAndLists(GlobalPredefinedStringsAndLists) // a changed rule is prepared again
+		So(err, ShouldBeNil)
+		So(cachedPolicySet(&rules), ShouldNotEqual, policySet)
+		policySet = cachedPolicySet(&rules)
+		rules.Rules = rules.Rules[:len(rules.Rules)-1]
+		So(cachedPolicySet(&rules), ShouldNotEqual, policySet)
+		decision, _, _, _, _, _, _ = Check(&message, &rules)
+		So(decision, ShouldEqual, DEFAULT)
+
+		str = "test index lookup of literal and prefix names"
+		fmt.Println(str)
+
+		index := newPolicySetIndex(4)
+		index.addNames([]string{"A.my_namespace", " B.my_namespace "}, senderReceiverWorkloadNamespace, removeSpaces, 0)
+		index.addNames([]string{"A.*"}, senderReceiverWorkloadNamespace, removeSpaces, 1)
+		index.addNames([]string{"*.my_namespace"}, senderReceiverWorkloadNamespace, removeSpaces, 2)
+		index.addNames([]string{"C.my_namespace"}, senderReceiverWorkloadNamespace, removeSpaces, 3)
+
+		So(index.lookup(senderReceiverWorkloadNamespace+"A.my_namespace").indices(), ShouldResemble, []int{0, 1, 2})
+		So(index.lookup(senderReceiverWorkloadNamespace+"B.my_namespace").indices(), ShouldResemble, []int{0, 2})
+		So(index.lookup(senderReceiverWorkloadNamespace+"A.other").indices(), ShouldResemble, []int{1, 2})
+		So(index.lookup(senderReceiverWorkloadNamespace+"D.other").indices(), ShouldResemble, []int{2})
+	})
+}
+
+func testPolicySetOneMessage(message *MessageAttributes, rules *Rules) {
+
+	decision, decisionString, relevantRuleIndex, results, appliedRulesIndices, _, _ := Check(message, rules)
+
+	linearResults := make([]int, len(rules.Rules))
+	for i_rule, rule := range rules.Rules {
+		linearResults[i_rule], _ = CheckOneRule(message, &rule)
+	}
+	So(results, ShouldResemble, linearResults)
+
+	candidates := NewPolicySet(rules).Candidates(message)
+	for i_rule, result := range linearResults {
+		if result != DEFAULT {
+			So(candidates, ShouldContain, i_rule)
+		}
+	}
+
+	decision2, decisionString2, relevantRuleIndex2, results2, appliedRulesIndices2, _, _ := NewPolicySet(rules).Check(message)
+	So(decision2, ShouldEqual, decision)
+	So(decisionString2, ShouldEqual, decisionString)
+	So(relevantRuleIndex2, ShouldEqual, relevantRuleIndex)
+	So(results2, ShouldResemble, results)
+	So(appliedRulesIndices2, ShouldResemble, appliedRulesIndices)
+}
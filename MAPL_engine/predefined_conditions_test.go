@@ -0,0 +1,234 @@
+package MAPL_engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+const predefinedConditionsTestRules = `
+rules:
+  - ruleID: "root"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      REF: rootContainer
+    decision: alert
+
+  - ruleID: "root-small-image-pod"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      AND:
+      - attribute: "jsonpath:$.kind"
+        method: EQ
+        value: "Pod"
+      - REF: rootContainerWithSmallImage
+    decision: block
+
+  - ruleID: "not-root"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      NOT:
+        REF: rootContainer
+    decision: allow
+`
+
+const predefinedConditionsTestMissingRule = `
+rules:
+  - ruleID: "missing"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      OR:
+      - REF: rootContainer
+      - REF: privilegedContainer
+    decision: block
+`
+
+const predefinedConditionsTestCycle = `
+predefinedConditions:
+  a:
+    OR:
+    - REF: b
+    - attribute: "jsonpath:$.kind"
+      method: EQ
+      value: "Pod"
+  b:
+    NOT:
+      REF: c
+  c:
+    REF: a
+`
+
+func TestPredefinedConditions(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test rules with references to predefined conditions"
+		fmt.Println(str)
+
+		stringsAndLists, err := YamlReadStringListsFromFile("../files/lists/predefined_conditions.yaml")
+		So(err, ShouldBeNil)
+		So(stringsAndLists.PredefinedConditions, ShouldHaveLength, 3)
+
+		rules, err := YamlReadRulesFromStringWithPredefinedStrings(predefinedConditionsTestRules, stringsAndLists)
+		So(err, ShouldBeNil)
+
+		messages, err := YamlReadMessagesFromFile("../files/messages/messages_base_jsonpath.yaml")
+		So(err, ShouldBeNil)
+		data, err := ReadBinaryFile("../files/raw_json_data/count/json_raw_data_4containers.json")
+		So(err, ShouldBeNil)
+		var dataInterface interface{}
+		err = json.Unmarshal(data, &dataInterface)
+		So(err, ShouldBeNil)
+
+		messageBytes := messages.Messages[0]
+		messageBytes.RequestJsonRaw = &data
+		messageInterface := messages.Messages[0]
+		messageInterface.RequestRawInterface = &dataInterface
+
+		for _, message := range []MessageAttributes{messageBytes, messageInterface} {
+			decision, _, _, results, _, _, _ := Check(&message, &rules)
+			So(results, ShouldResemble, []int{ALERT, BLOCK, DEFAULT})
+			So(decision, ShouldEqual, BLOCK)
+		}
+
+		// every reference is resolved to a separate copy of the predefined condition:
+		ref0 := rules.Rules[0].GetPreparedRule().Conditions.ConditionsTree.(*Ref)
+		ref2 := rules.Rules[2].GetPreparedRule().Conditions.ConditionsTree.(*Not).Node.(*Ref)
+		So(ref0.Node, ShouldNotBeNil)
+		So(ref0.Node, ShouldNotPointTo, ref2.Node)
+		So(ref0.Node.String(), ShouldEqual, ref2.Node.String())
+		So(stringsAndLists.PredefinedConditions["rootContainer"].ConditionsTree.(*Any).PreparedJsonpathQuery, ShouldBeNil) // the predefined condition itself is not prepared
+
+		str = "test the trace, string and json of references to predefined conditions"
+		fmt.Println(str)
+
+		result, err := CheckWithContext(context.Background(), &messageInterface, &rules, WithTrace())
+		So(err, ShouldBeNil)
+		refTrace := result.Trace.Rules[1].Conditions.Children[1]
+		So(refTrace.Type, ShouldEqual, "REF")
+		So(refTrace.Node, ShouldEqual, "rootContainerWithSmallImage")
+		So(refTrace.Result, ShouldBeTrue)
+		So(refTrace.Children[0].Type, ShouldEqual, "AND")
+
+		So(rules.Rules[1].Conditions.ConditionsTree.String(), ShouldEqual, "(<jsonpath:$.kind-EQ-Pod> && [REF<rootContainerWithSmallImage>])")
+
+		conditionsJson, err := json.Marshal(rules.Rules[1].Conditions)
+		So(err, ShouldBeNil)
+		So(string(conditionsJson), ShouldContainSubstring, `{"REF":"rootContainerWithSmallImage"}`)
+		var conditions ConditionsTree
+		err = json.Unmarshal(conditionsJson, &conditions)
+		So(err, ShouldBeNil)
+		So(conditions.ConditionsTree.String(), ShouldEqual, rules.Rules[1].Conditions.ConditionsTree.String())
+
+		str = "test a policy set with predefined conditions"
+		fmt.Println(str)
+
+		policySet, err := CompilePolicySet(&rules, stringsAndLists)
+		So(err, ShouldBeNil)
+		decision, _, _, results, _, _, _ := policySet.Check(&messageBytes)
+		So(results, ShouldResemble, []int{ALERT, BLOCK, DEFAULT})
+		So(decision, ShouldEqual, BLOCK)
+
+		q, _, err := rules.Rules[0].GetPreparedRule().Conditions.ConditionsTree.ToMongoQuery("raw", "", 0)
+		So(err, ShouldBeNil)
+		q2, _, err := ref0.Node.ToMongoQuery("raw", "", 0)
+		So(err, ShouldBeNil)
+		So(q, ShouldResemble, q2)
+
+		str = "test the validation of rules with references to predefined conditions"
+		fmt.Println(str)
+
+		rulesWithoutLists, err := YamlReadRulesFromString(predefinedConditionsTestRules) // the rules aren't prepared with the global lists here
+		So(err, ShouldBeNil)
+		for i := range rulesWithoutLists.Rules {
+			err = ValidateRule(&rulesWithoutLists.Rules[i]) // the references are not resolved
+			So(err, ShouldBeNil)
+			err = ValidateRuleWithPredefinedStrings(&rulesWithoutLists.Rules[i], stringsAndLists)
+			So(err, ShouldBeNil)
+			err = ValidateRuleWithPredefinedStrings(&rulesWithoutLists.Rules[i], PredefinedStringsAndLists{})
+			So(err, ShouldNotBeNil)
+		}
+		So(RuleMD5HashConditions(rulesWithoutLists.Rules[1]), ShouldEqual, RuleMD5HashConditions(rules.Rules[1])) // the references are hashed by name
+
+		str = "test missing predefined conditions"
+		fmt.Println(str)
+
+		_, err = YamlReadRulesFromStringWithPredefinedStrings(predefinedConditionsTestMissingRule, stringsAndLists)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "missing predefined condition [privilegedContainer]")
+
+		_, err = YamlReadRulesFromStringWithPredefinedStrings(predefinedConditionsTestRules, PredefinedStringsAndLists{})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "missing predefined condition [rootContainer]")
+
+		_, err = YamlReadStringListsFromString("predefinedConditions:\n  a:\n    REF: b\n")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "missing predefined condition [b]")
+
+		str = "test cycles in predefined conditions"
+		fmt.Println(str)
+
+		_, err = YamlReadStringListsFromString(predefinedConditionsTestCycle)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "cycle in predefined conditions")
+
+		var cycleStringsAndLists PredefinedStringsAndLists
+		err = json.Unmarshal([]byte(`{"predefinedConditions":{"a":{"REF":"a"}}}`), &cycleStringsAndLists)
+		So(err, ShouldBeNil)
+		ref := Ref{Name: "a"}
+		err = ref.PrepareAndValidate(cycleStringsAndLists)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "cycle in predefined conditions [a -> a]")
+
+		unresolved := Ref{Name: "a"}
+		flag, _ := unresolved.Eval(&messageBytes)
+		So(flag, ShouldBeFalse)
+	})
+}
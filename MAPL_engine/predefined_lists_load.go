@@ -64,5 +64,13 @@ func validatePredefinedString(predefinedStringsAndLists PredefinedStringsAndList
 		predefinedStringsAndLists.PredefinedListsWithoutRefs[key] = tempStringArray
 
 	}
+
+	for name := range predefinedStringsAndLists.PredefinedConditions { // test that the predefined conditions are valid (without missing references or cycles)
+		ref := Ref{Name: name}
+		err := ref.PrepareAndValidate(predefinedStringsAndLists)
+		if err != nil {
+			return PredefinedStringsAndLists{}, err
+		}
+	}
 	return predefinedStringsAndLists, nil
 }
@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
 var GlobalPredefinedStringsAndLists PredefinedStringsAndLists
@@ -33,6 +34,14 @@ func YamlReadRulesFromString(yamlString string) (Rules, error) {
 		log.Printf("error: %v", err)
 		return Rules{}, err
 	}
+	err = validateCombiningAlgorithm(rules.CombiningAlgorithm)
+	if err != nil {
+		return Rules{}, err
+	}
+	err = validateDecisions(&rules)
+	if err != nil {
+		return Rules{}, err
+	}
 
 	//err = PrepareRules(&rules)
 	//err = PrepareRulesWithPredefinedStrings(&rules, PredefinedStringsAndLists{})
@@ -63,7 +72,9 @@ func YamlReadRulesFromFile(filename string) (Rules, error) {
 
 func (rule *Rule) SetPredefinedStringsAndLists(stringsAndlists PredefinedStringsAndLists) error {
 
+	atomic.AddUint64(&rulesGeneration, 1) // the cached PolicySets are compiled again
 	rule.ruleAlreadyPrepared = false
+	rule.preparationErr = nil
 
 	var ruleCopy Rule
 	err := deepcopy.Copy(&ruleCopy, rule)
@@ -103,6 +114,14 @@ func YamlReadRulesFromStringWithPredefinedStrings(yamlString string, stringsAndl
 		log.Printf("error: %v", err)
 		return Rules{}, err
 	}
+	err = validateCombiningAlgorithm(rules.CombiningAlgorithm)
+	if err != nil {
+		return Rules{}, err
+	}
+	err = validateDecisions(&rules)
+	if err != nil {
+		return Rules{}, err
+	}
 
 	for i_r, _ := range rules.Rules {
 		err = rules.Rules[i_r].SetPredefinedStringsAndLists(stringsAndlists)
@@ -344,6 +363,44 @@ func ConvertConditionStringToIntFloatRegex(condition *Condition) error { // TO-D
 		condition.Value = tempString
 		condition.Value = tempString
 	}
+	if regexMethod, ok := stringMethods[strings.ToUpper(condition.Method)]; ok { // PREFIX, SUFFIX, CONTAINS, EQ_CI, IN_CI and their negations
+		condition.Value = convertStringMethodToRegex(condition.Method, condition.Value)
+		condition.Method = regexMethod
+	}
+	if isSemverMethod(condition.Method) {
+		valueRange, err := newSemverRange(condition.Method, condition.Value)
+		if err != nil {
+			return err
+		}
+		condition.ValueSemverRange = valueRange
+	}
+	if strings.ToUpper(condition.Method) == "IN_CIDR" || strings.ToUpper(condition.Method) == "NIN_CIDR" {
+		cidrs, err := parseCIDRList(condition.Value)
+		if err != nil {
+			return err
+		}
+		condition.ValueCIDRs = cidrs
+	}
+	switch strings.ToUpper(condition.Method) {
+	case "BEFORE", "AFTER":
+		t, err := parseTimestamp(condition.Value)
+		if err != nil {
+			return err
+		}
+		condition.ValueTime = &t
+	case "OLDER_THAN", "NEWER_THAN":
+		d, err := parseAgeDuration(condition.Value)
+		if err != nil {
+			return err
+		}
+		condition.ValueDuration = &d
+	case "IS_TYPE":
+		types, err := parseJsonTypes(condition.Value)
+		if err != nil {
+			return err
+		}
+		condition.ValueTypes = types
+	}
 
 	tempString, factor := convertStringWithUnits(condition.Value)
 	valFloat, err := strconv.ParseFloat(tempString, 64)
@@ -377,6 +434,7 @@ func ConvertConditionStringToIntFloatRegex(condition *Condition) error { // TO-D
 	handleSenderReceiverLabelsAttribute(condition)
 	handleSenderReceiverAttributes(condition)
 	handleJsonpathAttribute(condition)
+	handleJsonpathValue(condition)
 
 	if condition.AttributeIsJsonpath || condition.AttributeIsJsonpathRelative {
 		return nil
@@ -388,6 +446,47 @@ func ConvertConditionStringToIntFloatRegex(condition *Condition) error { // TO-D
 	return nil
 }
 
+// stringMethods are converted to regular expressions when the condition is prepared (as IN and NIN are). the map gives the method of the regular expression
+var stringMethods = map[string]string{
+	"PREFIX":    "RE",
+	"NPREFIX":   "NRE",
+	"SUFFIX":    "RE",
+	"NSUFFIX":   "NRE",
+	"CONTAINS":  "RE",
+	"NCONTAINS": "NRE",
+	"EQ_CI":     "RE",
+	"NEQ_CI":    "NRE",
+	"IN_CI":     "RE",
+	"NIN_CI":    "NRE",
+	"GLOB":      "RE",
+	"NGLOB":     "NRE",
+}
+
+// convertStringMethodToRegex returns the regular expression of a string method (the value is taken literally, except for the wildcards of GLOB)
+func convertStringMethodToRegex(method, value string) string {
+	switch strings.ToUpper(method) {
+	case "PREFIX", "NPREFIX":
+		return "^" + regexp.QuoteMeta(value)
+	case "SUFFIX", "NSUFFIX":
+		return regexp.QuoteMeta(value) + "$"
+	case "EQ_CI", "NEQ_CI":
+		return "(?i)^" + regexp.QuoteMeta(value) + "$"
+	case "IN_CI", "NIN_CI":
+		list := strings.Replace(value, "[", "", -1)
+		list = strings.Replace(list, "]", "", -1)
+		items := strings.Split(list, ",")
+		for i, item := range items {
+			items[i] = regexp.QuoteMeta(strings.TrimSpace(item)) // remove leading and trailing spaces
+		}
+		return "(?i)^(?:" + strings.Join(items, "|") + ")$"
+	case "GLOB", "NGLOB":
+		regex, _ := convertGlobToRegex(value) // the pattern is validated before the condition is prepared
+		return regex
+	default: // CONTAINS, NCONTAINS
+		return regexp.QuoteMeta(value)
+	}
+}
+
 func handleSenderReceiverLabelsAttribute(condition *Condition) {
 	//originalAttribute := condition.Attribute
 	//originalValue := condition.Value
@@ -453,36 +552,48 @@ func handleJsonpathAttribute(condition *Condition) {
 	//originalAttribute := condition.Attribute
 	if strings.HasPrefix(condition.Attribute, "jsonpath:") { // test if ATTRIBUTE is of type jsonpath
 		condition.AttributeIsJsonpath = true
-		i1 := strings.Index(condition.Attribute, ":") + 1
-		i2 := len(condition.Attribute)
-		netConditionAttribute := condition.Attribute[i1:i2]
-
-		condition.AttributeIsJsonpathRelative = false
-		relativeKeywords := []string{"$RELATIVE.", "$KEY", "$VALUE"}
-		if SliceHasPrefix(relativeKeywords, netConditionAttribute) {
-			condition.AttributeIsJsonpathRelative = true
-			netConditionAttribute = strings.Replace(netConditionAttribute, "$RELATIVE.", "$.", 1)
-			//netConditionAttribute = strings.Replace(netConditionAttribute, "$VALUE.", "$.", 1)
-		} else {
-			if netConditionAttribute == "$RELATIVE" {
-				condition.AttributeIsJsonpathRelative = true
-				netConditionAttribute = "$"
-			}
-		}
+		condition.AttributeJsonpathQuery, condition.AttributeIsJsonpathRelative = convertJsonpathToQuery(condition.Attribute)
+		condition.Attribute = "jsonpath"
+		//condition.OriginalAttribute = originalAttribute // used in hash
+	}
+}
 
-		if netConditionAttribute[0] == '.' {
-			netConditionAttribute = "$" + netConditionAttribute
-		}
+func handleJsonpathValue(condition *Condition) {
+	if condition.AttributeIsJsonpath && strings.HasPrefix(condition.Value, "jsonpath:") { // test if VALUE is a reference to another field (used to compare two fields of the data)
+		condition.ValueIsJsonpath = true
+		condition.ValueJsonpathQuery, condition.ValueIsJsonpathRelative = convertJsonpathToQuery(condition.Value)
+	}
+}
 
-		netConditionAttribute = RemoveDotQuotes(netConditionAttribute)
+// convertJsonpathToQuery converts a "jsonpath:" attribute (or value) to a jsonpath query and tells if it is relative to the array element of an ANY/ALL node
+func convertJsonpathToQuery(jsonpathString string) (string, bool) {
 
-		//netConditionAttribute = strings.Replace(netConditionAttribute, "\"", "'", -1)
-		netConditionAttribute = strings.Replace(netConditionAttribute, "'", "\"", -1)
-		netConditionAttribute = strings.Replace(netConditionAttribute, ".[", "[", -1)
-		condition.AttributeJsonpathQuery = netConditionAttribute
-		condition.Attribute = "jsonpath"
-		//condition.OriginalAttribute = originalAttribute // used in hash
+	i1 := strings.Index(jsonpathString, ":") + 1
+	netConditionAttribute := jsonpathString[i1:]
+
+	relative := false
+	relativeKeywords := []string{"$RELATIVE.", "$KEY", "$VALUE"}
+	if SliceHasPrefix(relativeKeywords, netConditionAttribute) {
+		relative = true
+		netConditionAttribute = strings.Replace(netConditionAttribute, "$RELATIVE.", "$.", 1)
+		//netConditionAttribute = strings.Replace(netConditionAttribute, "$VALUE.", "$.", 1)
+	} else {
+		if netConditionAttribute == "$RELATIVE" {
+			relative = true
+			netConditionAttribute = "$"
+		}
+	}
+
+	if netConditionAttribute[0] == '.' {
+		netConditionAttribute = "$" + netConditionAttribute
 	}
+
+	netConditionAttribute = RemoveDotQuotes(netConditionAttribute)
+
+	//netConditionAttribute = strings.Replace(netConditionAttribute, "\"", "'", -1)
+	netConditionAttribute = strings.Replace(netConditionAttribute, "'", "\"", -1)
+	netConditionAttribute = strings.Replace(netConditionAttribute, ".[", "[", -1)
+	return netConditionAttribute, relative
 }
 
 /*
@@ -508,9 +619,10 @@ func (rule Rule) String() string {
 	return RuleToString(rule)
 }
 
+// RuleConditionsToString gives the string of the normalized conditions tree of the rule (see Normalize)
 func RuleConditionsToString(rule Rule) string {
 	if rule.Conditions.ConditionsTree != nil {
-		conditionsString := rule.Conditions.ConditionsTree.String()
+		conditionsString := Normalize(rule.Conditions.ConditionsTree).String()
 		return conditionsString
 	} else {
 		return "no conditions"
@@ -526,6 +638,8 @@ func RuleMD5Hash(rule Rule) (md5hash string) {
 	return md5hash
 }
 
+// RuleMD5HashConditions hashes the normalized conditions of the rule as they are written: a reference to a predefined condition (REF) is hashed by its name,
+// so changing the predefined condition doesn't change the hash of the rules that reference it
 func RuleMD5HashConditions(rule Rule) (md5hash string) {
 
 	totalDNFstring := RuleConditionsToString(rule)
@@ -535,6 +649,7 @@ func RuleMD5HashConditions(rule Rule) (md5hash string) {
 	return md5hash
 }
 
+// ConditionsEqual tests if the normalized conditions of the rules are the same
 func (r Rule) ConditionsEqual(rule Rule) bool {
 	return RuleMD5HashConditions(r) == RuleMD5HashConditions(rule)
 }
@@ -548,23 +663,44 @@ func (rule *Rule) ToLower() {
 	rule.Decision = strings.ToLower(rule.Decision)
 }
 
+// ValidateRule tests the validity of the rule (the rule itself is not changed).
+// The references to predefined conditions (REF) are not resolved (see ValidateRuleWithPredefinedStrings).
 func ValidateRule(rule *Rule) error {
+	_, err := ValidateRuleWithWarnings(rule)
+	return err
+}
+
+// ValidateRuleWithWarnings tests the validity of the rule as ValidateRule does.
+// A valid rule may still get warnings about subtrees of its conditions that can never be satisfied or that are always satisfied (see AnalyzeConditions).
+func ValidateRuleWithWarnings(rule *Rule) ([]ValidationWarning, error) {
+	return validateRule(rule, PredefinedStringsAndLists{allowUnresolvedConditions: true})
+}
+
+// ValidateRuleWithPredefinedStrings tests the validity of the rule with the predefined strings, lists and conditions (every REF must be resolved)
+func ValidateRuleWithPredefinedStrings(rule *Rule, stringsAndlists PredefinedStringsAndLists) error {
+	_, err := validateRule(rule, stringsAndlists)
+	return err
+}
+
+func validateRule(rule *Rule, stringsAndlists PredefinedStringsAndLists) ([]ValidationWarning, error) {
 
 	rule2 := Rule{}
 	err := deepcopy.Copy(&rule2, rule)
 	if err != nil {
-		return fmt.Errorf("can't test validity of rule conditions")
+		return nil, fmt.Errorf("can't test validity of rule conditions")
 	}
 	err = ConvertFieldsToRegex(&rule2)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	warnings := []ValidationWarning{}
 	if rule2.Conditions.ConditionsTree != nil {
-		err = rule2.Conditions.ConditionsTree.PrepareAndValidate(PredefinedStringsAndLists{})
+		err = rule2.Conditions.ConditionsTree.PrepareAndValidate(stringsAndlists)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		warnings = AnalyzeConditions(rule2.Conditions.ConditionsTree)
 	}
-	return nil
+	return warnings, nil
 }
@@ -0,0 +1,225 @@
+package MAPL_engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//--------------------------------------
+// Semantic Versions
+//--------------------------------------
+
+// semverMethods are the methods that compare semantic versions. the map gives the operator of the comparison
+var semverMethods = map[string]string{
+	"SEMVER_LT":       "<",
+	"SEMVER_LE":       "<=",
+	"SEMVER_GT":       ">",
+	"SEMVER_GE":       ">=",
+	"SEMVER_EQ":       "=",
+	"SEMVER_IN_RANGE": "",
+}
+
+type semanticVersion struct {
+	major      uint64
+	minor      uint64
+	patch      uint64
+	preRelease []string
+}
+
+type semverConstraint struct {
+	operator string
+	version  semanticVersion
+}
+
+// semverRange is an OR of ANDs of constraints (">=1.2.0 <2.0.0 || >=3.0.0")
+type semverRange [][]semverConstraint
+
+func isSemverMethod(method string) bool {
+	_, ok := semverMethods[strings.ToUpper(method)]
+	return ok
+}
+
+// parseSemanticVersion parses versions such as "1.25.4", "v1.25.4-eks-1" and "2.3.0-rc.1+build.5".
+// a leading "v" is removed, missing minor and patch numbers are zero ("1.25" is "1.25.0") and the build metadata is ignored.
+func parseSemanticVersion(str string) (semanticVersion, error) {
+
+	v := semanticVersion{}
+	str = strings.TrimSpace(str)
+	str = strings.TrimPrefix(strings.TrimPrefix(str, "v"), "V")
+	if i := strings.Index(str, "+"); i >= 0 {
+		str = str[:i]
+	}
+	if i := strings.Index(str, "-"); i >= 0 {
+		v.preRelease = strings.Split(str[i+1:], ".")
+		for _, identifier := range v.preRelease {
+			if len(identifier) == 0 || strings.IndexFunc(identifier, func(r rune) bool { return !isSemverIdentifierRune(r) }) >= 0 {
+				return semanticVersion{}, fmt.Errorf("invalid pre-release in version [%v]", str)
+			}
+		}
+		str = str[:i]
+	}
+
+	parts := strings.Split(str, ".")
+	if len(parts) > 3 {
+		return semanticVersion{}, fmt.Errorf("invalid version [%v]", str)
+	}
+	numbers := []*uint64{&v.major, &v.minor, &v.patch}
+	for i, part := range parts {
+		if len(part) == 0 || strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' }) >= 0 {
+			return semanticVersion{}, fmt.Errorf("invalid version [%v]", str)
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return semanticVersion{}, fmt.Errorf("invalid version [%v]", str)
+		}
+		*numbers[i] = n
+	}
+	return v, nil
+}
+
+func isSemverIdentifierRune(r rune) bool {
+	return (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '-'
+}
+
+// compareSemanticVersions returns -1, 0 or 1 by the precedence of semantic versions (a pre-release version is lower than the release)
+func compareSemanticVersions(v1, v2 semanticVersion) int {
+	for _, pair := range [][2]uint64{{v1.major, v2.major}, {v1.minor, v2.minor}, {v1.patch, v2.patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	if len(v1.preRelease) == 0 || len(v2.preRelease) == 0 {
+		return compareInts(len(v2.preRelease), len(v1.preRelease)) // 1.0.0-rc.1 < 1.0.0
+	}
+	for i := 0; i < len(v1.preRelease) && i < len(v2.preRelease); i++ {
+		identifier1, identifier2 := v1.preRelease[i], v2.preRelease[i]
+		if identifier1 == identifier2 {
+			continue
+		}
+		n1, err1 := strconv.ParseUint(identifier1, 10, 64)
+		n2, err2 := strconv.ParseUint(identifier2, 10, 64)
+		switch {
+		case err1 == nil && err2 == nil:
+			if n1 < n2 {
+				return -1
+			}
+			return 1
+		case err1 == nil: // numeric identifiers are lower than alphanumeric ones
+			return -1
+		case err2 == nil:
+			return 1
+		case identifier1 < identifier2:
+			return -1
+		default:
+			return 1
+		}
+	}
+	return compareInts(len(v1.preRelease), len(v2.preRelease))
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// newSemverRange returns the range of versions that satisfy a semver method with the value.
+// the value of SEMVER_IN_RANGE is a list of constraints: ">=1.2.0 <2.0.0" (AND) and "<1.0.0 || >=2.0.0" (OR).
+func newSemverRange(method, value string) (semverRange, error) {
+
+	operator, ok := semverMethods[strings.ToUpper(method)]
+	if !ok {
+		return nil, fmt.Errorf("not a semver method [%v]", method)
+	}
+	if len(operator) > 0 {
+		version, err := parseSemanticVersion(value)
+		if err != nil {
+			return nil, err
+		}
+		return semverRange{{{operator: operator, version: version}}}, nil
+	}
+
+	r := semverRange{}
+	for _, constraintsString := range strings.Split(value, "||") {
+		constraints := []semverConstraint{}
+		fields := strings.Fields(constraintsString)
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			if strings.Trim(field, "<>=") == "" && i+1 < len(fields) { // ">= 1.2.0"
+				i++
+				field += fields[i]
+			}
+			constraint := semverConstraint{operator: "="}
+			for _, op := range []string{"<=", ">=", "<", ">", "="} {
+				if strings.HasPrefix(field, op) {
+					constraint.operator = op
+					field = field[len(op):]
+					break
+				}
+			}
+			version, err := parseSemanticVersion(field)
+			if err != nil {
+				return nil, err
+			}
+			constraint.version = version
+			constraints = append(constraints, constraint)
+		}
+		if len(constraints) == 0 {
+			return nil, fmt.Errorf("empty semver range [%v]", value)
+		}
+		r = append(r, constraints)
+	}
+	return r, nil
+}
+
+func (r semverRange) contains(v semanticVersion) bool {
+	for _, constraints := range r {
+		satisfied := true
+		for _, constraint := range constraints {
+			if !constraint.satisfiedBy(v) {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			return true
+		}
+	}
+	return false
+}
+
+func (constraint semverConstraint) satisfiedBy(v semanticVersion) bool {
+	comparison := compareSemanticVersions(v, constraint.version)
+	switch constraint.operator {
+	case "<":
+		return comparison < 0
+	case "<=":
+		return comparison <= 0
+	case ">":
+		return comparison > 0
+	case ">=":
+		return comparison >= 0
+	default:
+		return comparison == 0
+	}
+}
+
+// compareSemverFunc returns false if the value is not a semantic version
+func compareSemverFunc(value1 string, value2 semverRange) bool { //value2 is the reference range from the rule
+	if value2 == nil {
+		return false
+	}
+	v, err := parseSemanticVersion(value1)
+	if err != nil {
+		return false
+	}
+	return value2.contains(v)
+}
@@ -0,0 +1,102 @@
+package MAPL_engine
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+var semverTestCases = []conditionMethodTestCase{
+	{"jsonpath:$.status.nodeInfo.kubeletVersion", "SEMVER_LT", "1.25.4", true},
+	{"jsonpath:$.status.nodeInfo.kubeletVersion", "SEMVER_LT", "1.9.0", false}, // not as floats (1.10 < 1.9)
+	{"jsonpath:$.status.nodeInfo.kubeletVersion", "SEMVER_GT", "v1.9", true},
+	{"jsonpath:$.status.nodeInfo.kubeletVersion", "SEMVER_EQ", "1.10.2", false}, // the pre-release is lower than the release
+	{"jsonpath:$.status.nodeInfo.kubeletVersion", "SEMVER_LT", "1.10.2", true},
+	{"jsonpath:$.status.nodeInfo.kubeletVersion", "SEMVER_GE", "1.10.2-eks-1", true},
+	{"jsonpath:$.status.nodeInfo.kubeletVersion", "SEMVER_IN_RANGE", ">=1.10.0 <1.11.0", true},
+	{"jsonpath:$.status.nodeInfo.kubeletVersion", "SEMVER_IN_RANGE", "< 1.10.0 || >= 1.11.0", false},
+	{"jsonpath:$.metadata.labels.version", "SEMVER_GE", "2.3.0", true},
+	{"jsonpath:$.metadata.labels.version", "SEMVER_EQ", "2.3.1", true}, // the build metadata is ignored
+	{"jsonpath:$.metadata.labels.version", "semver_le", "2.3", false},
+	{"jsonpath:$.metadata.name", "SEMVER_GE", "0.0.0", false}, // not a semantic version
+	{"jsonpath:$.missing", "SEMVER_GE", "0.0.0", false},
+	{"senderLabel[version]", "SEMVER_IN_RANGE", "1.0.0-beta.2", false},
+	{"senderLabel[version]", "SEMVER_GT", "1.0.0-beta.2", true},
+	{"receiverLabel[version]", "SEMVER_LT", "1.0.0-alpha.beta", true},
+	{"requestUseragent", "SEMVER_GE", "7.0", true},
+	{"$sender.namespace", "SEMVER_GE", "0.0.0", false},
+}
+
+func TestSemverMethods(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test the precedence of semantic versions"
+		fmt.Println(str)
+
+		versions := []string{"0.9.9", "1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.2.0", "1.10.0", "v2.0.0"}
+		for i := range versions {
+			for j := range versions {
+				v1, err := parseSemanticVersion(versions[i])
+				So(err, ShouldBeNil)
+				v2, err := parseSemanticVersion(versions[j])
+				So(err, ShouldBeNil)
+				So(compareSemanticVersions(v1, v2), ShouldEqual, compareInts(i, j))
+			}
+		}
+
+		str = "test the semver methods"
+		fmt.Println(str)
+
+		messages := methodTestMessages(MessageAttributes{
+			SourceLabels:      map[string]string{"version": "1.0.0-rc.1"},
+			DestinationLabels: map[string]string{"version": "1.0.0-alpha.1"},
+			SourceNamespace:   "default",
+			RequestUseragent:  "7.81.0",
+		}, `{"metadata":{"name":"node-1","labels":{"version":"v2.3.1+build.7"}},"status":{"nodeInfo":{"kubeletVersion":"v1.10.2-eks-1"}}}`)
+		testConditionMethods(semverTestCases, PredefinedStringsAndLists{}, messages)
+
+		str = "test the validation of the semver methods"
+		fmt.Println(str)
+
+		for _, invalid := range []Condition{
+			{Attribute: "jsonpath:$.version", Method: "SEMVER_LT", Value: ""},
+			{Attribute: "jsonpath:$.version", Method: "SEMVER_LT", Value: "1.2.3.4"},
+			{Attribute: "jsonpath:$.version", Method: "SEMVER_GE", Value: "latest"},
+			{Attribute: "jsonpath:$.version", Method: "SEMVER_EQ", Value: "1.0.0-"},
+			{Attribute: "jsonpath:$.version", Method: "SEMVER_IN_RANGE", Value: ">=1.0.0 || "},
+			{Attribute: "jsonpath:$.version", Method: "SEMVER_IN_RANGE", Value: "~1.2.0"},
+			{Attribute: "payloadSize", Method: "SEMVER_GT", Value: "1.0.0"},
+			{Attribute: "senderLabel[version]", Method: "SEMVER_EQ", Value: "receiverLabel[version]"},
+		} {
+			_, err := ValidateOneCondition(&invalid)
+			So(err, ShouldNotBeNil)
+		}
+
+		str = "test contradictions of semver conditions"
+		fmt.Println(str)
+
+		c := normalizeTestConditionsTree(`
+AND:
+- attribute: "jsonpath:$.version"
+  method: IN
+  value: "[1.2.0,1.3.0]"
+- attribute: "jsonpath:$.version"
+  method: SEMVER_GE
+  value: "2.0.0"`)
+		warnings, err := ValidateRuleWithWarnings(&Rule{Conditions: c})
+		So(err, ShouldBeNil)
+		So(warnings, ShouldHaveLength, 1)
+
+		p := Condition{Attribute: "jsonpath:$.version", Method: "SEMVER_GE", Value: "2.0.0"}
+		err = p.PrepareAndValidate(PredefinedStringsAndLists{})
+		So(err, ShouldBeNil)
+		_, _, err = p.ToMongoQuery("raw", "", 0)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,348 @@
+package MAPL_engine
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//--------------------------------------
+// Shadowing and Redundancy of Rules
+//--------------------------------------
+
+// the kinds of ShadowedRule
+const (
+	Shadowed  = "shadowed"  // the rule is covered by a rule with a different decision that overrides its decision
+	Redundant = "redundant" // the rule is covered by a rule with the same decision
+)
+
+// ShadowedRule reports a rule that never changes the decision of the rule set: every message that the rule applies to is also matched by the covering rule
+type ShadowedRule struct {
+	RuleIndex         int    `json:"ruleIndex"`
+	RuleID            string `json:"ruleID"`
+	Kind              string `json:"kind"` // Shadowed or Redundant
+	CoveringRuleIndex int    `json:"coveringRuleIndex"`
+	CoveringRuleID    string `json:"coveringRuleID"`
+}
+
+func (s ShadowedRule) String() string {
+	return fmt.Sprintf("rule %v [%v] is %v by rule %v [%v]", s.RuleIndex, s.RuleID, s.Kind, s.CoveringRuleIndex, s.CoveringRuleID)
+}
+
+// FindShadowedRules compiles the rule set with the predefined strings and lists and returns its shadowed and redundant rules (see PolicySet.FindShadowedRules)
+func FindShadowedRules(rules *Rules, stringsAndlists PredefinedStringsAndLists) ([]ShadowedRule, error) {
+	p, err := CompilePolicySet(rules, stringsAndlists)
+	if err != nil {
+		return nil, err
+	}
+	return p.FindShadowedRules(), nil
+}
+
+// FindShadowedRules returns the rules that are covered by another rule: the sender, receiver, operation, protocol and resource of the covering rule
+// include those of the rule (with wildcards, lists and CIDR containment of subnets) and the conditions of the rule imply the conditions of the covering rule.
+// A covered rule is redundant if the covering rule has the same decision and shadowed if the decision of the covering rule always overrides its decision
+// (by the combining algorithm of the rule set). Of two equivalent rules with the same decision only the later one is reported.
+// The analysis is conservative: a rule that is not reported may still be covered (for example by a combination of rules).
+func (p *PolicySet) FindShadowedRules() []ShadowedRule {
+
+	combiningAlgorithm := p.newCheckOptions(nil).getCombiningAlgorithm(p.rules)
+	N := len(p.rules.Rules)
+	shadowedRules := []ShadowedRule{}
+	for i := 0; i < N; i++ {
+		rule := p.rules.Rules[i].preparedRule
+		if rule == nil || p.ruleDecisions[i] == -1 {
+			continue
+		}
+		for j := 0; j < N; j++ {
+			coveringRule := p.rules.Rules[j].preparedRule
+			if j == i || coveringRule == nil || p.ruleDecisions[j] == -1 || !ruleCovers(coveringRule, rule) {
+				continue
+			}
+			kind := ""
+			if p.ruleDecisions[j] == p.ruleDecisions[i] {
+				if j < i || !ruleCovers(rule, coveringRule) { // report only the later one of two equivalent rules
+					kind = Redundant
+				}
+			} else if decisionWins(j, i, p, combiningAlgorithm) {
+				kind = Shadowed
+			}
+			if kind != "" {
+				shadowedRules = append(shadowedRules, ShadowedRule{
+					RuleIndex:         i,
+					RuleID:            p.rules.Rules[i].RuleID,
+					Kind:              kind,
+					CoveringRuleIndex: j,
+					CoveringRuleID:    p.rules.Rules[j].RuleID,
+				})
+				break
+			}
+		}
+	}
+	return shadowedRules
+}
+
+// decisionWins tests if the decision of rule i is chosen over the decision of rule j when both rules apply to a message
+func decisionWins(i, j int, p *PolicySet, combiningAlgorithm CombiningAlgorithm) bool {
+	if i > j {
+		return overrides(i, j, p.ruleDecisions, p, combiningAlgorithm)
+	}
+	return !overrides(j, i, p.ruleDecisions, p, combiningAlgorithm)
+}
+
+// ruleCovers tests if rule a applies to every message that (the prepared) rule b applies to
+func ruleCovers(a, b *Rule) bool {
+	return senderReceiverListCovers(a.Sender.SenderList, b.Sender.SenderList) &&
+		senderReceiverListCovers(a.Receiver.ReceiverList, b.Receiver.ReceiverList) &&
+		globListCovers(operationPatterns(a.Operation), operationPatterns(b.Operation)) &&
+		protocolAndResourceCovers(a, b) &&
+		conditionsImply(b.Conditions.ConditionsTree, a.Conditions.ConditionsTree)
+}
+
+func senderReceiverListCovers(a, b []ExpandedSenderReceiver) bool {
+	for _, eb := range b {
+		covered := false
+		for _, ea := range a {
+			if senderReceiverCovers(ea, eb) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func senderReceiverCovers(a, b ExpandedSenderReceiver) bool {
+	switch a.Type {
+	case "subnet":
+		if b.Type != "subnet" {
+			return false
+		}
+		if a.IsIP {
+			return b.IsIP && a.Name == b.Name
+		}
+		if !a.IsCIDR {
+			return false
+		}
+		if b.IsIP {
+			return a.CIDR.Contains(b.IP)
+		}
+		if !b.IsCIDR {
+			return false
+		}
+		return cidrContains(a.CIDR, b.CIDR)
+	case "*", "workload":
+		if removeSpaces(a.Name) == "*" {
+			return true // matches any value (even an empty one)
+		}
+		return (b.Type == "*" || b.Type == "workload") && globCovers(removeSpaces(a.Name), removeSpaces(b.Name))
+	case "hostname":
+		return b.Type == "hostname" && globCovers(removeSpaces(a.Name), removeSpaces(b.Name))
+	default:
+		return false
+	}
+}
+
+// globCovers tests if every string that matches the pattern b (with * and ? wildcards) also matches the pattern a
+func globCovers(a, b string) bool {
+	if a == b || a == "*" {
+		return true
+	}
+	if strings.Contains(a, "?") && strings.ContainsAny(b, "*?") { // the wildcards of b may be matched only by the * wildcards of a
+		return false
+	}
+	re, err := regexp.Compile(ConvertStringToRegex(a, "WithWildcards"))
+	if err != nil {
+		return false
+	}
+	return re.MatchString(b)
+}
+
+func globListCovers(a, b []string) bool {
+	for _, pb := range b {
+		covered := false
+		for _, pa := range a {
+			if globCovers(pa, pb) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// operationPatterns splits the operation of the rule to patterns (see ConvertOperationStringToRegex)
+func operationPatterns(operation string) []string {
+	switch operation {
+	case "*":
+		return []string{"*"}
+	case "write", "WRITE":
+		return []string{"POST", "PUT", "DELETE"}
+	case "read", "READ":
+		return []string{"GET", "HEAD", "OPTIONS", "TRACE", "read", "READ"}
+	default:
+		return listPatterns(operation)
+	}
+}
+
+func listPatterns(list string) []string {
+	patterns := strings.Split(list, ",")
+	for i, pattern := range patterns {
+		patterns[i] = strings.TrimSpace(pattern)
+	}
+	return patterns
+}
+
+// protocolAndResourceCovers follows the tests of the protocol and the resource in matchOneRule
+func protocolAndResourceCovers(a, b *Rule) bool {
+	switch a.Protocol {
+	case "*":
+		return true
+	case "tcp":
+		return b.Protocol == "tcp" && globListCovers(listPatterns(a.Resource.ResourceName), listPatterns(b.Resource.ResourceName))
+	default:
+		if b.Protocol == "*" || b.Protocol == "tcp" || !strings.EqualFold(a.Protocol, b.Protocol) {
+			return false
+		}
+		if a.Resource.ResourceType != "*" && a.Resource.ResourceType != b.Resource.ResourceType {
+			return false
+		}
+		return globListCovers(listPatterns(a.Resource.ResourceName), listPatterns(b.Resource.ResourceName))
+	}
+}
+
+// conditionsImply tests if the (prepared) conditions tree b implies the conditions tree a (a nil tree is always true)
+func conditionsImply(b, a Node) bool {
+
+	if a == nil {
+		return true
+	}
+	if b == nil {
+		return false
+	}
+	if a.String() == b.String() {
+		return true
+	}
+
+	switch na := a.(type) {
+	case True, *True:
+		return true
+	case *And:
+		for _, node := range na.Nodes {
+			if !conditionsImply(b, node) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch nb := b.(type) {
+	case False, *False:
+		return true
+	case *Or:
+		for _, node := range nb.Nodes {
+			if !conditionsImply(node, a) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if na, ok := a.(*Or); ok {
+		for _, node := range na.Nodes {
+			if conditionsImply(b, node) {
+				return true
+			}
+		}
+	}
+
+	switch nb := b.(type) {
+	case *And:
+		for _, node := range nb.Nodes {
+			if conditionsImply(node, a) {
+				return true
+			}
+		}
+	case *Not:
+		if na, ok := a.(*Not); ok {
+			return conditionsImply(na.Node, nb.Node)
+		}
+	case *Any:
+		if na, ok := a.(*Any); ok && na.ParentJsonpathAttribute == nb.ParentJsonpathAttribute {
+			return conditionsImply(nb.Node, na.Node)
+		}
+	case *All:
+		if na, ok := a.(*All); ok && na.ParentJsonpathAttribute == nb.ParentJsonpathAttribute {
+			return conditionsImply(nb.Node, na.Node)
+		}
+	case *Ref:
+		return nb.Node != nil && conditionsImply(nb.Node, a)
+	case *Condition:
+		if na, ok := a.(*Condition); ok {
+			return conditionImplies(nb, na)
+		}
+	}
+	if na, ok := a.(*Ref); ok {
+		return na.Node != nil && conditionsImply(b, na.Node)
+	}
+	return false
+}
+
+// conditionImplies tests if the jsonpath condition b implies the jsonpath condition a (on the same single-valued attribute)
+func conditionImplies(b, a *Condition) bool {
+
+	attributeA, okA := singleValuedJsonpathAttribute(a)
+	attributeB, okB := singleValuedJsonpathAttribute(b)
+	if !okA || !okB || attributeA != attributeB {
+		return false
+	}
+
+	methodA := strings.ToUpper(a.Method)
+	methodB := strings.ToUpper(b.Method)
+	if methodA == "EX" {
+		return methodB != "NEX" && !isTypeMethod(methodB) && !isLengthMethod(methodB) // every other method is false on a missing (or null or empty) attribute
+	}
+
+	if candidates, ok := candidateValues([]*Condition{b}); ok {
+		for _, v := range candidates {
+			_, isNumber := parseNumberWithUnits(v)
+			switch methodA {
+			case "EQ", "NEQ", "NE", "GT", "GE", "LT", "LE":
+				if methodA != "EQ" && methodA != "NEQ" && methodA != "NE" && (!isNumber || a.ValueFloat == nil) {
+					return false
+				}
+			case "RE", "NRE":
+				if isNumber || a.ValueRegex == nil { // numbers may be formatted differently in the data
+					return false
+				}
+			default:
+				return false
+			}
+			if !satisfies(v, a) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if a.ValueFloat == nil || b.ValueFloat == nil {
+		return false
+	}
+	x, y := *b.ValueFloat, *a.ValueFloat
+	switch methodB + "-" + methodA {
+	case "GT-GT", "GT-GE", "GE-GE":
+		return x >= y
+	case "GE-GT":
+		return x > y
+	case "LT-LT", "LT-LE", "LE-LE":
+		return x <= y
+	case "LE-LT":
+		return x < y
+	}
+	return false
+}
@@ -0,0 +1,271 @@
+package MAPL_engine
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+const shadowingTestRules = `
+rules:
+  - ruleID: "block-db"
+    sender:
+      senderName: "*"
+      senderType: "workload"
+    receiver:
+      receiverName: "db*"
+      receiverType: "workload"
+    protocol: "http"
+    resource:
+      resourceType: "httpPath"
+      resourceName: "/api/*"
+    operation: "*"
+    decision: block
+
+  - ruleID: "allow-db-read"
+    sender:
+      senderName: "A"
+      senderType: "workload"
+    receiver:
+      receiverName: "db1"
+      receiverType: "workload"
+    protocol: "http"
+    resource:
+      resourceType: "httpPath"
+      resourceName: "/api/v1"
+    operation: "GET"
+    decision: allow
+
+  - ruleID: "block-db-write"
+    sender:
+      senderName: "A,B"
+      senderType: "workload"
+    receiver:
+      receiverName: "db2"
+      receiverType: "workload"
+    protocol: "http"
+    resource:
+      resourceType: "httpPath"
+      resourceName: "/api/users,/api/groups"
+    operation: "write"
+    decision: block
+
+  - ruleID: "alert-internal"
+    sender:
+      senderName: "10.0.0.0/8"
+      senderType: "subnet"
+    receiver:
+      receiverName: "*"
+      receiverType: "*"
+    protocol: "tcp"
+    resource:
+      resourceType: "port"
+      resourceName: "*"
+    operation: "*"
+    decision: alert
+
+  - ruleID: "alert-subnet"
+    sender:
+      senderName: "10.1.2.0/24"
+      senderType: "subnet"
+    receiver:
+      receiverName: "web"
+      receiverType: "workload"
+    protocol: "tcp"
+    resource:
+      resourceType: "port"
+      resourceName: "80"
+    operation: "*"
+    decision: alert
+
+  - ruleID: "allow-ip"
+    sender:
+      senderName: "10.1.2.3"
+      senderType: "subnet"
+    receiver:
+      receiverName: "web"
+      receiverType: "workload"
+    protocol: "tcp"
+    resource:
+      resourceType: "port"
+      resourceName: "443,8443"
+    operation: "*"
+    decision: allow
+
+  - ruleID: "allow-other-subnet"
+    sender:
+      senderName: "192.168.0.0/16"
+      senderType: "subnet"
+    receiver:
+      receiverName: "web"
+      receiverType: "workload"
+    protocol: "tcp"
+    resource:
+      resourceType: "port"
+      resourceName: "443"
+    operation: "*"
+    decision: allow
+
+  - ruleID: "big-pod"
+    sender:
+      senderName: "*"
+      senderType: "workload"
+    receiver:
+      receiverName: "api"
+      receiverType: "workload"
+    protocol: "http"
+    resource:
+      resourceType: "httpPath"
+      resourceName: "/pods"
+    operation: "POST"
+    conditions:
+      AND:
+      - attribute: "jsonpath:$.spec.replicas"
+        method: GT
+        value: 5
+      - attribute: "jsonpath:$.kind"
+        method: EQ
+        value: "Pod"
+    decision: alert
+
+  - ruleID: "replicas"
+    sender:
+      senderName: "*"
+      senderType: "workload"
+    receiver:
+      receiverName: "api"
+      receiverType: "workload"
+    protocol: "http"
+    resource:
+      resourceType: "httpPath"
+      resourceName: "/pods"
+    operation: "POST"
+    conditions:
+      attribute: "jsonpath:$.spec.replicas"
+      method: GE
+      value: 3
+    decision: alert
+
+  - ruleID: "replicas-copy"
+    sender:
+      senderName: "*"
+      senderType: "workload"
+    receiver:
+      receiverName: "api"
+      receiverType: "workload"
+    protocol: "http"
+    resource:
+      resourceType: "httpPath"
+      resourceName: "/pods"
+    operation: "POST"
+    conditions:
+      attribute: "jsonpath:$.spec.replicas"
+      method: GE
+      value: 3
+    decision: alert
+
+  - ruleID: "admin"
+    sender:
+      senderName: "*"
+      senderType: "workload"
+    receiver:
+      receiverName: "db1"
+      receiverType: "workload"
+    protocol: "http"
+    resource:
+      resourceType: "httpPath"
+      resourceName: "/admin"
+    operation: "*"
+    decision: block
+`
+
+func TestShadowedRules(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test the shadowed and redundant rules of a rule set"
+		fmt.Println(str)
+
+		rules, err := YamlReadRulesFromString(shadowingTestRules)
+		So(err, ShouldBeNil)
+		shadowedRules, err := FindShadowedRules(&rules, PredefinedStringsAndLists{})
+		So(err, ShouldBeNil)
+		So(shadowedRules, ShouldResemble, []ShadowedRule{
+			{RuleIndex: 1, RuleID: "allow-db-read", Kind: Shadowed, CoveringRuleIndex: 0, CoveringRuleID: "block-db"},
+			{RuleIndex: 2, RuleID: "block-db-write", Kind: Redundant, CoveringRuleIndex: 0, CoveringRuleID: "block-db"},
+			{RuleIndex: 4, RuleID: "alert-subnet", Kind: Redundant, CoveringRuleIndex: 3, CoveringRuleID: "alert-internal"},
+			{RuleIndex: 5, RuleID: "allow-ip", Kind: Shadowed, CoveringRuleIndex: 3, CoveringRuleID: "alert-internal"},
+			{RuleIndex: 7, RuleID: "big-pod", Kind: Redundant, CoveringRuleIndex: 8, CoveringRuleID: "replicas"},
+			{RuleIndex: 9, RuleID: "replicas-copy", Kind: Redundant, CoveringRuleIndex: 8, CoveringRuleID: "replicas"},
+		})
+		So(shadowedRules[0].String(), ShouldEqual, "rule 1 [allow-db-read] is shadowed by rule 0 [block-db]")
+
+		str = "test the shadowed rules with other combining algorithms"
+		fmt.Println(str)
+
+		rules.CombiningAlgorithm = AllowOverrides // the allow decisions are not shadowed
+		shadowedRules, err = FindShadowedRules(&rules, PredefinedStringsAndLists{})
+		So(err, ShouldBeNil)
+		indices := []int{}
+		for _, shadowedRule := range shadowedRules {
+			indices = append(indices, shadowedRule.RuleIndex)
+		}
+		So(indices, ShouldResemble, []int{2, 4, 7, 9})
+
+		rules.Rules[0], rules.Rules[1] = rules.Rules[1], rules.Rules[0]
+		rules.CombiningAlgorithm = FirstApplicable // the first rule is not covered by the second one
+		shadowedRules, err = FindShadowedRules(&rules, PredefinedStringsAndLists{})
+		So(err, ShouldBeNil)
+		So(shadowedRules[0].RuleIndex, ShouldEqual, 2)
+		So(shadowedRules[0].CoveringRuleIndex, ShouldEqual, 1)
+
+		policySet, err := CompilePolicySet(&rules, PredefinedStringsAndLists{}, WithCombiningAlgorithm(MaxDecision))
+		So(err, ShouldBeNil)
+		So(policySet.FindShadowedRules()[0].RuleIndex, ShouldEqual, 0) // the option overrides the combining algorithm of the rule set
+
+		str = "test the coverage of patterns"
+		fmt.Println(str)
+
+		globTestCases := []struct {
+			a, b     string
+			expected bool
+		}{
+			{"*", "abc?", true},
+			{"a*", "abc", true},
+			{"a*", "ab*", true},
+			{"a*c", "ab?c", true},
+			{"a*c", "ab*", false},
+			{"a?c", "abc", true},
+			{"a?c", "a*c", false},
+			{"abc", "a*", false},
+		}
+		for _, testCase := range globTestCases {
+			So(globCovers(testCase.a, testCase.b), ShouldEqual, testCase.expected)
+		}
+
+		subnetTestCases := []struct {
+			a, b     string
+			expected bool
+		}{
+			{"10.0.0.0/8", "10.1.0.0/16", true},
+			{"10.1.0.0/16", "10.0.0.0/8", false},
+			{"10.0.0.0/8", "10.1.2.3", true},
+			{"10.1.2.3", "10.1.2.3", true},
+			{"10.1.2.3", "10.1.2.3/32", false},
+			{"*", "192.168.1.0/24", true},
+			{"10.0.0.0/8", "::1", false},
+		}
+		for _, testCase := range subnetTestCases {
+			a, err := ConvertStringToExpandedSenderReceiver(testCase.a, "subnet")
+			So(err, ShouldBeNil)
+			b, err := ConvertStringToExpandedSenderReceiver(testCase.b, "subnet")
+			So(err, ShouldBeNil)
+			So(senderReceiverListCovers(a, b), ShouldEqual, testCase.expected)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package MAPL_engine
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+var stringMethodsTestCases = []conditionMethodTestCase{
+	{"jsonpath:$.spec.containers[0].image", "PREFIX", "registry.io/", true},
+	{"jsonpath:$.spec.containers[0].image", "PREFIX", "registry.iox", false},
+	{"jsonpath:$.spec.containers[0].image", "NPREFIX", "docker.io/", true},
+	{"jsonpath:$.spec.containers[0].image", "SUFFIX", ":1.0+debug", true},
+	{"jsonpath:$.spec.containers[0].image", "NSUFFIX", ":1.0+debug", false},
+	{"jsonpath:$.spec.containers[0].image", "CONTAINS", "nginx", true},
+	{"jsonpath:$.spec.containers[0].image", "NCONTAINS", "debug", false},
+	{"jsonpath:$.kind", "EQ_CI", "pod", true},
+	{"jsonpath:$.kind", "NEQ_CI", "POD", false},
+	{"jsonpath:$.kind", "IN_CI", "[deployment,POD]", true},
+	{"jsonpath:$.kind", "NIN_CI", "[deployment,daemonset]", true},
+	{"jsonpath:$.kind", "IN_CI", "[deployment, POD]", true}, // the spaces around the items are removed
+	{"jsonpath:$.kind", "NIN_CI", "[deployment, pod ]", false},
+	{"jsonpath:$.kind", "contains", "o", true},
+	{"jsonpath:$.missing", "NCONTAINS", "x", false}, // false on a missing attribute (as NRE)
+	{"senderLabel[app]", "PREFIX", "fron", true},
+	{"senderLabel[app]", "EQ_CI", "FRONTEND", true},
+	{"receiverLabel[team]", "NSUFFIX", "ops", false},
+	{"receiverLabel[team]", "IN_CI", "[DevOps,sec]", true},
+	{"$sender.namespace", "CONTAINS", "prod", true},
+	{"$receiver.namespace", "NPREFIX", "kube-", true},
+	{"requestUseragent", "PREFIX", "Mozilla/5.0 (", true},
+	{"requestUseragent", "CONTAINS", "curl", false},
+	{"domain", "SUFFIX", ".example.com", true},
+	{"domain", "EQ_CI", "API.EXAMPLE.COM", true},
+}
+
+func TestStringMethods(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test the string methods"
+		fmt.Println(str)
+
+		messages := methodTestMessages(MessageAttributes{
+			SourceLabels:         map[string]string{"app": "frontend"},
+			DestinationLabels:    map[string]string{"team": "devops"},
+			SourceNamespace:      "prod-web",
+			DestinationNamespace: "default",
+			RequestUseragent:     "Mozilla/5.0 (X11; Linux x86_64)",
+			Domain:               "api.example.com",
+		}, `{"kind":"Pod","spec":{"containers":[{"image":"registry.io/nginx:1.0+debug"}]}}`)
+		testConditionMethods(stringMethodsTestCases, PredefinedStringsAndLists{}, messages)
+		testConditionMethodsStrings(stringMethodsTestCases)
+
+		str = "test the negation and the yaml of the string methods"
+		fmt.Println(str)
+
+		for _, prepare := range []bool{false, true} {
+			c := normalizeTestConditionsTree(`
+NOT:
+  attribute: "jsonpath:$.kind"
+  method: IN_CI
+  value: "[pod,deployment]"`)
+			if prepare {
+				err := c.ConditionsTree.PrepareAndValidate(PredefinedStringsAndLists{})
+				So(err, ShouldBeNil)
+			}
+			So(NormalizeWithNegatedMethods(c.ConditionsTree).String(), ShouldEqual, "<jsonpath:$.kind-NIN_CI-[pod,deployment]>")
+			yamlBytes, err := yaml.Marshal(c)
+			So(err, ShouldBeNil)
+			So(string(yamlBytes), ShouldContainSubstring, "method: IN_CI")
+		}
+
+		c := normalizeTestConditionsTree(`
+NOT:
+  attribute: "jsonpath:$.kind"
+  method: IN
+  value: "[Pod,Deployment]"`)
+		err := c.ConditionsTree.PrepareAndValidate(PredefinedStringsAndLists{})
+		So(err, ShouldBeNil)
+		So(NormalizeWithNegatedMethods(c.ConditionsTree).String(), ShouldEqual, "<jsonpath:$.kind-NIN-[Pod,Deployment]>")
+
+		str = "test the mongo queries of the string methods"
+		fmt.Println(str)
+
+		p := Condition{Attribute: "jsonpath:$.spec.image", Method: "PREFIX", Value: "registry.io/"} // the string methods are converted to RE/NRE
+		err = p.PrepareAndValidate(PredefinedStringsAndLists{})
+		So(err, ShouldBeNil)
+		q, _, err := p.ToMongoQuery("raw", "", 0)
+		So(err, ShouldBeNil)
+		So(q, ShouldResemble, bson.M{"raw.spec.image": bson.M{"$regex": `^registry\.io/`}})
+		n := Condition{Attribute: "jsonpath:$.kind", Method: "NEQ_CI", Value: "pod"}
+		err = n.PrepareAndValidate(PredefinedStringsAndLists{})
+		So(err, ShouldBeNil)
+		q, _, err = n.ToMongoQuery("raw", "", 0)
+		So(err, ShouldBeNil)
+		So(q, ShouldResemble, bson.M{"$and": []bson.M{{"raw.kind": bson.M{"$not": bson.M{"$regex": "(?i)^pod$"}}}, {"raw.kind": bson.M{"$exists": true}}}})
+
+		str = "test the validation of the string methods"
+		fmt.Println(str)
+
+		for _, invalid := range []Condition{
+			{Attribute: "jsonpath:$.kind", Method: "PREFIX", Value: ""},
+			{Attribute: "jsonpath:$.kind", Method: "IN_CI", Value: "[]"},
+			{Attribute: "payloadSize", Method: "CONTAINS", Value: "1"},
+			{Attribute: "senderLabel[app]", Method: "EQ_CI", Value: "receiverLabel[app]"},
+			{Attribute: "jsonpath:$.kind", Method: "PREFIXES", Value: "x"},
+		} {
+			_, err = ValidateOneCondition(&invalid)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
@@ -2,7 +2,6 @@ package MAPL_engine
 
 import (
 	"fmt"
-	"log"
 	"math"
 	"regexp"
 	"strings"
@@ -72,6 +71,70 @@ func ConvertStringToRegex(str_in, method string) string {
 	return str_out
 }
 
+// convertGlobToRegex converts a glob pattern to an anchored regex: "*" matches any characters except "/", "**" matches any characters,
+// "?" matches one character except "/", "[abc]", "[a-z]" and "[!abc]" (or "[^abc]") are character classes and "\" escapes the next character.
+func convertGlobToRegex(glob string) (string, error) {
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch ch := runes[i]; ch {
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '\\':
+			if i+1 == len(runes) {
+				return "", fmt.Errorf("glob pattern ends with an escape character [%v]", glob)
+			}
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case '[':
+			end := i + 1
+			if end < len(runes) && (runes[end] == '!' || runes[end] == '^') {
+				end++
+			}
+			if end < len(runes) && runes[end] == ']' { // a "]" right after the "[" is part of the class
+				end++
+			}
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end == len(runes) {
+				return "", fmt.Errorf("unclosed character class in glob pattern [%v]", glob)
+			}
+			class := runes[i+1 : end]
+			sb.WriteString("[")
+			if class[0] == '!' || class[0] == '^' {
+				sb.WriteString("^")
+				class = class[1:]
+			}
+			for _, c := range class {
+				if c == '\\' || c == '[' || c == ']' {
+					sb.WriteString("\\")
+				}
+				sb.WriteRune(c)
+			}
+			sb.WriteString("]")
+			i = end
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	sb.WriteString("$")
+	regex := sb.String()
+	if _, err := regexp.Compile(regex); err != nil {
+		return "", fmt.Errorf("invalid glob pattern [%v]", glob)
+	}
+	return regex, nil
+}
+
 func ConvertStringToExpandedSenderReceiver(str_in string, type_in string) ([]ExpandedSenderReceiver, error) {
 	var output []ExpandedSenderReceiver
 
@@ -174,18 +237,17 @@ func removeQuotesAndBrackets(valueToCompareString string) string {
 	return valueToCompareString
 }
 
-func removeQuotesFromResult(str string) (string, bool) {
+func removeQuotesFromResult(str string) (string, error) {
 
 	L := len(str) - 1
 	if L > 0 {
 		if (str[0] == '"' && str[L] != '"') || (str[L] == '"' && str[0] != '"') {
-			log.Println("quotation marks not aligned")
-			return "", false
+			return "", fmt.Errorf("quotation marks not aligned")
 		}
 
 		if str[L] == '"' && str[0] == '"' {
 			str = str[1:L]
 		}
 	}
-	return str, true
+	return str, nil
 }
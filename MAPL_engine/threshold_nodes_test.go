@@ -0,0 +1,276 @@
+package MAPL_engine
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+const thresholdNodesTestRules = `
+rules:
+  - ruleID: "at-least"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      AT_LEAST:
+        n: 2
+        conditions:
+        - attribute: "jsonpath:$.kind"
+          method: EQ
+          value: "Pod"
+        - attribute: "jsonpath:$.kind"
+          method: EQ
+          value: "Deployment"
+        - ANY:
+            parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+            returnValueJsonpath:
+              name: "jsonpath:$RELATIVE.name"
+            AND:
+            - attribute: "jsonpath:$RELATIVE.resources.limits.memory"
+              method: LT
+              value: 1.2Gi
+    decision: block
+
+  - ruleID: "at-most"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      AT_MOST:
+        n: 1
+        conditions:
+        - attribute: "jsonpath:$.kind"
+          method: EQ
+          value: "Pod"
+        - attribute: "jsonpath:$.metadata.name"
+          method: EQ
+          value: "hello-apparmor"
+    decision: block
+
+  - ruleID: "exactly"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      EXACTLY:
+        n: 1
+        conditions:
+        - attribute: "jsonpath:$.kind"
+          method: EQ
+          value: "Pod"
+        - attribute: "jsonpath:$.kind"
+          method: EQ
+          value: "Deployment"
+    decision: alert
+
+  - ruleID: "xor"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      XOR:
+      - attribute: "jsonpath:$.kind"
+        method: EQ
+        value: "Pod"
+      - attribute: "jsonpath:$.metadata.name"
+        method: EQ
+        value: "hello-apparmor"
+    decision: allow
+`
+
+func TestThresholdNodes(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test the evaluation of threshold nodes"
+		fmt.Println(str)
+
+		message := MessageAttributes{}
+		testCases := []struct {
+			node     Node
+			expected bool
+		}{
+			{&AtLeast{2, []Node{True{}, False{}, True{}}}, true},
+			{&AtLeast{3, []Node{True{}, False{}, True{}}}, false},
+			{&AtLeast{0, []Node{False{}}}, true},
+			{&AtMost{1, []Node{True{}, False{}, False{}}}, true},
+			{&AtMost{1, []Node{True{}, False{}, True{}}}, false},
+			{&AtMost{0, []Node{False{}, False{}}}, true},
+			{&Exactly{2, []Node{True{}, False{}, True{}}}, true},
+			{&Exactly{2, []Node{True{}, True{}, True{}}}, false},
+			{&Exactly{2, []Node{True{}, False{}, False{}}}, false},
+			{&Xor{[]Node{True{}, False{}}}, true},
+			{&Xor{[]Node{True{}, True{}}}, false},
+			{&Xor{[]Node{False{}, False{}, False{}}}, false},
+			{&Xor{[]Node{False{}, True{}, False{}}}, true},
+		}
+		for _, testCase := range testCases {
+			flag, _ := testCase.node.Eval(&message)
+			So(flag, ShouldEqual, testCase.expected)
+		}
+
+		str = "test rules with threshold nodes"
+		fmt.Println(str)
+
+		rules, err := YamlReadRulesFromString(thresholdNodesTestRules)
+		So(err, ShouldBeNil)
+		messages, err := YamlReadMessagesFromFile("../files/messages/messages_base_jsonpath.yaml")
+		So(err, ShouldBeNil)
+		data, err := ReadBinaryFile("../files/raw_json_data/any_all/json_raw_data_2containers_cpu2_mem2000.json")
+		So(err, ShouldBeNil)
+		var dataInterface interface{}
+		err = json.Unmarshal(data, &dataInterface)
+		So(err, ShouldBeNil)
+
+		messageBytes := messages.Messages[0]
+		messageBytes.RequestJsonRaw = &data
+		messageInterface := messages.Messages[0]
+		messageInterface.RequestRawInterface = &dataInterface
+
+		for _, message := range []MessageAttributes{messageBytes, messageInterface} {
+			decision, _, _, results, _, _, extraData := Check(&message, &rules)
+			So(results, ShouldResemble, []int{BLOCK, DEFAULT, ALERT, DEFAULT})
+			So(decision, ShouldEqual, BLOCK)
+			So(extraData[0], ShouldResemble, []map[string]interface{}{{"name": "c1"}}) // the extra data of the ANY node
+		}
+
+		str = "test the string, json and bson of threshold nodes"
+		fmt.Println(str)
+
+		So(rules.Rules[1].Conditions.ConditionsTree.String(), ShouldEqual, "[AT_MOST<1>:(<jsonpath:$.kind-EQ-Pod>, <jsonpath:$.metadata.name-EQ-hello-apparmor>)]")
+		So(rules.Rules[3].Conditions.ConditionsTree.String(), ShouldEqual, "(<jsonpath:$.kind-EQ-Pod> ^ <jsonpath:$.metadata.name-EQ-hello-apparmor>)")
+
+		for _, rule := range rules.Rules {
+			conditionsJson, err := json.Marshal(rule.Conditions)
+			So(err, ShouldBeNil)
+			var conditions ConditionsTree
+			err = json.Unmarshal(conditionsJson, &conditions)
+			So(err, ShouldBeNil)
+			So(conditions.ConditionsTree.String(), ShouldEqual, rule.Conditions.ConditionsTree.String())
+
+			conditionsBson, err := bson.Marshal(rule.Conditions)
+			So(err, ShouldBeNil)
+			conditions = ConditionsTree{}
+			err = bson.Unmarshal(conditionsBson, &conditions)
+			So(err, ShouldBeNil)
+			So(conditions.ConditionsTree.String(), ShouldEqual, rule.Conditions.ConditionsTree.String())
+		}
+
+		conditionsJson, err := json.Marshal(rules.Rules[2].Conditions)
+		So(err, ShouldBeNil)
+		So(string(conditionsJson), ShouldContainSubstring, `{"EXACTLY":{"n":1,"conditions":[{"condition":`)
+
+		str = "test the mongo queries of threshold nodes"
+		fmt.Println(str)
+
+		q, pipeline, err := rules.Rules[1].GetPreparedRule().Conditions.ConditionsTree.ToMongoQuery("raw", "", 0)
+		So(err, ShouldBeNil)
+		So(pipeline, ShouldBeEmpty)
+		kindPod := bson.M{"raw.kind": bson.M{"$eq": "Pod"}}
+		namePod := bson.M{"raw.metadata.name": bson.M{"$eq": "hello-apparmor"}}
+		So(q, ShouldResemble, bson.M{"$nor": []bson.M{{"$or": []bson.M{{"$and": []bson.M{kindPod, namePod}}}}}})
+
+		q, _, err = rules.Rules[3].GetPreparedRule().Conditions.ConditionsTree.ToMongoQuery("raw", "", 0)
+		So(err, ShouldBeNil)
+		atLeastOne := bson.M{"$or": []bson.M{{"$and": []bson.M{kindPod}}, {"$and": []bson.M{namePod}}}}
+		atLeastTwo := bson.M{"$or": []bson.M{{"$and": []bson.M{kindPod, namePod}}}}
+		So(q, ShouldResemble, bson.M{"$and": []bson.M{atLeastOne, {"$nor": []bson.M{atLeastTwo}}}})
+
+		q, _, err = rules.Rules[0].GetPreparedRule().Conditions.ConditionsTree.ToMongoQuery("raw", "", 0)
+		So(err, ShouldBeNil)
+		So(q["$or"], ShouldHaveLength, 3) // 3 choose 2
+
+		manyNodes := []Node{}
+		for i := 0; i < 20; i++ {
+			manyNodes = append(manyNodes, rules.Rules[1].GetPreparedRule().Conditions.ConditionsTree.(*AtMost).Nodes[0])
+		}
+		_, _, err = (&AtLeast{10, manyNodes}).ToMongoQuery("raw", "", 0)
+		So(err, ShouldNotBeNil) // too many combinations
+
+		str = "test invalid threshold nodes"
+		fmt.Println(str)
+
+		invalidConditions := []string{
+			`{"AT_LEAST":{"n":3,"conditions":[{"condition":{"attribute":"jsonpath:$.kind","method":"EQ","value":"Pod"}}]}}`,
+			`{"AT_LEAST":{"n":-1,"conditions":[{"condition":{"attribute":"jsonpath:$.kind","method":"EQ","value":"Pod"}}]}}`,
+			`{"AT_MOST":{"n":1.5,"conditions":[{"condition":{"attribute":"jsonpath:$.kind","method":"EQ","value":"Pod"}}]}}`,
+			`{"EXACTLY":{"conditions":[{"condition":{"attribute":"jsonpath:$.kind","method":"EQ","value":"Pod"}}]}}`,
+			`{"EXACTLY":{"n":1,"conditions":{"condition":{"attribute":"jsonpath:$.kind","method":"EQ","value":"Pod"}}}}`,
+			`{"AT_LEAST":[{"condition":{"attribute":"jsonpath:$.kind","method":"EQ","value":"Pod"}}]}`,
+		}
+		for _, invalidCondition := range invalidConditions {
+			var conditions ConditionsTree
+			err = json.Unmarshal([]byte(invalidCondition), &conditions)
+			So(err, ShouldNotBeNil)
+		}
+
+		str = "test the n key of threshold nodes in yaml"
+		fmt.Println(str)
+
+		for _, nKey := range []string{`n`, `"n"`, `'n'`} { // yaml (v1.1) reads an unquoted n as the boolean false
+			conditions := normalizeTestConditionsTree(`
+AT_MOST:
+  ` + nKey + `: 1
+  conditions:
+  - attribute: "jsonpath:$.kind"
+    method: EQ
+    value: "Pod"
+  - attribute: "jsonpath:$.kind"
+    method: EQ
+    value: "Deployment"`)
+			So(conditions.ConditionsTree.String(), ShouldEqual, "[AT_MOST<1>:(<jsonpath:$.kind-EQ-Deployment>, <jsonpath:$.kind-EQ-Pod>)]")
+		}
+		for _, invalidKeys := range []string{`"false": 1`, "n: 1\n  \"n\": 1", `count: 1`} {
+			var conditions ConditionsTree
+			err = yaml.Unmarshal([]byte(`
+AT_MOST:
+  `+invalidKeys+`
+  conditions:
+  - attribute: "jsonpath:$.kind"
+    method: EQ
+    value: "Pod"`), &conditions)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
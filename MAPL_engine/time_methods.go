@@ -0,0 +1,121 @@
+package MAPL_engine
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//--------------------------------------
+// Timestamp and Age Methods
+//--------------------------------------
+
+var timeMethods = []string{"BEFORE", "AFTER", "OLDER_THAN", "NEWER_THAN"}
+
+var durationPartRegex = regexp.MustCompile(`(\d+(?:\.\d+)?)(ms|us|ns|w|d|h|m|s)`)
+
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+}
+
+func isTimeMethod(method string) bool {
+	method = strings.ToUpper(method)
+	for _, m := range timeMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// WithClock sets the clock that gives the reference "now" of the OLDER_THAN/NEWER_THAN methods (instead of the message's RequestTime)
+func WithClock(clock func() time.Time) CheckOption {
+	return func(o *checkOptions) {
+		o.clock = clock
+	}
+}
+
+// now returns the reference time of the OLDER_THAN/NEWER_THAN methods: the clock of the context, the message's RequestTime or else the current time
+func (e *EvalContext) now(message *MessageAttributes) time.Time {
+	if e != nil && e.Clock != nil {
+		return e.Clock()
+	}
+	if t, err := parseTimestamp(message.RequestTime); err == nil {
+		return t
+	}
+	return time.Now()
+}
+
+// parseTimestamp parses RFC3339 timestamps ("2024-05-01T10:00:00Z") and dates ("2024-05-01")
+func parseTimestamp(str string) (time.Time, error) {
+	str = strings.TrimSpace(str)
+	t, err := time.Parse(time.RFC3339Nano, str)
+	if err == nil {
+		return t, nil
+	}
+	t, err = time.Parse("2006-01-02", str)
+	if err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp [%v]", str)
+}
+
+// parseAgeDuration parses durations such as "30d", "12h", "1w", "1d12h" and "-30d" (a negative age is in the future)
+func parseAgeDuration(str string) (time.Duration, error) {
+	str = strings.TrimSpace(str)
+	sign := time.Duration(1)
+	durationString := str
+	if strings.HasPrefix(durationString, "-") {
+		sign = -1
+		durationString = durationString[1:]
+	}
+	parts := durationPartRegex.FindAllStringSubmatchIndex(durationString, -1)
+	if len(parts) == 0 {
+		return 0, fmt.Errorf("invalid duration [%v]", str)
+	}
+	var duration time.Duration
+	end := 0
+	for _, part := range parts {
+		if part[0] != end {
+			return 0, fmt.Errorf("invalid duration [%v]", str)
+		}
+		end = part[1]
+		number, err := strconv.ParseFloat(durationString[part[2]:part[3]], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration [%v]", str)
+		}
+		duration += time.Duration(number * float64(durationUnits[durationString[part[4]:part[5]]]))
+	}
+	if end != len(durationString) {
+		return 0, fmt.Errorf("invalid duration [%v]", str)
+	}
+	return sign * duration, nil
+}
+
+// compareTimeFunc returns false if the value is not a timestamp
+func compareTimeFunc(value1 string, c *Condition, now time.Time) bool {
+	t, err := parseTimestamp(value1)
+	if err != nil {
+		return false
+	}
+	switch strings.ToUpper(c.Method) {
+	case "BEFORE":
+		return c.ValueTime != nil && t.Before(*c.ValueTime)
+	case "AFTER":
+		return c.ValueTime != nil && t.After(*c.ValueTime)
+	case "OLDER_THAN":
+		return c.ValueDuration != nil && now.Sub(t) > *c.ValueDuration
+	case "NEWER_THAN":
+		return c.ValueDuration != nil && now.Sub(t) < *c.ValueDuration
+	}
+	return false
+}
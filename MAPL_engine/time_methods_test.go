@@ -0,0 +1,100 @@
+package MAPL_engine
+
+import (
+	"context"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+)
+
+var timeMethodsTestCases = []conditionMethodTestCase{
+	{"jsonpath:$.metadata.creationTimestamp", "BEFORE", "2024-01-01T00:00:00Z", true},
+	{"jsonpath:$.metadata.creationTimestamp", "AFTER", "2023-12-31", true},
+	{"jsonpath:$.metadata.creationTimestamp", "AFTER", "2024-01-01T00:00:00+00:30", false}, // 2023-12-31T23:30:00Z
+	{"jsonpath:$.metadata.creationTimestamp", "OLDER_THAN", "90d", true},
+	{"jsonpath:$.metadata.creationTimestamp", "OLDER_THAN", "30w", false},
+	{"jsonpath:$.metadata.creationTimestamp", "NEWER_THAN", "1w12h", false},
+	{"jsonpath:$.status.notAfter", "OLDER_THAN", "-30d", true}, // expires within 30 days
+	{"jsonpath:$.status.notAfter", "OLDER_THAN", "-12h", false},
+	{"jsonpath:$.status.notAfter", "NEWER_THAN", "0s", true}, // in the future
+	{"jsonpath:$.status.lastProbeTime", "NEWER_THAN", "1.5h", true},
+	{"jsonpath:$.status.lastProbeTime", "newer_than", "30m", false},
+	{"jsonpath:$.metadata.name", "BEFORE", "2024-01-01", false}, // not a timestamp
+	{"jsonpath:$.missing", "OLDER_THAN", "1d", false},
+}
+
+func TestTimeMethods(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test the timestamp and age methods"
+		fmt.Println(str)
+
+		messages := methodTestMessages(MessageAttributes{RequestTime: "2024-06-01T12:00:00Z"}, // the reference "now"
+			`{"metadata":{"name":"a","creationTimestamp":"2023-12-31T23:00:00Z"},"status":{"notAfter":"2024-06-11T00:00:00Z","lastProbeTime":"2024-06-01T11:00:00.5Z"}}`)
+		testConditionMethods(timeMethodsTestCases, PredefinedStringsAndLists{}, messages)
+
+		str = "test the clock of the evaluation"
+		fmt.Println(str)
+
+		c := Condition{Attribute: "jsonpath:$.status.notAfter", Method: "OLDER_THAN", Value: "-30d"}
+		err := c.PrepareAndValidate(PredefinedStringsAndLists{})
+		So(err, ShouldBeNil)
+		evalContext := NewEvalContext(context.Background())
+		evalContext.Clock = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) } // the clock is used instead of RequestTime
+		message := messages[0]
+		flag, _, err := c.EvalWithContext(evalContext, message)
+		So(err, ShouldBeNil)
+		So(flag, ShouldBeFalse)
+
+		rules, err := YamlReadRulesFromString(`
+rules:
+  - ruleID: "expiring-certificate"
+    sender:
+      senderName: "*"
+      senderType: "*"
+    receiver:
+      receiverName: "*"
+      receiverType: "*"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      attribute: "jsonpath:$.status.notAfter"
+      method: OLDER_THAN
+      value: "-30d"
+    decision: alert`)
+		So(err, ShouldBeNil)
+		message.RequestTime = ""
+		result, err := CheckWithContext(context.Background(), message, &rules, WithClock(func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }))
+		So(err, ShouldBeNil)
+		So(result.Decision, ShouldEqual, ALERT)
+		result, err = CheckWithContext(context.Background(), message, &rules, WithClock(func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }))
+		So(err, ShouldBeNil)
+		So(result.Decision, ShouldEqual, DEFAULT)
+
+		str = "test the validation of the timestamp and age methods"
+		fmt.Println(str)
+
+		for _, invalid := range []Condition{
+			{Attribute: "jsonpath:$.metadata.creationTimestamp", Method: "BEFORE", Value: ""},
+			{Attribute: "jsonpath:$.metadata.creationTimestamp", Method: "BEFORE", Value: "yesterday"},
+			{Attribute: "jsonpath:$.metadata.creationTimestamp", Method: "AFTER", Value: "2024-13-01"},
+			{Attribute: "jsonpath:$.metadata.creationTimestamp", Method: "OLDER_THAN", Value: "30"},
+			{Attribute: "jsonpath:$.metadata.creationTimestamp", Method: "OLDER_THAN", Value: "30 days"},
+			{Attribute: "jsonpath:$.metadata.creationTimestamp", Method: "NEWER_THAN", Value: "d"},
+			{Attribute: "payloadSize", Method: "NEWER_THAN", Value: "1d"},
+		} {
+			_, err = ValidateOneCondition(&invalid)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
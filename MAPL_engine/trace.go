@@ -0,0 +1,284 @@
+package MAPL_engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bhmj/jsonslice"
+	"strings"
+)
+
+//--------------------------------------
+// Trace (explain mode)
+//--------------------------------------
+
+// Trace explains the result of checking a message against the rules (see WithTrace)
+type Trace struct {
+	Rules []RuleTrace `json:"rules"`
+}
+
+// RuleTrace explains why a rule does or does not apply to the message
+type RuleTrace struct {
+	RuleIndex  int        `json:"ruleIndex"`
+	RuleID     string     `json:"ruleID"`
+	Decision   string     `json:"decision"`             // the decision of the rule (DEFAULT if the rule doesn't apply)
+	Applies    bool       `json:"applies"`              // true if the rule applies to the message
+	RejectedBy string     `json:"rejectedBy,omitempty"` // the stage that rejected the message: sender, receiver, operation, protocol, resource or conditions
+	Error      string     `json:"error,omitempty"`
+	Conditions *TraceNode `json:"conditions,omitempty"` // the trace of the conditions tree (if the conditions were evaluated)
+}
+
+// the stages of testing a rule
+const (
+	StageSender     = "sender"
+	StageReceiver   = "receiver"
+	StageOperation  = "operation"
+	StageProtocol   = "protocol"
+	StageResource   = "resource"
+	StageConditions = "conditions"
+)
+
+// TraceNode mirrors one node of the conditions tree with the result of its evaluation.
+// The children of ANY/ALL/COUNT nodes are the traces of the inner node for each array element that was evaluated (ANY stops at the first match unless
+// there are return values. ALL stops at the first element that doesn't match. COUNT evaluates all of the elements).
+type TraceNode struct {
+	Type            string       `json:"type"`                      // AND, OR, NOT, AT_LEAST, AT_MOST, EXACTLY, XOR, ANY, ALL, COUNT, REF, TRUE, FALSE or CONDITION
+	Node            string       `json:"node,omitempty"`            // the condition, the parent jsonpath of ANY/ALL/COUNT nodes (and the comparison of COUNT nodes), the n of AT_LEAST/AT_MOST/EXACTLY nodes or the name of REF nodes
+	ArrayIndex      *int         `json:"arrayIndex,omitempty"`      // the index of the array element (for the children of ANY/ALL/COUNT nodes)
+	Result          bool         `json:"result"`                    // the result of the node
+	Value           interface{}  `json:"value,omitempty"`           // the resolved value of the condition's attribute (or the number of matched elements of COUNT nodes)
+	MatchedElements []int        `json:"matchedElements,omitempty"` // the array elements that matched (for ANY/ALL/COUNT nodes)
+	Error           string       `json:"error,omitempty"`
+	Children        []*TraceNode `json:"children,omitempty"`
+}
+
+// WithTrace returns the trace of the evaluation of every rule in the result (Result.Trace)
+func WithTrace() CheckOption {
+	return func(o *checkOptions) {
+		o.trace = true
+	}
+}
+
+// traceNode starts the trace of a node. it returns the trace node and the context to evaluate the node's children with.
+// if we don't trace then the trace node is nil (and the methods of a nil trace node do nothing).
+func (e *EvalContext) traceNode(nodeType, node string) (*TraceNode, *EvalContext) {
+	if e.trace == nil {
+		return nil, e
+	}
+	t := &TraceNode{Type: nodeType, Node: node}
+	e.trace.Children = append(e.trace.Children, t)
+	childContext := *e
+	childContext.trace = t
+	return t, &childContext
+}
+
+// rejectedBy records the stage that rejected the message
+func (e *EvalContext) rejectedBy(stage string) {
+	if e.ruleTrace != nil {
+		e.ruleTrace.RejectedBy = stage
+	}
+}
+
+func (t *TraceNode) setResult(result bool, err error) {
+	if t == nil {
+		return
+	}
+	t.Result = result
+	if err != nil {
+		t.Error = err.Error()
+	}
+}
+
+func (t *TraceNode) setValue(value interface{}) {
+	if t != nil {
+		t.Value = value
+	}
+}
+
+// setArrayElement marks the last child as the trace of the array element (and records if it matched)
+func (t *TraceNode) setArrayElement(i int, matched bool) {
+	if t == nil || len(t.Children) == 0 {
+		return
+	}
+	index := i
+	t.Children[len(t.Children)-1].ArrayIndex = &index
+	if matched {
+		t.MatchedElements = append(t.MatchedElements, i)
+	}
+}
+
+// newRuleTrace returns a context that traces the evaluation of one rule
+func (e *EvalContext) newRuleTrace(ruleIndex int, ruleID string) (*RuleTrace, *EvalContext) {
+	ruleTrace := &RuleTrace{RuleIndex: ruleIndex, RuleID: ruleID}
+	ruleContext := *e
+	ruleContext.trace = &TraceNode{} // holds the root of the conditions tree
+	ruleContext.ruleTrace = ruleTrace
+	return ruleTrace, &ruleContext
+}
+
+// endRuleTrace completes the trace of the rule with its decision
+func (e *EvalContext) endRuleTrace(decision string, applies bool, err error) {
+	ruleTrace := e.ruleTrace
+	if ruleTrace == nil {
+		return
+	}
+	ruleTrace.Decision = decision
+	ruleTrace.Applies = applies
+	if err != nil {
+		ruleTrace.Error = err.Error()
+	}
+	if len(e.trace.Children) > 0 {
+		ruleTrace.Conditions = e.trace.Children[0]
+	}
+}
+
+// String renders the trace as an indented text tree
+func (t *Trace) String() string {
+	var sb strings.Builder
+	for _, ruleTrace := range t.Rules {
+		ruleTrace.writeText(&sb)
+	}
+	return sb.String()
+}
+
+func (r RuleTrace) String() string {
+	var sb strings.Builder
+	r.writeText(&sb)
+	return sb.String()
+}
+
+func (r RuleTrace) writeText(sb *strings.Builder) {
+	fmt.Fprintf(sb, "rule %v [%v]: %v", r.RuleIndex, r.RuleID, r.Decision)
+	if r.RejectedBy != "" {
+		fmt.Fprintf(sb, " (rejected by %v)", r.RejectedBy)
+	}
+	if r.Error != "" {
+		fmt.Fprintf(sb, " error: %v", r.Error)
+	}
+	sb.WriteString("\n")
+	if r.Conditions != nil {
+		r.Conditions.writeText(sb, 1)
+	}
+}
+
+func (t *TraceNode) String() string {
+	var sb strings.Builder
+	t.writeText(&sb, 0)
+	return sb.String()
+}
+
+func (t *TraceNode) writeText(sb *strings.Builder, depth int) {
+	sb.WriteString(strings.Repeat("  ", depth))
+	if t.ArrayIndex != nil {
+		fmt.Fprintf(sb, "[%v] ", *t.ArrayIndex)
+	}
+	sb.WriteString(t.Type)
+	if t.Node != "" {
+		fmt.Fprintf(sb, " %v", t.Node)
+	}
+	fmt.Fprintf(sb, ": %v", t.Result)
+	if t.Value != nil {
+		value, err := json.Marshal(t.Value)
+		if err != nil {
+			value = []byte(fmt.Sprintf("%v", t.Value))
+		}
+		fmt.Fprintf(sb, " (value: %s)", value)
+	}
+	if t.Type == "ANY" || t.Type == "ALL" || t.Type == "COUNT" {
+		fmt.Fprintf(sb, " (matched elements: %v)", t.MatchedElements)
+	}
+	if t.Error != "" {
+		fmt.Fprintf(sb, " error: %v", t.Error)
+	}
+	sb.WriteString("\n")
+	for _, child := range t.Children {
+		child.writeText(sb, depth+1)
+	}
+}
+
+// resolveConditionValue gives the value of the condition's attribute in the message (used only for tracing)
+func resolveConditionValue(c *Condition, message *MessageAttributes) interface{} {
+
+	switch c.Attribute {
+	case "payloadSize":
+		return message.RequestSize
+	case "requestUseragent":
+		return message.RequestUseragent
+	case "utcHoursFromMidnight":
+		return message.RequestTimeHoursFromMidnightUTC
+	case "encryptionType":
+		return message.EncryptionType
+	case "encryptionVersion":
+		if message.EncryptionVersion == nil {
+			return nil
+		}
+		return *message.EncryptionVersion
+	case "domain":
+		return message.Domain
+	case "$sender":
+		return getAttribute("$sender", c.AttributeSenderObjectAttribute, *message)
+	case "$receiver":
+		return getAttribute("$receiver", c.AttributeReceiverObjectAttribute, *message)
+	case "senderLabel":
+		if value, ok := message.SourceLabels[c.AttributeSenderLabelKey]; ok {
+			return value
+		}
+	case "receiverLabel":
+		if value, ok := message.DestinationLabels[c.AttributeReceiverLabelKey]; ok {
+			return value
+		}
+	case "jsonpath":
+		return resolveJsonpathValue(c, message)
+	}
+	return nil
+}
+
+func resolveJsonpathValue(c *Condition, message *MessageAttributes) interface{} {
+
+	isKeyValue := c.AttributeJsonpathQuery == "$KEY" || strings.HasPrefix(c.AttributeJsonpathQuery, "$VALUE")
+
+	if message.RequestRawInterface != nil && c.PreparedJsonpathQuery != nil {
+		var value interface{}
+		var err error
+		switch {
+		case c.AttributeIsJsonpathRelative && message.RequestRawInterfaceRelative == nil:
+			return nil
+		case c.AttributeIsJsonpathRelative && isKeyValue:
+			value, err = getKeyValueFromInterface(c, message)
+		case c.AttributeIsJsonpathRelative:
+			value, err = queryInterface(c.PreparedJsonpathQuery, *message.RequestRawInterfaceRelative)
+		default:
+			value, err = queryInterface(c.PreparedJsonpathQuery, *message.RequestRawInterface)
+		}
+		if err != nil {
+			return nil
+		}
+		return value
+	}
+
+	var valueBytes []byte
+	var err error
+	switch {
+	case c.AttributeIsJsonpathRelative && (message.RequestJsonRawRelative == nil || len(*message.RequestJsonRawRelative) == 0):
+		return nil
+	case c.AttributeIsJsonpathRelative && isKeyValue:
+		valueBytes, err = getKeyValue(*message.RequestJsonRawRelative, c.AttributeJsonpathQuery)
+		if err == nil && strings.HasPrefix(c.AttributeJsonpathQuery, "$VALUE.") {
+			valueBytes, err = jsonslice.Get(valueBytes, strings.Replace(c.AttributeJsonpathQuery, "$VALUE.", "$.", 1))
+		}
+	case c.AttributeIsJsonpathRelative:
+		valueBytes, err = jsonslice.Get(*message.RequestJsonRawRelative, c.AttributeJsonpathQuery)
+	default:
+		if message.RequestJsonRaw == nil || len(*message.RequestJsonRaw) == 0 {
+			return nil
+		}
+		valueBytes, err = jsonslice.Get(*message.RequestJsonRaw, c.AttributeJsonpathQuery)
+	}
+	if err != nil || len(valueBytes) == 0 {
+		return nil
+	}
+	var value interface{}
+	if json.Unmarshal(valueBytes, &value) != nil {
+		return string(valueBytes)
+	}
+	return value
+}
@@ -0,0 +1,207 @@
+package MAPL_engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+const traceTestRules = `
+rules:
+  - ruleID: "any-container"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      ANY:
+        parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+        AND:
+        - attribute: "jsonpath:$RELATIVE.resources.limits.cpu"
+          method: LT
+          value: 4
+        - attribute: "jsonpath:$RELATIVE.resources.limits.memory"
+          method: LT
+          value: 1.2Gi
+    decision: block
+
+  - ruleID: "all-containers"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      ALL:
+        parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+        AND:
+        - attribute: "jsonpath:$RELATIVE.resources.limits.memory"
+          method: LT
+          value: 1.2Gi
+    decision: alert
+
+  - ruleID: "other-receiver"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "C.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    decision: allow
+
+  - ruleID: "not-pod"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      NOT:
+        attribute: "jsonpath:$.kind"
+        method: EQ
+        value: Pod
+    decision: allow
+
+  - ruleID: "post"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: POST
+    decision: allow
+`
+
+func TestTrace(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		rules, err := YamlReadRulesFromString(traceTestRules)
+		So(err, ShouldBeNil)
+		messages, err := YamlReadMessagesFromFile("../files/messages/messages_base_jsonpath.yaml")
+		So(err, ShouldBeNil)
+		data, err := ReadBinaryFile("../files/raw_json_data/any_all/json_raw_data_2containers_cpu2_mem2000.json")
+		So(err, ShouldBeNil)
+		var dataInterface interface{}
+		err = json.Unmarshal(data, &dataInterface)
+		So(err, ShouldBeNil)
+
+		messageBytes := messages.Messages[0]
+		messageBytes.RequestJsonRaw = &data
+		messageInterface := messages.Messages[0]
+		messageInterface.RequestRawInterface = &dataInterface
+
+		str := "test the trace of the rules"
+		fmt.Println(str)
+
+		result, err := CheckWithContext(context.Background(), &messageBytes, &rules, WithTrace())
+		So(err, ShouldBeNil)
+		So(result.Decision, ShouldEqual, BLOCK)
+		So(result.Trace, ShouldNotBeNil)
+		trace := result.Trace
+		So(trace.Rules, ShouldHaveLength, 5)
+
+		ruleTrace := trace.Rules[0] // ANY stops at the first matching container
+		So(ruleTrace.RuleID, ShouldEqual, "any-container")
+		So(ruleTrace.Applies, ShouldBeTrue)
+		So(ruleTrace.Decision, ShouldEqual, "block")
+		So(ruleTrace.RejectedBy, ShouldEqual, "")
+		So(ruleTrace.Conditions.Type, ShouldEqual, "ANY")
+		So(ruleTrace.Conditions.Result, ShouldBeTrue)
+		So(ruleTrace.Conditions.MatchedElements, ShouldResemble, []int{0})
+		So(ruleTrace.Conditions.Children, ShouldHaveLength, 1)
+		element := ruleTrace.Conditions.Children[0]
+		So(*element.ArrayIndex, ShouldEqual, 0)
+		So(element.Type, ShouldEqual, "AND")
+		So(element.Children, ShouldHaveLength, 2)
+		So(element.Children[0].Type, ShouldEqual, "CONDITION")
+		So(element.Children[0].Value, ShouldEqual, "2")
+		So(element.Children[1].Value, ShouldEqual, "1000Mi")
+
+		ruleTrace = trace.Rules[1] // ALL stops at the first container that doesn't match
+		So(ruleTrace.Applies, ShouldBeFalse)
+		So(ruleTrace.RejectedBy, ShouldEqual, StageConditions)
+		So(ruleTrace.Conditions.Type, ShouldEqual, "ALL")
+		So(ruleTrace.Conditions.MatchedElements, ShouldResemble, []int{0})
+		So(ruleTrace.Conditions.Children, ShouldHaveLength, 2)
+		So(ruleTrace.Conditions.Children[1].Result, ShouldBeFalse)
+		So(ruleTrace.Conditions.Children[1].Children[0].Value, ShouldEqual, "2000Mi")
+
+		So(trace.Rules[2].RejectedBy, ShouldEqual, StageReceiver)
+		So(trace.Rules[2].Conditions, ShouldBeNil)
+
+		ruleTrace = trace.Rules[3]
+		So(ruleTrace.RejectedBy, ShouldEqual, StageConditions)
+		So(ruleTrace.Conditions.Type, ShouldEqual, "NOT")
+		So(ruleTrace.Conditions.Result, ShouldBeFalse)
+		So(ruleTrace.Conditions.Children[0].Result, ShouldBeTrue)
+		So(ruleTrace.Conditions.Children[0].Value, ShouldEqual, "Pod")
+
+		So(trace.Rules[4].RejectedBy, ShouldEqual, StageOperation)
+
+		str = "test that the trace is the same with the interface and with the parallel evaluation"
+		fmt.Println(str)
+
+		result2, err := CheckWithContext(context.Background(), &messageInterface, &rules, WithTrace())
+		So(err, ShouldBeNil)
+		So(result2.Trace, ShouldResemble, trace)
+
+		result3, err := CheckWithContext(context.Background(), &messageBytes, &rules, WithTrace(), WithWorkers(4))
+		So(err, ShouldBeNil)
+		So(result3.Trace, ShouldResemble, trace)
+
+		result4, err := CheckWithContext(context.Background(), &messageBytes, &rules)
+		So(err, ShouldBeNil)
+		So(result4.Trace, ShouldBeNil)
+		So(result4.Results, ShouldResemble, result.Results)
+
+		str = "test the rendering of the trace"
+		fmt.Println(str)
+
+		traceJson, err := json.Marshal(trace)
+		So(err, ShouldBeNil)
+		So(string(traceJson), ShouldContainSubstring, `"rejectedBy":"receiver"`)
+		So(string(traceJson), ShouldContainSubstring, `"matchedElements":[0]`)
+
+		traceText := trace.String()
+		So(traceText, ShouldContainSubstring, "rule 0 [any-container]: block\n  ANY $.spec.containers[:]: true (matched elements: [0])\n    [0] AND: true\n")
+		So(traceText, ShouldContainSubstring, `(value: "2000Mi")`)
+		So(traceText, ShouldContainSubstring, "rule 2 [other-receiver]: rules do not apply to message (rejected by receiver)\n")
+	})
+}
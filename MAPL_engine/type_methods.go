@@ -0,0 +1,117 @@
+package MAPL_engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"strings"
+)
+
+//--------------------------------------
+// Type and Null Methods
+//--------------------------------------
+
+var typeMethods = []string{"IS_TYPE", "IS_NULL", "NOT_NULL"}
+
+var jsonTypes = []string{"string", "number", "bool", "array", "object", "null"}
+
+func isTypeMethod(method string) bool {
+	method = strings.ToUpper(method)
+	for _, m := range typeMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// parseJsonTypes parses the value of IS_TYPE: a type or a comma separated list of types ("[string,number]"). "boolean" is the same as "bool".
+func parseJsonTypes(value string) ([]string, error) {
+	list := strings.Replace(value, "[", "", -1)
+	list = strings.Replace(list, "]", "", -1)
+	types := []string{}
+	for _, t := range strings.Split(list, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "boolean" {
+			t = "bool"
+		}
+		found := false
+		for _, jsonType := range jsonTypes {
+			if t == jsonType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid type [%v] (the types are %v)", t, strings.Join(jsonTypes, ","))
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// jsonTypeOf returns the json type of a value of the raw data
+func jsonTypeOf(value interface{}) string {
+	if value == nil {
+		return "null"
+	}
+	if _, ok := value.(json.Number); ok {
+		return "number"
+	}
+	switch reflect.TypeOf(value).Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return ""
+}
+
+// compareTypeFunc tests the type of a value that exists in the data (null is a value)
+func compareTypeFunc(value1 interface{}, c *Condition) bool {
+	jsonType := jsonTypeOf(value1)
+	switch strings.ToUpper(c.Method) {
+	case "IS_NULL":
+		return jsonType == "null"
+	case "NOT_NULL":
+		return jsonType != "null"
+	case "IS_TYPE":
+		for _, t := range c.ValueTypes {
+			if t == jsonType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compareTypeOfJsonFunc tests the type of a json value (a result of jsonslice.Get)
+func compareTypeOfJsonFunc(value1 []byte, c *Condition) bool {
+	var valueInterface interface{}
+	err := json.Unmarshal(value1, &valueInterface)
+	if err != nil {
+		return false
+	}
+	return compareTypeFunc(valueInterface, c)
+}
+
+// typeMongoQuery returns the query of a type method. $type matches only fields that exist (and "null" only explicit nulls).
+func typeMongoQuery(field string, c *Condition) bson.M {
+	switch strings.ToUpper(c.Method) {
+	case "IS_NULL":
+		return bson.M{field: bson.M{"$type": "null"}}
+	case "NOT_NULL":
+		return bson.M{field: bson.M{"$ne": nil}} // a missing field is null in queries
+	}
+	if len(c.ValueTypes) == 1 {
+		return bson.M{field: bson.M{"$type": c.ValueTypes[0]}}
+	}
+	return bson.M{field: bson.M{"$type": c.ValueTypes}}
+}
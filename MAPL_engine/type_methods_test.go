@@ -0,0 +1,117 @@
+package MAPL_engine
+
+import (
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"go.mongodb.org/mongo-driver/bson"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+var typeMethodsTestCases = []conditionMethodTestCase{
+	{"jsonpath:$.spec.nullValue", "IS_NULL", "", true},
+	{"jsonpath:$.spec.nullString", "IS_NULL", "", false},
+	{"jsonpath:$.spec.missing", "IS_NULL", "", false},
+	{"jsonpath:$.spec.nullValue", "NOT_NULL", "", false},
+	{"jsonpath:$.spec.nullString", "not_null", "", true},
+	{"jsonpath:$.spec.emptyString", "NOT_NULL", "", true},
+	{"jsonpath:$.spec.missing", "NOT_NULL", "", false},
+	{"jsonpath:$.spec.nullValue", "IS_TYPE", "null", true},
+	{"jsonpath:$.spec.nullString", "IS_TYPE", "string", true},
+	{"jsonpath:$.spec.falseValue", "IS_TYPE", "bool", true},
+	{"jsonpath:$.spec.falseValue", "IS_TYPE", "boolean", true},
+	{"jsonpath:$.spec.falseString", "IS_TYPE", "bool", false},
+	{"jsonpath:$.spec.zero", "IS_TYPE", "number", true},
+	{"jsonpath:$.spec.emptyArray", "IS_TYPE", "array", true},
+	{"jsonpath:$.spec.emptyObject", "IS_TYPE", "object", true},
+	{"jsonpath:$.spec.replicas", "IS_TYPE", "[string,number]", true},
+	{"jsonpath:$.spec.ports", "IS_TYPE", "[string,number]", false},
+	{"jsonpath:$.spec.missing", "IS_TYPE", "null", false},
+	// the other methods: null is an empty result (as a missing attribute)
+	{"jsonpath:$.spec.nullValue", "EX", "", false},
+	{"jsonpath:$.spec.nullValue", "NEX", "", true},
+	{"jsonpath:$.spec.nullString", "EX", "", true},
+	{"jsonpath:$.spec.nullValue", "EQ", "null", false},
+	{"jsonpath:$.spec.nullString", "EQ", "null", true},
+	{"jsonpath:$.spec.nullValue", "NEQ", "x", false},
+	{"jsonpath:$.spec.nullValue", "RE", ".*", false},
+	{"jsonpath:$.spec.falseValue", "EQ", "false", true},
+	{"jsonpath:$.spec.zero", "EQ", "null", false},
+	{"jsonpath:$.spec.zero", "NEQ", "null", true},
+	{"jsonpath:$.spec.zero", "EQ", "0", true},
+	{"jsonpath:$.spec.emptyString", "NEX", "", true},
+	{"jsonpath:$.spec.missing", "NEX", "", true},
+	{"jsonpath:$.spec.missing", "NEQ", "x", false},
+}
+
+func TestTypeMethods(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test the type and null methods"
+		fmt.Println(str)
+
+		messages := methodTestMessages(MessageAttributes{}, `{"spec":{"nullValue":null,"nullString":"null","falseValue":false,"falseString":"false","zero":0,"emptyString":"",
+"emptyArray":[],"emptyObject":{},"replicas":1.5,"ports":[80,443]}}`)
+		testConditionMethods(typeMethodsTestCases, PredefinedStringsAndLists{}, messages)
+
+		str = "test the type methods within arrays"
+		fmt.Println(str)
+
+		c := normalizeTestConditionsTree(`
+ANY:
+  parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+  condition:
+    attribute: "jsonpath:$RELATIVE.securityContext"
+    method: IS_NULL`)
+		err := c.ConditionsTree.PrepareAndValidate(PredefinedStringsAndLists{})
+		So(err, ShouldBeNil)
+		messages = methodTestMessages(MessageAttributes{}, `{"spec":{"containers":[{"name":"a","securityContext":{}},{"name":"b"}]}}`)
+		testEvalOnMessages(c.ConditionsTree, false, messages) // a missing securityContext is not null
+		messages = methodTestMessages(MessageAttributes{}, `{"spec":{"containers":[{"name":"a","securityContext":{}},{"name":"b","securityContext":null}]}}`)
+		testEvalOnMessages(c.ConditionsTree, true, messages)
+
+		str = "test the negation and the mongo queries of the type methods"
+		fmt.Println(str)
+
+		c = normalizeTestConditionsTree(`
+NOT:
+  attribute: "jsonpath:$.spec.nullValue"
+  method: IS_NULL`)
+		So(NormalizeWithNegatedMethods(c.ConditionsTree).String(), ShouldEqual, "<jsonpath:$.spec.nullValue-NOT_NULL->")
+
+		for _, testCase := range []struct {
+			condition Condition
+			expected  bson.M
+		}{
+			{Condition{Attribute: "jsonpath:$.spec.nullValue", Method: "IS_NULL"}, bson.M{"raw.spec.nullValue": bson.M{"$type": "null"}}},
+			{Condition{Attribute: "jsonpath:$.spec.nullValue", Method: "NOT_NULL"}, bson.M{"raw.spec.nullValue": bson.M{"$ne": nil}}},
+			{Condition{Attribute: "jsonpath:$.spec.replicas", Method: "IS_TYPE", Value: "number"}, bson.M{"raw.spec.replicas": bson.M{"$type": "number"}}},
+			{Condition{Attribute: "jsonpath:$.spec.replicas", Method: "IS_TYPE", Value: "[string,boolean]"}, bson.M{"raw.spec.replicas": bson.M{"$type": []string{"string", "bool"}}}},
+		} {
+			err := testCase.condition.PrepareAndValidate(PredefinedStringsAndLists{})
+			So(err, ShouldBeNil)
+			q, _, err := testCase.condition.ToMongoQuery("raw", "", 0)
+			So(err, ShouldBeNil)
+			So(q, ShouldResemble, testCase.expected)
+		}
+
+		str = "test the validation of the type methods"
+		fmt.Println(str)
+
+		for _, invalid := range []Condition{
+			{Attribute: "jsonpath:$.spec.replicas", Method: "IS_TYPE", Value: ""},
+			{Attribute: "jsonpath:$.spec.replicas", Method: "IS_TYPE", Value: "integer"},
+			{Attribute: "jsonpath:$.spec.replicas", Method: "IS_TYPE", Value: "[string,date]"},
+			{Attribute: "payloadSize", Method: "IS_NULL"},
+			{Attribute: "senderLabel[app]", Method: "NOT_NULL"},
+		} {
+			_, err = ValidateOneCondition(&invalid)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
@@ -8,9 +8,18 @@ import (
 	"strings"
 )
 
-var supportedMethodsSlice = []string{"ge", "GE", "gt", "GT", "le", "LE", "lt", "LT", "re", "RE", "nre", "NRE", "in", "IN", "nin", "NIN", "eq", "EQ", "neq", "NEQ", "ne", "NE", "ex", "EX", "nex", "NEX", "IS"}
+var supportedMethodsSlice = []string{"ge", "GE", "gt", "GT", "le", "LE", "lt", "LT", "re", "RE", "nre", "NRE", "in", "IN", "nin", "NIN", "eq", "EQ", "neq", "NEQ", "ne", "NE", "ex", "EX", "nex", "NEX", "IS",
+	"prefix", "PREFIX", "nprefix", "NPREFIX", "suffix", "SUFFIX", "nsuffix", "NSUFFIX", "contains", "CONTAINS", "ncontains", "NCONTAINS",
+	"eq_ci", "EQ_CI", "neq_ci", "NEQ_CI", "in_ci", "IN_CI", "nin_ci", "NIN_CI", "glob", "GLOB", "nglob", "NGLOB",
+	"semver_lt", "SEMVER_LT", "semver_le", "SEMVER_LE", "semver_gt", "SEMVER_GT", "semver_ge", "SEMVER_GE", "semver_eq", "SEMVER_EQ", "semver_in_range", "SEMVER_IN_RANGE",
+	"in_cidr", "IN_CIDR", "nin_cidr", "NIN_CIDR", "is_private_ip", "IS_PRIVATE_IP", "is_public_ip", "IS_PUBLIC_IP",
+	"before", "BEFORE", "after", "AFTER", "older_than", "OLDER_THAN", "newer_than", "NEWER_THAN",
+	"len_eq", "LEN_EQ", "len_gt", "LEN_GT", "len_ge", "LEN_GE", "len_lt", "LEN_LT", "len_le", "LEN_LE",
+	"is_type", "IS_TYPE", "is_null", "IS_NULL", "not_null", "NOT_NULL"}
 var regexSlice = []string{"re", "nre", "RE", "NRE"}
 var numberMethodSlice = []string{"ge", "GE", "gt", "GT", "le", "LE", "lt", "LT"}
+var numericalAttributes = []string{"payloadSize", "utcHoursFromMidnight", "encryptionVersion"}
+var jsonpathValueMethodSlice = []string{"eq", "EQ", "neq", "NEQ", "ne", "NE", "ge", "GE", "gt", "GT", "le", "LE", "lt", "LT"}
 var supportedAttributesPrefixes = []string{"$sender.", "$receiver.", "senderLabel[", "receiverLabel[", "jsonpath:"}
 var supportedAttributesExact = []string{"true", "TRUE", "false", "FALSE", "payloadSize", "requestUseragent", "utcHoursFromMidnight", "encryptionType", "encryptionVersion", "domain"}
 var allowedEncryptionVersionOperation = []string{"eq", "lt", "le", "gt", "ge", "EQ", "LT", "LE", "GT", "GE"}
@@ -28,6 +37,11 @@ func ValidateOneCondition(condition *Condition) (bool, error) {
 		return flagMethod, err
 	}
 
+	flagValue, err := validateJsonpathValue(condition)
+	if err != nil {
+		return flagValue, err
+	}
+
 	flagNumerical, err := convertAndValidateNumericalValues(condition)
 	if err != nil {
 		return flagNumerical, err
@@ -144,6 +158,98 @@ func validateMethod(condition *Condition) (bool, error) {
 			return false, fmt.Errorf("condition.Value is not a valid array")
 		}
 	}
+	if _, ok := stringMethods[strings.ToUpper(condition.Method)]; ok {
+		if len(condition.Value) == 0 || condition.Value == "[]" {
+			return false, fmt.Errorf("empty value with method [%v]", condition.Method)
+		}
+		if slice.ContainsString(numericalAttributes, condition.Attribute) {
+			return false, fmt.Errorf("string method [%v] with numerical attribute [%v]", condition.Method, condition.Attribute)
+		}
+		if strings.HasPrefix(condition.Value, "receiverLabel[") || strings.HasPrefix(condition.Value, "$receiver.") {
+			return false, fmt.Errorf("string method [%v] with a comparison of sender and receiver", condition.Method)
+		}
+		if strings.ToUpper(condition.Method) == "GLOB" || strings.ToUpper(condition.Method) == "NGLOB" {
+			if _, err := convertGlobToRegex(condition.Value); err != nil {
+				return false, err
+			}
+		}
+	}
+	if isSemverMethod(condition.Method) {
+		if slice.ContainsString(numericalAttributes, condition.Attribute) {
+			return false, fmt.Errorf("semver method [%v] with numerical attribute [%v]", condition.Method, condition.Attribute)
+		}
+		if _, err := newSemverRange(condition.Method, condition.Value); err != nil && !strings.HasPrefix(condition.Value, "#") { // a predefined string is replaced when the condition is prepared
+			return false, fmt.Errorf("invalid semantic version with method [%v]: %v", condition.Method, err)
+		}
+	}
+	if isIPMethod(condition.Method) {
+		if slice.ContainsString(numericalAttributes, condition.Attribute) {
+			return false, fmt.Errorf("ip method [%v] with numerical attribute [%v]", condition.Method, condition.Attribute)
+		}
+		if strings.ToUpper(condition.Method) == "IN_CIDR" || strings.ToUpper(condition.Method) == "NIN_CIDR" {
+			if len(condition.Value) == 0 || condition.Value == "[]" {
+				return false, fmt.Errorf("empty value with method [%v]", condition.Method)
+			}
+			if _, err := parseCIDRList(condition.Value); err != nil && !strings.HasPrefix(condition.Value, "#") { // a predefined list is replaced when the condition is prepared
+				return false, fmt.Errorf("invalid CIDR with method [%v]: %v", condition.Method, err)
+			}
+		}
+	}
+	if isTimeMethod(condition.Method) {
+		if slice.ContainsString(numericalAttributes, condition.Attribute) {
+			return false, fmt.Errorf("time method [%v] with numerical attribute [%v]", condition.Method, condition.Attribute)
+		}
+		var err error
+		switch strings.ToUpper(condition.Method) {
+		case "BEFORE", "AFTER":
+			_, err = parseTimestamp(condition.Value)
+		default:
+			_, err = parseAgeDuration(condition.Value)
+		}
+		if err != nil && !strings.HasPrefix(condition.Value, "#") { // a predefined string is replaced when the condition is prepared
+			return false, fmt.Errorf("invalid value with method [%v]: %v", condition.Method, err)
+		}
+	}
+	if isLengthMethod(condition.Method) {
+		if !strings.HasPrefix(condition.Attribute, "jsonpath:") {
+			return false, fmt.Errorf("length method [%v] with an attribute that is not a jsonpath [%v]", condition.Method, condition.Attribute)
+		}
+		length, err := strconv.ParseInt(condition.Value, 10, 64)
+		if (err != nil || length < 0) && !strings.HasPrefix(condition.Value, "#") { // a predefined string is replaced when the condition is prepared
+			return false, fmt.Errorf("invalid length [%v] with method [%v]", condition.Value, condition.Method)
+		}
+	}
+	if isTypeMethod(condition.Method) {
+		if !strings.HasPrefix(condition.Attribute, "jsonpath:") {
+			return false, fmt.Errorf("type method [%v] with an attribute that is not a jsonpath [%v]", condition.Method, condition.Attribute)
+		}
+		if strings.ToUpper(condition.Method) == "IS_TYPE" {
+			if _, err := parseJsonTypes(condition.Value); err != nil && !strings.HasPrefix(condition.Value, "#") { // a predefined string is replaced when the condition is prepared
+				return false, fmt.Errorf("invalid value with method [%v]: %v", condition.Method, err)
+			}
+		}
+	}
+	return true, nil
+}
+
+// validateJsonpathValue validates a value that references another field of the data (for example: jsonpath:$.spec.replicas LE jsonpath:$.spec.maxReplicas)
+func validateJsonpathValue(condition *Condition) (bool, error) {
+
+	if !strings.HasPrefix(condition.Value, "jsonpath:") {
+		return true, nil
+	}
+	if !strings.HasPrefix(condition.Attribute, "jsonpath:") {
+		return false, fmt.Errorf("jsonpath value with an attribute that is not a jsonpath [%v]", condition.Attribute)
+	}
+	if !slice.ContainsString(jsonpathValueMethodSlice, condition.Method) {
+		return false, fmt.Errorf("invalid method with a jsonpath value [%v]", condition.Method)
+	}
+	if !strings.HasPrefix(condition.Value, "jsonpath:$.") && !strings.HasPrefix(condition.Value, "jsonpath:$RELATIVE.") {
+		return false, fmt.Errorf("jsonpath value must start with '$.' or '$RELATIVE.' [%v]", condition.Value)
+	}
+	if strings.Contains(condition.Value, "[:]") || strings.Contains(condition.Value, "[]") || strings.Contains(condition.Value, "..") || !validateArraysWithIndex(condition.Value) {
+		return false, fmt.Errorf("jsonpath value must reference a single field [%v]", condition.Value)
+	}
 	return true, nil
 }
 
@@ -163,7 +269,7 @@ func convertAndValidateNumericalValues(condition *Condition) (bool, error) {
 		isNum = true
 	}
 
-	if isNum == false && slice.ContainsString(numberMethodSlice, condition.Method) {
+	if isNum == false && slice.ContainsString(numberMethodSlice, condition.Method) && !strings.HasPrefix(condition.Value, "jsonpath:") {
 		return false, fmt.Errorf("invalid numerical value in condition")
 	}
 
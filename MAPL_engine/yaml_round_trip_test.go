@@ -0,0 +1,218 @@
+package MAPL_engine
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/smartystreets/goconvey/convey/reporting"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const yamlRoundTripTestRules = `
+rules:
+  - ruleID: "all-node-types"
+    sender:
+      senderName: "A.my_namespace"
+      senderType: "workload"
+    receiver:
+      receiverName: "B.my_namespace"
+      receiverType: "workload"
+    protocol: "*"
+    resource:
+      resourceType: "*"
+      resourceName: "*"
+    operation: "*"
+    conditions:
+      AND:
+      - attribute: "jsonpath:$.kind"
+        method: IN
+        value: "[Pod,Deployment]"
+      - attribute: "jsonpath:$.metadata.name"
+        method: NIN
+        value: "[a,b]"
+      - attribute: "jsonpath:$.metadata.labels[\"app.kubernetes.io/name\"]"
+        method: RE
+        value: "^\"quoted\"\\d+\n$"
+        returnValueJsonpath:
+          name: "jsonpath:$.metadata.name"
+      - ANY:
+          parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+          returnValueJsonpath:
+            image: "jsonpath:$RELATIVE.image"
+          condition:
+            attribute: "jsonpath:$RELATIVE.image"
+            method: EQ
+            value: "nginx"
+      - NOT:
+          ALL:
+            parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+            OR:
+            - attribute: "jsonpath:$RELATIVE.securityContext.runAsUser"
+              method: EQ
+              value: 0
+            - attribute: "jsonpath:$RELATIVE.securityContext.privileged"
+              method: NEX
+      - COUNT:
+          parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+          method: EQ
+          value: 0
+          condition:
+            attribute: "jsonpath:$RELATIVE.resources.limits.memory"
+            method: GT
+            value: 1Gi
+      - AT_LEAST:
+          n: 1
+          conditions:
+          - attribute: "jsonpath:$.spec.replicas"
+            method: GE
+            value: 2
+          - XOR:
+            - attribute: "jsonpath:$.spec.hostNetwork"
+              method: EQ
+              value: "true"
+            - attribute: "jsonpath:$.spec.hostPID"
+              method: EX
+      - EXACTLY:
+          n: 0
+          conditions:
+          - REF: rootContainer
+    decision: block
+    obligations:
+    - type: notify
+      payload:
+        channel: "security"
+    metadata:
+      name: "round trip"
+
+  - ruleID: "no-conditions"
+    sender:
+      senderName: "*"
+      senderType: "*"
+    receiver:
+      receiverName: "10.0.0.0/8"
+      receiverType: "subnet"
+    protocol: "http"
+    resource:
+      resourceType: "path"
+      resourceName: "/books/*"
+    operation: "GET"
+    decision: allow
+`
+
+func TestYamlRoundTrip(t *testing.T) {
+
+	log.SetOutput(ioutil.Discard)
+	reporting.QuietMode()
+	Convey("tests", t, func() {
+
+		str := "test that marshalling rules to yaml and reading them back gives the same rules"
+		fmt.Println(str)
+
+		rules, err := YamlReadRulesFromString(yamlRoundTripTestRules)
+		So(err, ShouldBeNil)
+		testYamlRoundTrip(rules)
+
+		var rootContainer ConditionsTree
+		err = yaml.Unmarshal([]byte(`
+ANY:
+  parentJsonpathAttribute: "jsonpath:$.spec.containers[:]"
+  condition:
+    attribute: "jsonpath:$RELATIVE.securityContext.runAsUser"
+    method: EQ
+    value: 0`), &rootContainer)
+		So(err, ShouldBeNil)
+		stringsAndLists := PredefinedStringsAndLists{PredefinedConditions: map[string]ConditionsTree{"rootContainer": rootContainer}}
+		for i := range rules.Rules { // the prepared rules are marshalled with the original attributes, methods and values
+			if rules.Rules[i].Conditions.ConditionsTree != nil {
+				err = rules.Rules[i].Conditions.ConditionsTree.PrepareAndValidate(stringsAndLists)
+				So(err, ShouldBeNil)
+			}
+		}
+		So(rules.Rules[0].Conditions.ConditionsTree.(*And).Nodes[0].(*Condition).Method, ShouldEqual, "RE")
+		testYamlRoundTrip(rules)
+
+		data, err := yaml.Marshal(rules)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldNotContainSubstring, "conditionsTree")
+		So(string(data), ShouldNotContainSubstring, "operationRegex")
+		So(string(data), ShouldContainSubstring, "method: IN")
+
+		str = "test the json of the prepared rules"
+		fmt.Println(str)
+
+		conditionsJson, err := json.Marshal(rules.Rules[0].Conditions)
+		So(err, ShouldBeNil)
+		So(string(conditionsJson), ShouldContainSubstring, `{"condition":{"attribute":"jsonpath:$.kind","method":"IN","value":"[Pod,Deployment]"}}`)
+		So(string(conditionsJson), ShouldContainSubstring, `{"ANY":{"parentJsonpathAttribute":"jsonpath:$.spec.containers[:]","returnValueJsonpath":{"image":"jsonpath:$RELATIVE.image"},"condition":`)
+		So(string(conditionsJson), ShouldContainSubstring, `{"COUNT":{"parentJsonpathAttribute":"jsonpath:$.spec.containers[:]","method":"EQ","value":0,"condition":`)
+		var conditions ConditionsTree
+		err = json.Unmarshal(conditionsJson, &conditions) // the quotes, backslashes and newlines are escaped
+		So(err, ShouldBeNil)
+		So(conditions.ConditionsTree.String(), ShouldEqual, rules.Rules[0].Conditions.ConditionsTree.String())
+
+		str = "test TRUE/FALSE nodes"
+		fmt.Println(str)
+
+		for _, node := range []Node{True{}, False{}} {
+			data, err := yaml.Marshal(ConditionsTree{ConditionsTree: &Or{Nodes: []Node{node}}})
+			So(err, ShouldBeNil)
+			var c ConditionsTree
+			err = yaml.Unmarshal(data, &c)
+			So(err, ShouldBeNil)
+			err = c.ConditionsTree.PrepareAndValidate(PredefinedStringsAndLists{})
+			So(err, ShouldBeNil)
+			flag, _ := c.ConditionsTree.Eval(&MessageAttributes{})
+			expectedFlag, _ := node.Eval(&MessageAttributes{})
+			So(flag, ShouldEqual, expectedFlag)
+		}
+
+		str = "test the rules files"
+		fmt.Println(str)
+
+		files, err := filepath.Glob("../files/rules/*/*.yaml")
+		So(err, ShouldBeNil)
+		n := 0
+		for _, file := range files {
+			if strings.Contains(file, "invalid") || strings.Contains(file, "predefined_strings") {
+				continue
+			}
+			rules, err := YamlReadRulesFromFile(file)
+			if err != nil {
+				continue
+			}
+			testYamlRoundTrip(rules)
+			n++
+		}
+		So(n, ShouldBeGreaterThan, 50)
+	})
+}
+
+func testYamlRoundTrip(rules Rules) {
+
+	data, err := yaml.Marshal(rules)
+	So(err, ShouldBeNil)
+	rules2, err := YamlReadRulesFromString(string(data))
+	So(err, ShouldBeNil)
+	So(rules2.Rules, ShouldHaveLength, len(rules.Rules))
+	for i := range rules.Rules {
+		So(RuleToString(rules2.Rules[i]), ShouldEqual, RuleToString(rules.Rules[i]))
+		So(RuleMD5Hash(rules2.Rules[i]), ShouldEqual, RuleMD5Hash(rules.Rules[i]))
+		So(rules2.Rules[i].Obligations, ShouldResemble, rules.Rules[i].Obligations)
+		So(rules2.Rules[i].Metadata, ShouldResemble, rules.Rules[i].Metadata)
+
+		json1, err := json.Marshal(rules.Rules[i].Conditions)
+		So(err, ShouldBeNil)
+		json2, err := json.Marshal(rules2.Rules[i].Conditions)
+		So(err, ShouldBeNil)
+		So(string(json2), ShouldEqual, string(json1))
+	}
+
+	data2, err := yaml.Marshal(rules2)
+	So(err, ShouldBeNil)
+	So(string(data2), ShouldEqual, string(data))
+}